@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"redditclone/pkg/repository"
+	"time"
+)
+
+// sweepBans removes expired community bans every interval until ctx is
+// done. Expired bans stop being enforced right away, the sweep only drops
+// them from storage and the moderators' ban lists.
+func sweepBans(ctx context.Context, communities repository.CommunityStore, interval time.Duration, logger *zap.SugaredLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := communities.ExpireBans(now)
+			if err != nil {
+				logger.Errorw("expiring community bans", "error", err)
+				continue
+			}
+			if n > 0 {
+				logger.Infow("community bans expired", "count", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"go.uber.org/zap"
+	"redditclone/pkg/models"
+	"redditclone/pkg/repository"
+	"strings"
+	"time"
+)
+
+// defaultCommunities are the categories the bundled frontend offers.
+const defaultCommunities = "music,funny,videos,programming,news,fashion"
+
+// seedCommunities creates every community of the comma separated list that
+// does not exist yet, without a creator.
+func seedCommunities(communities repository.CommunityStore, list string, logger *zap.SugaredLogger) {
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !models.ValidCommunityName(name) {
+			logger.Warnw("skipping invalid community name", "community", name)
+			continue
+		}
+		err := communities.Create(&models.Community{
+			Name:       name,
+			Title:      name,
+			Created:    time.Now(),
+			Rules:      make([]string, 0),
+			Visibility: models.VisibilityPublic,
+		})
+		if errors.Is(err, repository.ErrCommunityExists) {
+			continue
+		}
+		if err != nil {
+			logger.Errorw("creating community", "community", name, "error", err)
+			continue
+		}
+		logger.Infow("community created", "community", name)
+	}
+}
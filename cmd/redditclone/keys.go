@@ -0,0 +1,57 @@
+package main
+
+import (
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"redditclone/pkg/auth"
+	"syscall"
+)
+
+// jwtSecretEnv is consulted for an HS256 secret when no keyring file is
+// configured.
+const jwtSecretEnv = "REDDITCLONE_JWT_SECRET"
+
+// setupKeyring installs the JWT keyring. With a keyring file it is
+// reloaded on SIGHUP, so keys can be rotated without a restart.
+func setupKeyring(path string, logger *zap.SugaredLogger) error {
+	if path == "" {
+		keyring, err := fallbackKeyring(logger)
+		if err != nil {
+			return err
+		}
+		auth.UseKeyring(keyring)
+		return nil
+	}
+
+	keyring, err := auth.LoadKeyring(path)
+	if err != nil {
+		return err
+	}
+	auth.UseKeyring(keyring)
+	logger.Infow("jwt keyring loaded", "file", path, "active", keyring.Active().ID)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			keyring, err := auth.LoadKeyring(path)
+			if err != nil {
+				logger.Errorw("reloading jwt keyring, keeping the old one", "file", path, "error", err)
+				continue
+			}
+			auth.UseKeyring(keyring)
+			logger.Infow("jwt keyring reloaded", "file", path, "active", keyring.Active().ID)
+		}
+	}()
+	return nil
+}
+
+func fallbackKeyring(logger *zap.SugaredLogger) (*auth.Keyring, error) {
+	if secret := os.Getenv(jwtSecretEnv); secret != "" {
+		return auth.NewHMACKeyring("default", []byte(secret))
+	}
+	logger.Warnw("no jwt keys configured, using a random secret; tokens won't survive a restart",
+		"flag", "-jwt-keys", "env", jwtSecretEnv)
+	return auth.NewRandomHMACKeyring()
+}
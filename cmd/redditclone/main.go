@@ -1,15 +1,57 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"redditclone/pkg/auth"
 	"redditclone/pkg/handlers"
 	"redditclone/pkg/middleware"
+	"redditclone/pkg/models"
+	"redditclone/pkg/ranking"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultDBDriver = "sqlite3"
+	defaultDBDSN    = "file:redditclone.db?_foreign_keys=on"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var cfg storageConfig
+	flag.StringVar(&cfg.backend, "storage", "memory", "storage backend: memory, file or sql")
+	flag.StringVar(&cfg.dataDir, "data-dir", "./data", "directory for the file storage backend")
+	flag.StringVar(&cfg.dbDriver, "db-driver", defaultDBDriver, "database/sql driver name for the sql storage backend")
+	flag.StringVar(&cfg.dbDSN, "db-dsn", defaultDBDSN, "database connection string for the sql storage backend")
+	flag.DurationVar(&auth.AccessTokenTTL, "access-token-ttl", auth.AccessTokenTTL, "lifetime of access tokens")
+	flag.DurationVar(&auth.RefreshTokenTTL, "refresh-token-ttl", auth.RefreshTokenTTL, "lifetime of refresh tokens")
+	jwtKeys := flag.String("jwt-keys", "", "JWT keyring config file, see README")
+	moderators := flag.String("moderators", "", "comma separated usernames granted the moderator role")
+	admins := flag.String("admins", "", "comma separated usernames granted the admin role")
+	commentSort := flag.String("comment-sort", models.CommentSortBest, "default comment sort: best, top, new, old or controversial")
+	categoryCommentSorts := flag.String("category-comment-sort", "", "per category comment sorts, e.g. news=new,funny=top")
+	postSort := flag.String("post-sort", ranking.Hot, "default post listing sort: hot, new, top, rising or controversial")
+	titleEditWindow := flag.Duration("title-edit-window", handlers.DefaultTitleEditWindow, "how long after posting the title may be edited")
+	postAuthorsDeleteComments := flag.Bool("post-authors-delete-comments", true, "let post authors delete comments under their posts")
+	seed := flag.String("communities", defaultCommunities, "comma separated communities created at startup when missing")
+	banSweep := flag.Duration("ban-sweep-interval", time.Minute, "how often expired community bans are removed")
+	hideVoters := flag.Bool("hide-voters", true, "show only vote counts and the viewer's own vote, voters are visible to admins only")
+	flag.Parse()
+
 	zapLogger, err := zap.NewProduction()
 	if err != nil {
 		log.Fatal("Failed to initialize zap logger", zap.Error(err))
@@ -24,6 +66,36 @@ func main() {
 		}
 	}()
 
+	categorySorts, err := parseCommentSorts(*commentSort, *categoryCommentSorts)
+	if err != nil {
+		logger.Fatalw("parsing comment sorts", "error", err)
+		return
+	}
+	if _, ok := ranking.Lookup(*postSort); !ok {
+		logger.Fatalw("unknown post sort", "sort", *postSort)
+		return
+	}
+	if *banSweep <= 0 {
+		logger.Fatalw("ban sweep interval must be positive", "interval", *banSweep)
+		return
+	}
+
+	if err = setupKeyring(*jwtKeys, logger); err != nil {
+		logger.Fatalw("loading jwt keys", "error", err)
+		return
+	}
+
+	storage, err := openStores(cfg, logger)
+	if err != nil {
+		logger.Fatalw("opening storage", "error", err)
+		return
+	}
+	defer storage.close(logger)
+
+	grantRoles(storage.users, models.RoleModerator, *moderators, logger)
+	grantRoles(storage.users, models.RoleAdmin, *admins, logger)
+	seedCommunities(storage.communities, *seed, logger)
+
 	r := mux.NewRouter()
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./static/"))))
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -31,34 +103,95 @@ func main() {
 		logger.Infoln("NOT INDEX METHOD /HTML/INDEX")
 	}).Methods("GET")
 
-	authHandler := handlers.NewUserHandler(logger)
-	postsHandler := handlers.NewPostHandler(logger)
+	authHandler := handlers.NewUserHandler(logger, storage.users, storage.sessions, storage.refreshTokens)
+	postsHandler := handlers.NewPostHandler(logger, storage.posts, storage.users, storage.communities)
+	postsHandler.PostAuthorsDeleteComments = *postAuthorsDeleteComments
+	postsHandler.CommentSort = *commentSort
+	postsHandler.CategoryCommentSorts = categorySorts
+	postsHandler.TitleEditWindow = *titleEditWindow
+	postsHandler.PostSort = *postSort
+	postsHandler.HideVoters = *hideVoters
+	communityHandler := handlers.NewCommunityHandler(logger, storage.communities, storage.posts, storage.users)
+	keyHandler := handlers.NewKeyHandler(logger)
+
+	r.HandleFunc("/.well-known/jwks.json", keyHandler.JWKS).Methods("GET")
+
+	authMW := middleware.NewAuth(logger, storage.sessions)
+	required := func(h http.HandlerFunc) http.Handler { return authMW.RequireAuth(h) }
+	optional := func(h http.HandlerFunc) http.Handler { return authMW.OptionalAuth(h) }
 
 	r.HandleFunc("/api/register", authHandler.RegisterPage).Methods("POST")
 	r.HandleFunc("/api/login", authHandler.LoginPage).Methods("POST")
+	r.Handle("/api/logout", required(authHandler.Logout)).Methods("POST")
+	r.HandleFunc("/api/token/refresh", authHandler.RefreshToken).Methods("POST")
+	r.Handle("/api/sessions", required(authHandler.ListSessions)).Methods("GET")
+	r.Handle("/api/sessions/{SESSION_ID}", required(authHandler.DeleteSession)).Methods("DELETE")
+
+	r.Handle("/api/posts/", optional(postsHandler.ListAllPosts)).Methods("GET")
+	r.Handle("/api/posts", required(postsHandler.CreatePost)).Methods("POST")
+	r.Handle("/api/posts/{CATEGORY_NAME}", optional(postsHandler.ListCategoryPosts)).Methods("GET")
+	r.Handle("/api/feed", optional(postsHandler.Feed)).Methods("GET")
 
-	r.HandleFunc("/api/posts/", postsHandler.ListAllPosts).Methods("GET")
-	r.HandleFunc("/api/posts", postsHandler.CreatePost).Methods("POST")
-	r.HandleFunc("/api/posts/{CATEGORY_NAME}", postsHandler.ListCategoryPosts).Methods("GET")
+	r.Handle("/api/post/{POST_ID}", optional(postsHandler.ListPostByID)).Methods("GET")
+	r.Handle("/api/post/{POST_ID}", required(postsHandler.AddCommentPost)).Methods("POST")
+	r.Handle("/api/post/{POST_ID}/{COMMENT_ID}", required(postsHandler.DeleteCommentPost)).Methods("DELETE")
+	r.Handle("/api/post/{POST_ID}/{COMMENT_ID}", required(postsHandler.EditCommentPost)).Methods("PUT")
+	r.Handle("/api/post/{POST_ID}/{COMMENT_ID}/history", required(postsHandler.CommentHistory)).Methods("GET")
+	r.Handle("/api/post/{POST_ID}/{COMMENT_ID}/reply", required(postsHandler.ReplyCommentPost)).Methods("POST")
+	r.Handle("/api/post/{POST_ID}/{COMMENT_ID}/upvote", required(postsHandler.UpVoteComment)).Methods("GET")
+	r.Handle("/api/post/{POST_ID}/{COMMENT_ID}/downvote", required(postsHandler.DownVoteComment)).Methods("GET")
+	r.Handle("/api/post/{POST_ID}/{COMMENT_ID}/unvote", required(postsHandler.UnVoteComment)).Methods("GET")
 
-	r.HandleFunc("/api/post/{POST_ID}", postsHandler.ListPostByID).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID}", postsHandler.AddCommentPost).Methods("POST")
-	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}", postsHandler.DeleteCommentPost).Methods("DELETE")
+	r.Handle("/api/post/{POST_ID}/upvote", required(postsHandler.UpVote)).Methods("GET")
+	r.Handle("/api/post/{POST_ID}/downvote", required(postsHandler.DownVote)).Methods("GET")
+	r.Handle("/api/post/{POST_ID}/unvote", required(postsHandler.UnVote)).Methods("GET")
 
-	r.HandleFunc("/api/post/{POST_ID}/upvote", postsHandler.UpVote).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID}/downvote", postsHandler.DownVote).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID}/unvote", postsHandler.UnVote).Methods("GET")
+	r.Handle("/api/post/{POST_ID}", required(postsHandler.DeletePostByID)).Methods("DELETE")
+	r.Handle("/api/post/{POST_ID}", required(postsHandler.EditPost)).Methods("PUT")
+	r.Handle("/api/post/{POST_ID}/revisions", optional(postsHandler.PostRevisions)).Methods("GET")
+	r.Handle("/api/post/{POST_ID}/revisions/diff", optional(postsHandler.PostDiff)).Methods("GET")
+	r.Handle("/api/post/{POST_ID}/votes", required(postsHandler.PostVotes)).Methods("GET")
 
-	r.HandleFunc("/api/post/{POST_ID}", postsHandler.DeletePostByID).Methods("DELETE")
+	r.Handle("/api/r", optional(communityHandler.List)).Methods("GET")
+	r.Handle("/api/r/{NAME}", optional(communityHandler.Get)).Methods("GET")
+	r.Handle("/api/r/{NAME}", required(communityHandler.Create)).Methods("POST")
+	r.Handle("/api/r/{NAME}", required(communityHandler.Update)).Methods("PUT")
+	r.Handle("/api/r/{NAME}", required(communityHandler.Delete)).Methods("DELETE")
+	r.Handle("/api/r/{NAME}/moderators", required(communityHandler.InviteModerator)).Methods("POST")
+	r.Handle("/api/r/{NAME}/moderators/accept", required(communityHandler.AcceptModerator)).Methods("POST")
+	r.Handle("/api/r/{NAME}/moderators/{USERNAME}", required(communityHandler.RemoveModerator)).Methods("DELETE")
+	r.Handle("/api/r/{NAME}/members", required(communityHandler.ApproveMember)).Methods("POST")
+	r.Handle("/api/r/{NAME}/members/{USERNAME}", required(communityHandler.RemoveMember)).Methods("DELETE")
+	r.Handle("/api/r/{NAME}/bans", required(communityHandler.ListBans)).Methods("GET")
+	r.Handle("/api/r/{NAME}/bans", required(communityHandler.BanUser)).Methods("POST")
+	r.Handle("/api/r/{NAME}/bans/{USERNAME}", required(communityHandler.Unban)).Methods("DELETE")
+	r.Handle("/api/r/{NAME}/subscribe", required(communityHandler.Subscribe)).Methods("POST")
+	r.Handle("/api/r/{NAME}/unsubscribe", required(communityHandler.Unsubscribe)).Methods("POST")
+	r.Handle("/api/me/subscriptions", required(communityHandler.Subscriptions)).Methods("GET")
 
-	r.HandleFunc("/api/user/{USER_LOGIN}", postsHandler.GetPostsUser).Methods("GET")
+	r.Handle("/api/user/{USER_LOGIN}", optional(postsHandler.GetPostsUser)).Methods("GET")
 
 	// MiddleWares
 	muxMW := middleware.AccessLog(logger, r)
 	muxMW = middleware.Panic(muxMW)
 
 	addr := ":8032"
-	logger.Infof("Starting server on %s", addr)
-	logger.Fatal(http.ListenAndServe(addr, muxMW))
+	srv := &http.Server{Addr: addr, Handler: muxMW}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go sweepBans(ctx, storage.communities, *banSweep, logger)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Errorw("shutting down server", "error", err)
+		}
+	}()
 
+	logger.Infof("Starting server on %s", addr)
+	if err = srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Errorw("server stopped", "error", err)
+	}
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"redditclone/pkg/migrations"
+)
+
+const migrateUsage = `usage: redditclone migrate [flags] up|down|version
+
+  up       apply every pending migration
+  down     roll back the latest -steps migrations
+  version  print the current schema version
+
+flags:
+`
+
+// runMigrate implements the "migrate" subcommand.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	driver := fs.String("db-driver", defaultDBDriver, "database/sql driver name")
+	dsn := fs.String("db-dsn", defaultDBDSN, "database connection string")
+	steps := fs.Int("steps", 1, "number of migrations to roll back with down")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), migrateUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one command")
+	}
+
+	db, err := openSQL(*driver, *dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	runner := migrations.NewRunner(db.DB, db.Rebind)
+
+	switch fs.Arg(0) {
+	case "up":
+		n, err := runner.Up()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migration(s)\n", n)
+	case "down":
+		n, err := runner.Down(*steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rolled back %d migration(s)\n", n)
+	case "version":
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown command %q", fs.Arg(0))
+	}
+
+	version, err := runner.Version()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version: %d\n", version)
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"go.uber.org/zap"
+	"redditclone/pkg/repository"
+	"strings"
+)
+
+// grantRoles gives role to every user of the comma separated list. Users
+// that have not registered yet are skipped with a warning.
+func grantRoles(users repository.UserStore, role, list string, logger *zap.SugaredLogger) {
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		err := users.SetRole(name, role)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			logger.Warnw("cannot grant role to unknown user", "user", name, "role", role)
+			continue
+		}
+		if err != nil {
+			logger.Errorw("granting role", "user", name, "role", role, "error", err)
+			continue
+		}
+		logger.Infow("role granted", "user", name, "role", role)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"redditclone/pkg/models"
+	"strings"
+)
+
+// parseCommentSorts checks the default comment sort and parses the
+// category=sort list of per category defaults.
+func parseCommentSorts(def, list string) (map[string]string, error) {
+	if !models.ValidCommentSort(def) {
+		return nil, fmt.Errorf("unknown comment sort %q", def)
+	}
+	sorts := make(map[string]string)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		category, mode, ok := strings.Cut(item, "=")
+		if !ok || category == "" {
+			return nil, fmt.Errorf("bad category comment sort %q, want category=sort", item)
+		}
+		if !models.ValidCommentSort(mode) {
+			return nil, fmt.Errorf("unknown comment sort %q for category %s", mode, category)
+		}
+		sorts[category] = mode
+	}
+	return sorts, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"redditclone/pkg/migrations"
+	"redditclone/pkg/repository"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type storageConfig struct {
+	backend  string
+	dataDir  string
+	dbDriver string
+	dbDSN    string
+}
+
+type stores struct {
+	users         repository.UserStore
+	sessions      repository.SessionStore
+	refreshTokens repository.RefreshTokenStore
+	posts         repository.PostStore
+	communities   repository.CommunityStore
+	closers       []io.Closer
+}
+
+func openStores(cfg storageConfig, logger *zap.SugaredLogger) (*stores, error) {
+	s := &stores{}
+	switch cfg.backend {
+	case "memory":
+		s.users = repository.NewInMemoryUserRepo()
+		s.sessions = repository.NewInMemorySessionRepo()
+		s.refreshTokens = repository.NewInMemoryRefreshTokenRepo()
+		s.posts = repository.NewInMemoryPostRepo()
+		s.communities = repository.NewInMemoryCommunityRepo()
+	case "file":
+		users, err := repository.NewFileUserRepo(cfg.dataDir)
+		if err != nil {
+			return nil, fmt.Errorf("opening user storage: %w", err)
+		}
+		s.closers = append(s.closers, users)
+		posts, err := repository.NewFilePostRepo(cfg.dataDir)
+		if err != nil {
+			s.close(logger)
+			return nil, fmt.Errorf("opening post storage: %w", err)
+		}
+		s.closers = append(s.closers, posts)
+		sessions, err := repository.NewFileSessionRepo(cfg.dataDir)
+		if err != nil {
+			s.close(logger)
+			return nil, fmt.Errorf("opening session storage: %w", err)
+		}
+		s.closers = append(s.closers, sessions)
+		tokens, err := repository.NewFileRefreshTokenRepo(cfg.dataDir)
+		if err != nil {
+			s.close(logger)
+			return nil, fmt.Errorf("opening refresh token storage: %w", err)
+		}
+		s.closers = append(s.closers, tokens)
+		communities, err := repository.NewFileCommunityRepo(cfg.dataDir)
+		if err != nil {
+			s.close(logger)
+			return nil, fmt.Errorf("opening community storage: %w", err)
+		}
+		s.closers = append(s.closers, communities)
+		s.users, s.sessions, s.refreshTokens, s.posts = users, sessions, tokens, posts
+		s.communities = communities
+	case "sql":
+		db, err := openSQL(cfg.dbDriver, cfg.dbDSN)
+		if err != nil {
+			return nil, err
+		}
+		s.closers = append(s.closers, db)
+		applied, err := migrations.NewRunner(db.DB, db.Rebind).Up()
+		if err != nil {
+			s.close(logger)
+			return nil, fmt.Errorf("migrating database: %w", err)
+		}
+		logger.Infow("database migrated", "applied", applied)
+		s.users = repository.NewSQLUserRepo(db)
+		s.sessions = repository.NewSQLSessionRepo(db)
+		s.refreshTokens = repository.NewSQLRefreshTokenRepo(db)
+		s.posts = repository.NewSQLPostRepo(db)
+		s.communities = repository.NewSQLCommunityRepo(db)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.backend)
+	}
+	return s, nil
+}
+
+func (s *stores) close(logger *zap.SugaredLogger) {
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if err := s.closers[i].Close(); err != nil {
+			logger.Errorw("closing storage", "error", err)
+		}
+	}
+	s.closers = nil
+}
+
+func openSQL(driver, dsn string) (*repository.SQLDB, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	if driver == "sqlite3" {
+		// SQLite allows a single writer, serialize access instead of
+		// failing with "database is locked".
+		db.SetMaxOpenConns(1)
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+	return repository.NewSQLDB(db, driver), nil
+}
@@ -0,0 +1,19 @@
+package auth
+
+import (
+	"context"
+	"redditclone/pkg/models"
+)
+
+type sessionKey struct{}
+
+// WithSession returns a copy of ctx carrying the session of the caller.
+func WithSession(ctx context.Context, session *models.Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+// SessionFromContext returns the session stored by WithSession.
+func SessionFromContext(ctx context.Context) (*models.Session, bool) {
+	session, ok := ctx.Value(sessionKey{}).(*models.Session)
+	return session, ok && session != nil
+}
@@ -3,56 +3,78 @@ package auth
 import (
 	"fmt"
 	jwt "github.com/dgrijalva/jwt-go"
-	"log"
 	"redditclone/pkg/models"
 	"time"
 )
 
-var jwtKey = []byte("secret")
+// AccessTokenTTL is the lifetime of tokens made by GenerateToken. Clients
+// renew them with a refresh token.
+var AccessTokenTTL = 15 * time.Minute
+
+// SessionChecker looks up the live session a token was issued for.
+// repository.SessionStore satisfies it.
+type SessionChecker interface {
+	Touch(sessionID string) (*models.Session, error)
+}
 
 type Claims struct {
-	UserID   string `json:"id"`
-	Username string `json:"username"`
+	User      models.Author `json:"user"`
+	SessionID string        `json:"sid"`
 	jwt.StandardClaims
 }
 
-func GenerateToken(userID, username string) (string, error) {
-	exp := time.Now().Add(time.Hour * 72).Unix()
+func GenerateToken(session *models.Session) (string, error) {
+	exp := time.Now().Add(AccessTokenTTL).Unix()
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
+		User:      *session.Author(),
+		SessionID: session.ID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: exp,
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	keyring := CurrentKeyring()
+	if keyring == nil {
+		return "", errNoActiveKey
+	}
+	key := keyring.Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.sign)
 }
 
-func ParseToken(inToken string) (*models.Session, error) {
-	hashSecretGetter := func(token *jwt.Token) (interface{}, error) {
-		method, ok := token.Method.(*jwt.SigningMethodHMAC)
-		if !ok || method.Alg() != "HS256" {
+// ParseToken validates the token and returns the session it was issued for.
+// Tokens of revoked (deleted) sessions are rejected.
+func ParseToken(inToken string, sessions SessionChecker) (*models.Session, error) {
+	keyring := CurrentKeyring()
+	if keyring == nil {
+		return nil, errNoActiveKey
+	}
+	keyGetter := func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keyring.Lookup(kid)
+		if !ok {
+			return nil, errUnknownKey
+		}
+		// The algorithm is pinned by the key, never taken from the token.
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("bad sign method")
 		}
-		return jwtKey, nil
+		return key.verify, nil
 	}
-	token, err := jwt.Parse(inToken, hashSecretGetter)
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(inToken, claims, keyGetter)
 	if err != nil {
 		return nil, fmt.Errorf("invalid parse token")
 	}
-	fmt.Printf("\t\tpayload: %+v\n", token)
-	log.Printf("\t\tpayload: %+v\n", token)
-
-	payload, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
+	if !token.Valid || claims.User.ID == "" || claims.SessionID == "" {
 		return nil, fmt.Errorf("invalid claims token")
 	}
-	fmt.Printf("\t\tpayload: %+v\n", payload)
-	log.Printf("\t\tpayload: %+v\n", payload)
-	session := &models.Session{
-		ID:       payload["id"].(string),
-		Username: payload["username"].(string),
+	session, err := sessions.Touch(claims.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session: %w", err)
+	}
+	if session.UserID != claims.User.ID {
+		return nil, fmt.Errorf("invalid claims token")
 	}
 	return session, nil
 }
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	jwt "github.com/dgrijalva/jwt-go"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	errUnknownKey  = errors.New("unknown signing key")
+	errNoActiveKey = errors.New("keyring has no active signing key")
+)
+
+type (
+	// Key is one JWT signing key. Keys without a private part can only
+	// verify tokens, which is how retired keys stay in the keyring while
+	// tokens signed by them expire.
+	Key struct {
+		ID     string
+		Method jwt.SigningMethod
+		// sign is []byte for HMAC, otherwise a crypto.Signer.
+		sign interface{}
+		// verify is []byte for HMAC, otherwise a public key.
+		verify interface{}
+	}
+
+	// Keyring holds every key tokens are verified with and the key new
+	// tokens are signed with.
+	Keyring struct {
+		keys   map[string]*Key
+		active string
+	}
+
+	// KeyringConfig is the on-disk description of a keyring. Relative
+	// file names are resolved against the config file directory.
+	KeyringConfig struct {
+		Active string      `json:"active"`
+		Keys   []KeyConfig `json:"keys"`
+	}
+
+	KeyConfig struct {
+		ID  string `json:"kid"`
+		Alg string `json:"alg"`
+		// SecretFile holds the shared secret of HS* keys.
+		SecretFile string `json:"secretFile,omitempty"`
+		// PrivateKeyFile is a PEM private key (PKCS#8, PKCS#1 or SEC 1).
+		PrivateKeyFile string `json:"privateKeyFile,omitempty"`
+		// PublicKeyFile is a PEM public key (PKIX), enough for keys that
+		// only verify.
+		PublicKeyFile string `json:"publicKeyFile,omitempty"`
+	}
+)
+
+var (
+	keysMu sync.RWMutex
+	keys   *Keyring
+)
+
+// UseKeyring replaces the keyring GenerateToken and ParseToken work with.
+// It is safe to call while requests are being served.
+func UseKeyring(k *Keyring) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	keys = k
+}
+
+// CurrentKeyring returns the keyring in use.
+func CurrentKeyring() *Keyring {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	return keys
+}
+
+// NewKeyring builds a keyring of keys signing with the key activeID.
+func NewKeyring(activeID string, ring ...*Key) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]*Key, len(ring)), active: activeID}
+	for _, key := range ring {
+		if _, dup := k.keys[key.ID]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		k.keys[key.ID] = key
+	}
+	active, ok := k.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active key %q: %w", activeID, errUnknownKey)
+	}
+	if active.sign == nil {
+		return nil, fmt.Errorf("active key %q has no private key", activeID)
+	}
+	return k, nil
+}
+
+// NewHMACKeyring is a keyring of a single HS256 key.
+func NewHMACKeyring(id string, secret []byte) (*Keyring, error) {
+	key, err := NewKey(id, jwt.SigningMethodHS256.Alg(), secret)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(id, key)
+}
+
+// NewRandomHMACKeyring is a keyring of a single HS256 key with a random
+// secret. Tokens signed with it don't survive a restart.
+func NewRandomHMACKeyring() (*Keyring, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return NewHMACKeyring("ephemeral", secret)
+}
+
+// NewKey makes a key for alg. material is the HMAC secret ([]byte), a
+// private key (crypto.Signer) or a public key for verify-only keys.
+func NewKey(id, alg string, material interface{}) (*Key, error) {
+	if id == "" {
+		return nil, errors.New("key id is empty")
+	}
+	method := jwt.GetSigningMethod(alg)
+	if method == nil || alg == "none" {
+		return nil, fmt.Errorf("key %q: unsupported algorithm %q", id, alg)
+	}
+	key := &Key{ID: id, Method: method}
+
+	if secret, ok := material.([]byte); ok {
+		if !strings.HasPrefix(alg, "HS") {
+			return nil, fmt.Errorf("key %q: %s needs an asymmetric key", id, alg)
+		}
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("key %q: empty secret", id)
+		}
+		key.sign, key.verify = secret, secret
+		return key, nil
+	}
+
+	if signer, ok := material.(crypto.Signer); ok {
+		key.sign = signer
+		material = signer.Public()
+	}
+	var fits bool
+	switch pub := material.(type) {
+	case *rsa.PublicKey:
+		fits = strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		ec, ok := method.(*jwt.SigningMethodECDSA)
+		fits = ok && pub.Curve.Params().BitSize == ec.CurveBits
+	case ed25519.PublicKey:
+		fits = alg == SigningMethodEdDSA.Alg()
+	}
+	if !fits {
+		return nil, fmt.Errorf("key %q: key type %T doesn't fit %s", id, material, alg)
+	}
+	key.verify = material
+	return key, nil
+}
+
+// LoadKeyring reads a KeyringConfig file and the key files it references.
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg KeyringConfig
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	resolve := func(name string) string {
+		if filepath.IsAbs(name) {
+			return name
+		}
+		return filepath.Join(dir, name)
+	}
+	ring := make([]*Key, 0, len(cfg.Keys))
+	for _, kc := range cfg.Keys {
+		var material interface{}
+		switch {
+		case kc.SecretFile != "":
+			secret, err := os.ReadFile(resolve(kc.SecretFile))
+			if err != nil {
+				return nil, err
+			}
+			material = []byte(strings.TrimSpace(string(secret)))
+		case kc.PrivateKeyFile != "":
+			material, err = readPEMKey(resolve(kc.PrivateKeyFile), true)
+		case kc.PublicKeyFile != "":
+			material, err = readPEMKey(resolve(kc.PublicKeyFile), false)
+		default:
+			return nil, fmt.Errorf("key %q: no key file", kc.ID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", kc.ID, err)
+		}
+		key, err := NewKey(kc.ID, kc.Alg, material)
+		if err != nil {
+			return nil, err
+		}
+		ring = append(ring, key)
+	}
+	return NewKeyring(cfg.Active, ring...)
+}
+
+func readPEMKey(path string, private bool) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	if !private {
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+}
+
+// Active returns the key new tokens are signed with.
+func (k *Keyring) Active() *Key {
+	return k.keys[k.active]
+}
+
+// Lookup finds a key by its kid.
+func (k *Keyring) Lookup(id string) (*Key, bool) {
+	key, ok := k.keys[id]
+	return key, ok
+}
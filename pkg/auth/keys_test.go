@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"redditclone/pkg/models"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+var testSession = &models.Session{ID: "alice-session", UserID: "alice-id", Username: "alice"}
+
+// liveSessions is a SessionChecker knowing only testSession.
+type liveSessions struct{}
+
+func (liveSessions) Touch(sessionID string) (*models.Session, error) {
+	if sessionID != testSession.ID {
+		return nil, errUnknownKey
+	}
+	s := *testSession
+	return &s, nil
+}
+
+type testKeys struct {
+	hs, rs, es, ed *Key
+	rsPriv         *rsa.PrivateKey
+	esPriv         *ecdsa.PrivateKey
+	edPub          ed25519.PublicKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	var k testKeys
+	var err error
+	if k.hs, err = NewKey("hs", "HS256", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if k.rsPriv, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if k.rs, err = NewKey("rs", "RS256", k.rsPriv); err != nil {
+		t.Fatal(err)
+	}
+	if k.esPriv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if k.es, err = NewKey("es", "ES256", k.esPriv); err != nil {
+		t.Fatal(err)
+	}
+	var edPriv ed25519.PrivateKey
+	if k.edPub, edPriv, err = ed25519.GenerateKey(rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if k.ed, err = NewKey("ed", "EdDSA", edPriv); err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func (k testKeys) all() []*Key {
+	return []*Key{k.hs, k.rs, k.es, k.ed}
+}
+
+// useKeyring makes a keyring signing with active current for the test.
+func useKeyring(t *testing.T, active string, ring ...*Key) {
+	t.Helper()
+	keyring, err := NewKeyring(active, ring...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := CurrentKeyring()
+	UseKeyring(keyring)
+	t.Cleanup(func() { UseKeyring(prev) })
+}
+
+// signed makes a token for testSession with the given method, kid and
+// signing key, bypassing the keyring.
+func signed(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, &Claims{
+		User:           *testSession.Author(),
+		SessionID:      testSession.ID,
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()},
+	})
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSignAndVerify(t *testing.T) {
+	keys := newTestKeys(t)
+	for _, key := range keys.all() {
+		t.Run(key.Method.Alg(), func(t *testing.T) {
+			useKeyring(t, key.ID, keys.all()...)
+			token, err := GenerateToken(testSession)
+			if err != nil {
+				t.Fatalf("GenerateToken: %v", err)
+			}
+			session, err := ParseToken(token, liveSessions{})
+			if err != nil {
+				t.Fatalf("ParseToken: %v", err)
+			}
+			if session.ID != testSession.ID || session.UserID != testSession.UserID {
+				t.Fatalf("ParseToken: session = %+v", session)
+			}
+		})
+	}
+}
+
+func TestParseTokenRejects(t *testing.T) {
+	keys := newTestKeys(t)
+	useKeyring(t, "hs", keys.all()...)
+	rsPub := keys.rsPriv.Public().(*rsa.PublicKey)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		// The key's secret would verify it, only the algorithm differs.
+		{"HS512 with an HS256 key", signed(t, jwt.SigningMethodHS512, "hs", []byte("secret"))},
+		// The classic confusion: the public key used as an HMAC secret.
+		{"HS256 with an RS256 key", signed(t, jwt.SigningMethodHS256, "rs", rsPub.N.Bytes())},
+		{"PS256 with an RS256 key", signed(t, jwt.SigningMethodPS256, "rs", keys.rsPriv)},
+		{"ES384 with an ES256 key", signed(t, jwt.SigningMethodES384, "es", mustECKey(t, elliptic.P384()))},
+		{"none", signed(t, jwt.SigningMethodNone, "hs", jwt.UnsafeAllowNoneSignatureType)},
+		{"unknown kid", signed(t, jwt.SigningMethodHS256, "retired", []byte("secret"))},
+		{"no kid", signed(t, jwt.SigningMethodHS256, "", []byte("secret"))},
+		{"wrong secret", signed(t, jwt.SigningMethodHS256, "hs", []byte("guess"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if session, err := ParseToken(tt.token, liveSessions{}); err == nil {
+				t.Fatalf("ParseToken accepted the token: %+v", session)
+			}
+		})
+	}
+}
+
+func mustECKey(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVerifyOnlyKey(t *testing.T) {
+	keys := newTestKeys(t)
+	retired, err := NewKey("retired", "RS256", keys.rsPriv.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewKeyring("retired", keys.hs, retired); err == nil {
+		t.Fatal("NewKeyring accepted a verify-only key as the active one")
+	}
+
+	// It still verifies tokens signed before it was retired.
+	useKeyring(t, "hs", keys.hs, retired)
+	token := signed(t, jwt.SigningMethodRS256, "retired", keys.rsPriv)
+	if _, err = ParseToken(token, liveSessions{}); err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+}
+
+func TestNewKeyRejectsMismatchedMaterial(t *testing.T) {
+	keys := newTestKeys(t)
+	tests := []struct {
+		name     string
+		alg      string
+		material interface{}
+	}{
+		{"secret for RS256", "RS256", []byte("secret")},
+		{"RSA key for HS256", "HS256", keys.rsPriv},
+		{"P-256 key for ES384", "ES384", keys.esPriv},
+		{"Ed25519 key for ES256", "ES256", keys.edPub},
+		{"empty secret", "HS256", []byte{}},
+		{"none", "none", []byte("secret")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKey("k", tt.alg, tt.material); err == nil {
+				t.Fatal("NewKey accepted the key")
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+	keyring, err := NewKeyring("hs", keys.all()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := keyring.JWKS()
+
+	dec := func(s string) []byte {
+		data, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("decoding %q: %v", s, err)
+		}
+		return data
+	}
+	// Sorted by kid, the HMAC key is left out.
+	if len(set.Keys) != 3 || set.Keys[0].Kid != "ed" || set.Keys[1].Kid != "es" || set.Keys[2].Kid != "rs" {
+		t.Fatalf("JWKS = %+v, want ed, es and rs", set.Keys)
+	}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "sig" {
+			t.Errorf("%s: use = %q", jwk.Kid, jwk.Use)
+		}
+	}
+
+	ed := set.Keys[0]
+	if ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != "EdDSA" || string(dec(ed.X)) != string(keys.edPub) {
+		t.Errorf("Ed25519 JWK = %+v", ed)
+	}
+
+	es := set.Keys[1]
+	if es.Kty != "EC" || es.Crv != "P-256" || es.Alg != "ES256" ||
+		new(big.Int).SetBytes(dec(es.X)).Cmp(keys.esPriv.X) != 0 ||
+		new(big.Int).SetBytes(dec(es.Y)).Cmp(keys.esPriv.Y) != 0 ||
+		len(dec(es.X)) != 32 || len(dec(es.Y)) != 32 {
+		t.Errorf("EC JWK = %+v", es)
+	}
+
+	rs := set.Keys[2]
+	if rs.Kty != "RSA" || rs.Alg != "RS256" ||
+		new(big.Int).SetBytes(dec(rs.N)).Cmp(keys.rsPriv.N) != 0 ||
+		new(big.Int).SetBytes(dec(rs.E)).Int64() != int64(keys.rsPriv.E) {
+		t.Errorf("RSA JWK = %+v", rs)
+	}
+}
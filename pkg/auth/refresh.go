@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"redditclone/pkg/models"
+	"time"
+)
+
+// RefreshTokenTTL is the lifetime of a refresh token. Every refresh hands
+// out a new one, so an active client never has to log in again.
+var RefreshTokenTTL = 30 * 24 * time.Hour
+
+// NewRefreshToken creates an opaque refresh token for session. The
+// returned record holds only the token hash and is what gets stored.
+func NewRefreshToken(session *models.Session) (string, *models.RefreshToken, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	now := time.Now()
+	record := &models.RefreshToken{
+		Hash:      HashRefreshToken(token),
+		SessionID: session.ID,
+		UserID:    session.UserID,
+		Created:   now,
+		Expires:   now.Add(RefreshTokenTTL),
+	}
+	return token, record, nil
+}
+
+// HashRefreshToken returns the value refresh tokens are stored under.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,184 @@
+// Package diff renders line based unified diffs of short texts such as
+// post revisions.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	opKind int
+
+	op struct {
+		kind opKind
+		line string
+		// a and b are the 0-based line positions in the old and new text
+		// at this op.
+		a, b int
+	}
+)
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// Unified returns the unified diff turning a into b with context lines
+// around every change, or "" when they are equal.
+func Unified(aName, bName, a, b string, context int) string {
+	ops := lineOps(splitLines(a), splitLines(b))
+
+	var sb strings.Builder
+	for start := 0; start < len(ops); {
+		// Find the next change and grow the hunk while changes are close
+		// enough for their context to touch.
+		first := start
+		for first < len(ops) && ops[first].kind == opEqual {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind == opEqual {
+				continue
+			}
+			if i-last > 2*context {
+				break
+			}
+			last = i
+		}
+		from := max(first-context, start)
+		to := min(last+context+1, len(ops))
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+		}
+		writeHunk(&sb, ops[from:to])
+		start = to
+	}
+	return sb.String()
+}
+
+func writeHunk(sb *strings.Builder, ops []op) {
+	aStart, bStart := ops[0].a, ops[0].b
+	aLen, bLen := 0, 0
+	for _, o := range ops {
+		if o.kind != opInsert {
+			aLen++
+		}
+		if o.kind != opDelete {
+			bLen++
+		}
+	}
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+	for _, o := range ops {
+		prefix := " "
+		switch o.kind {
+		case opDelete:
+			prefix = "-"
+		case opInsert:
+			prefix = "+"
+		}
+		sb.WriteString(prefix + o.line + "\n")
+	}
+}
+
+// hunkRange formats a hunk range the way diff -u does: empty ranges point
+// at the line before them.
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+// maxTableCells bounds the LCS table. When the changed middle of the texts
+// needs a bigger one it is rendered as one replaced block instead: still a
+// correct diff, just not the shortest, and a huge post can't make a diff
+// request allocate gigabytes.
+const maxTableCells = 1 << 20
+
+// lineOps computes a shortest edit script from the longest common
+// subsequence of the lines. Common leading and trailing lines are matched
+// up front, so the table only spans the changed middle.
+func lineOps(a, b []string) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]op, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, op{kind: opEqual, line: a[i], a: i, b: i})
+	}
+	ops = middleOps(ops, a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix)
+	for k := suffix; k > 0; k-- {
+		i, j := len(a)-k, len(b)-k
+		ops = append(ops, op{kind: opEqual, line: a[i], a: i, b: j})
+	}
+	return ops
+}
+
+// middleOps appends the edit script for a and b, which start at line off
+// in both texts.
+func middleOps(ops []op, a, b []string, off int) []op {
+	if (len(a)+1)*(len(b)+1) > maxTableCells {
+		for i, line := range a {
+			ops = append(ops, op{kind: opDelete, line: line, a: off + i, b: off})
+		}
+		for j, line := range b {
+			ops = append(ops, op{kind: opInsert, line: line, a: off + len(a), b: off + j})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{kind: opEqual, line: a[i], a: off + i, b: off + j})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			ops = append(ops, op{kind: opInsert, line: b[j], a: off + i, b: off + j})
+			j++
+		default:
+			ops = append(ops, op{kind: opDelete, line: a[i], a: off + i, b: off + j})
+			i++
+		}
+	}
+	return ops
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,104 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numbered returns the lines 1..n, with the given lines replaced.
+func numbered(n int, replace map[int]string) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		line, ok := replace[i]
+		if !ok {
+			line = fmt.Sprint(i)
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "equal",
+			a:    numbered(5, nil),
+			b:    numbered(5, nil),
+			want: "",
+		},
+		{
+			name: "one change",
+			a:    numbered(10, nil),
+			b:    numbered(10, map[int]string{5: "five"}),
+			want: "--- a\n+++ b\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "close changes share a hunk",
+			a:    numbered(10, nil),
+			b:    numbered(10, map[int]string{2: "two", 8: "eight"}),
+			want: "--- a\n+++ b\n@@ -1,10 +1,10 @@\n 1\n-2\n+two\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n 9\n 10\n",
+		},
+		{
+			name: "distant changes get own hunks",
+			a:    numbered(20, nil),
+			b:    numbered(20, map[int]string{2: "two", 18: "eighteen"}),
+			want: "--- a\n+++ b\n@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n" +
+				"@@ -15,6 +15,6 @@\n 15\n 16\n 17\n-18\n+eighteen\n 19\n 20\n",
+		},
+		{
+			name: "insert into empty",
+			a:    "",
+			b:    "x\n",
+			want: "--- a\n+++ b\n@@ -0,0 +1 @@\n+x\n",
+		},
+		{
+			name: "delete everything",
+			a:    "x\ny\n",
+			b:    "",
+			want: "--- a\n+++ b\n@@ -1,2 +0,0 @@\n-x\n-y\n",
+		},
+		{
+			name: "append",
+			a:    numbered(5, nil),
+			b:    numbered(5, nil) + "6\n",
+			want: "--- a\n+++ b\n@@ -3,3 +3,4 @@\n 3\n 4\n 5\n+6\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("a", "b", tt.a, tt.b, 3); got != tt.want {
+				t.Errorf("Unified:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedHugeChange(t *testing.T) {
+	// Too big for the LCS table, the changed middle becomes one block.
+	n := 1100
+	a := numbered(n+2, nil)
+	replace := make(map[int]string, n)
+	for i := 2; i <= n+1; i++ {
+		replace[i] = fmt.Sprintf("new %d", i)
+	}
+	b := numbered(n+2, replace)
+
+	got := Unified("a", "b", a, b, 1)
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if want := fmt.Sprintf("@@ -1,%d +1,%d @@", n+2, n+2); lines[2] != want {
+		t.Fatalf("hunk header %q, want %q", lines[2], want)
+	}
+	body := lines[3:]
+	if len(body) != 2*n+2 {
+		t.Fatalf("got %d hunk lines, want %d", len(body), 2*n+2)
+	}
+	if body[0] != " 1" || body[1] != "-2" || body[n] != "-"+fmt.Sprint(n+1) ||
+		body[n+1] != "+new 2" || body[2*n] != "+new "+fmt.Sprint(n+1) || body[2*n+1] != " "+fmt.Sprint(n+2) {
+		t.Fatalf("unexpected hunk:\n%s", got)
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"redditclone/pkg/models"
+	"redditclone/pkg/repository"
+	"time"
+)
+
+// accessCheck is one of the community access methods, CanRead or CanPost.
+type accessCheck func(c *models.Community, userID string) bool
+
+// allowed reports whether the viewer passes check for the community. Site
+// moderators pass every check.
+func (h *PostHandler) allowed(community *models.Community, viewer string, check accessCheck) (bool, error) {
+	if check(community, viewer) {
+		return true, nil
+	}
+	return h.isModerator(viewer)
+}
+
+// checkAccess loads the named community and checks the viewer against it.
+// A missing community is answered with notFound, a failed check with 403
+// and denied, either way it returns false.
+func (h *PostHandler) checkAccess(w http.ResponseWriter, name, viewer string, notFound int, check accessCheck, denied string) bool {
+	community, err := h.CommunityRepo.GetByName(name)
+	if err != nil {
+		h.logger.Errorw("getting community", "error", err)
+		http.Error(w, err.Error(), communityStatus(err, notFound))
+		return false
+	}
+	ok, err := h.allowed(community, viewer, check)
+	if err != nil {
+		h.logger.Errorw("checking moderator role", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		http.Error(w, denied, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (h *PostHandler) canRead(w http.ResponseWriter, name, viewer string, notFound int) bool {
+	return h.checkAccess(w, name, viewer, notFound, (*models.Community).CanRead,
+		"this community is private, only its members can read it")
+}
+
+// canPost checks that the viewer may post, comment and vote in the
+// community and isn't banned from it.
+func (h *PostHandler) canPost(w http.ResponseWriter, name, viewer string, notFound int) bool {
+	return h.canContribute(w, name, viewer, notFound) && h.notBanned(w, name, viewer)
+}
+
+// canContribute checks the community visibility alone, without bans.
+func (h *PostHandler) canContribute(w http.ResponseWriter, name, viewer string, notFound int) bool {
+	return h.checkAccess(w, name, viewer, notFound, (*models.Community).CanPost,
+		"only approved members can post, comment and vote in this community")
+}
+
+// readablePost loads the post of the request and checks that the caller
+// may read its community. Otherwise it answers the request and returns
+// false.
+func (h *PostHandler) readablePost(w http.ResponseWriter, r *http.Request) (*models.Post, bool) {
+	post, err := h.PostRepo.GetByID(mux.Vars(r)["POST_ID"])
+	if err != nil {
+		h.logger.Errorw("getting post by ID", "error", err)
+		http.Error(w, err.Error(), notFoundStatus(err))
+		return nil, false
+	}
+	if !h.canRead(w, post.Category, viewerID(r), http.StatusNotFound) {
+		return nil, false
+	}
+	return post, true
+}
+
+// notBanned answers 403 with the ban reason and returns false while the
+// user is banned from the community. Expired bans the sweeper hasn't
+// removed yet don't count.
+func (h *PostHandler) notBanned(w http.ResponseWriter, name, userID string) bool {
+	ban, err := h.CommunityRepo.GetBan(name, userID)
+	if errors.Is(err, repository.ErrBanNotFound) {
+		return true
+	}
+	if err != nil {
+		h.logger.Errorw("getting ban", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !ban.Active(time.Now()) {
+		return true
+	}
+
+	until := "permanently"
+	if ban.Expires != nil {
+		until = "until " + ban.Expires.Format(time.RFC3339)
+	}
+	http.Error(w, fmt.Sprintf("you are banned from r/%s %s: %s", name, until, ban.Reason), http.StatusForbidden)
+	return false
+}
+
+// readable drops the posts of private communities the viewer isn't a
+// member of, keeping the order of the rest.
+func (h *PostHandler) readable(posts []*models.Post, viewer string) ([]*models.Post, error) {
+	communities, err := h.CommunityRepo.List()
+	if err != nil {
+		return nil, err
+	}
+	hidden := make(map[string]bool)
+	for _, c := range communities {
+		if !c.CanRead(viewer) {
+			hidden[c.Name] = true
+		}
+	}
+	if len(hidden) == 0 {
+		return posts, nil
+	}
+	moderator, err := h.isModerator(viewer)
+	if err != nil || moderator {
+		return posts, err
+	}
+
+	res := make([]*models.Post, 0, len(posts))
+	for _, post := range posts {
+		if !hidden[post.Category] {
+			res = append(res, post)
+		}
+	}
+	return res, nil
+}
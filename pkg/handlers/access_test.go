@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"net/http"
+	"redditclone/pkg/models"
+	"strings"
+	"testing"
+)
+
+func TestVisibility(t *testing.T) {
+	type action struct {
+		name string
+		do   func(f *fixture, s *models.Session, post *models.Post) int
+	}
+	read := action{"read", func(f *fixture, s *models.Session, post *models.Post) int {
+		return f.do(s, "GET", "/api/post/"+post.ID, "").Code
+	}}
+	list := action{"list", func(f *fixture, s *models.Session, post *models.Post) int {
+		return f.do(s, "GET", "/api/posts/"+post.Category, "").Code
+	}}
+	comment := action{"comment", func(f *fixture, s *models.Session, post *models.Post) int {
+		return f.do(s, "POST", "/api/post/"+post.ID, `{"comment": "hi"}`).Code
+	}}
+	vote := action{"vote", func(f *fixture, s *models.Session, post *models.Post) int {
+		return f.do(s, "GET", "/api/post/"+post.ID+"/downvote", "").Code
+	}}
+	create := action{"create", func(f *fixture, s *models.Session, post *models.Post) int {
+		return f.do(s, "POST", "/api/posts",
+			`{"category": "`+post.Category+`", "type": "text", "title": "t", "text": "x"}`).Code
+	}}
+
+	const (
+		ok      = http.StatusOK
+		created = http.StatusCreated
+		denied  = http.StatusForbidden
+		anon    = "anonymous"
+	)
+	tests := []struct {
+		visibility string
+		user       string
+		action     action
+		want       int
+	}{
+		{models.VisibilityPublic, anon, read, ok},
+		{models.VisibilityPublic, anon, list, ok},
+		{models.VisibilityPublic, "carol", read, ok},
+		{models.VisibilityPublic, "carol", comment, created},
+		{models.VisibilityPublic, "carol", vote, ok},
+		{models.VisibilityPublic, "carol", create, created},
+
+		{models.VisibilityRestricted, anon, read, ok},
+		{models.VisibilityRestricted, anon, list, ok},
+		{models.VisibilityRestricted, "carol", read, ok},
+		{models.VisibilityRestricted, "carol", comment, denied},
+		{models.VisibilityRestricted, "carol", vote, denied},
+		{models.VisibilityRestricted, "carol", create, denied},
+		{models.VisibilityRestricted, "bob", comment, created},
+		{models.VisibilityRestricted, "bob", vote, ok},
+		{models.VisibilityRestricted, "bob", create, created},
+		{models.VisibilityRestricted, "mod", create, created},
+		{models.VisibilityRestricted, "sam", create, created},
+
+		{models.VisibilityPrivate, anon, read, denied},
+		{models.VisibilityPrivate, anon, list, denied},
+		{models.VisibilityPrivate, "carol", read, denied},
+		{models.VisibilityPrivate, "carol", list, denied},
+		{models.VisibilityPrivate, "carol", comment, denied},
+		{models.VisibilityPrivate, "carol", vote, denied},
+		{models.VisibilityPrivate, "carol", create, denied},
+		{models.VisibilityPrivate, "bob", read, ok},
+		{models.VisibilityPrivate, "bob", list, ok},
+		{models.VisibilityPrivate, "bob", comment, created},
+		{models.VisibilityPrivate, "bob", vote, ok},
+		{models.VisibilityPrivate, "bob", create, created},
+		// Accepted moderators count as members, invited ones don't.
+		{models.VisibilityPrivate, "mod", read, ok},
+		{models.VisibilityPrivate, "invited", read, denied},
+		// Site moderators see everything.
+		{models.VisibilityPrivate, "sam", read, ok},
+		{models.VisibilityPrivate, "sam", comment, created},
+	}
+	for _, tt := range tests {
+		t.Run(tt.visibility+"/"+tt.user+"/"+tt.action.name, func(t *testing.T) {
+			f := newFixture(t)
+			users := map[string]*models.Session{
+				anon:      nil,
+				"alice":   f.user("alice", ""),
+				"bob":     f.user("bob", ""),
+				"carol":   f.user("carol", ""),
+				"mod":     f.user("mod", ""),
+				"invited": f.user("invited", ""),
+				"sam":     f.user("sam", models.RoleModerator),
+			}
+			f.community("things", tt.visibility, users["alice"], users["bob"])
+			f.moderator("things", users["mod"], models.PermRemovePosts)
+			f.invite("things", users["invited"], models.PermRemovePosts)
+			post := f.post("things", users["alice"])
+
+			if got := tt.action.do(f, users[tt.user], post); got != tt.want {
+				t.Fatalf("status %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingCommunity(t *testing.T) {
+	f := newFixture(t)
+	alice := f.user("alice", "")
+	expect(t, f.do(alice, "POST", "/api/posts", `{"category": "nowhere", "type": "text", "title": "t", "text": "x"}`),
+		http.StatusBadRequest)
+	expect(t, f.do(nil, "GET", "/api/posts/nowhere", ""), http.StatusNotFound)
+}
+
+func TestDeleteCommentNeedsReadAccess(t *testing.T) {
+	f := newFixture(t)
+	alice, bob := f.user("alice", ""), f.user("bob", "")
+	f.community("closed", models.VisibilityPrivate, alice, bob)
+	post := f.post("closed", alice)
+	comment := f.comment(post, bob)
+	if _, err := f.communities.RemoveMember("closed", bob.UserID); err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, f.do(bob, "DELETE", "/api/post/"+post.ID+"/"+comment, ""), http.StatusForbidden)
+	if got, err := f.posts.GetByID(post.ID); err != nil || len(got.Comments) != 1 {
+		t.Fatalf("comment gone after a denied delete: %v", err)
+	}
+}
+
+func TestListingsHidePrivatePosts(t *testing.T) {
+	f := newFixture(t)
+	alice, bob, sam := f.user("alice", ""), f.user("bob", ""), f.user("sam", models.RoleModerator)
+	carol := f.user("carol", "")
+	f.community("open", models.VisibilityPublic)
+	f.community("closed", models.VisibilityPrivate, alice, bob)
+	open, closed := f.post("open", alice), f.post("closed", alice)
+	for _, s := range []*models.Session{bob, carol} {
+		if err := f.communities.Subscribe("open", s.UserID); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.communities.Subscribe("closed", s.UserID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths := []string{"/api/posts/", "/api/user/alice", "/api/feed"}
+	tests := []struct {
+		name    string
+		session *models.Session
+		want    []string
+	}{
+		{"anonymous", nil, []string{open.ID}},
+		{"outsider", carol, []string{open.ID}},
+		{"member", bob, []string{open.ID, closed.ID}},
+		{"site moderator", sam, []string{open.ID, closed.ID}},
+	}
+	for _, tt := range tests {
+		for _, path := range paths {
+			t.Run(tt.name+path, func(t *testing.T) {
+				var posts []*models.Post
+				decode(t, f.do(tt.session, "GET", path+"?sort=new", ""), &posts)
+				if len(posts) != len(tt.want) {
+					t.Fatalf("got %d posts, want %d", len(posts), len(tt.want))
+				}
+				// Newest first.
+				for i, id := range tt.want {
+					if posts[len(posts)-1-i].ID != id {
+						t.Fatalf("post %d is %s, want %s", i, posts[len(posts)-1-i].ID, id)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCommunityMembersHidden(t *testing.T) {
+	f := newFixture(t)
+	bob, carol, mod := f.user("bob", ""), f.user("carol", ""), f.user("mod", "")
+	sam, dave := f.user("sam", models.RoleModerator), f.user("dave", "")
+	f.community("closed", models.VisibilityPrivate, bob)
+	f.moderator("closed", mod, models.ModeratorPermissions...)
+	f.invite("closed", carol, models.PermRemovePosts)
+	f.invite("closed", dave, models.PermRemovePosts)
+
+	tests := []struct {
+		name       string
+		session    *models.Session
+		members    int
+		moderators []string
+	}{
+		{"anonymous", nil, 0, []string{"mod"}},
+		// Invited users see their own invite, not the others.
+		{"invited", carol, 0, []string{"mod", "carol"}},
+		{"member", bob, 1, []string{"mod", "carol", "dave"}},
+		{"moderator", mod, 1, []string{"mod", "carol", "dave"}},
+		{"site moderator", sam, 1, []string{"mod", "carol", "dave"}},
+	}
+	check := func(t *testing.T, c *models.Community, members int, moderators []string) {
+		t.Helper()
+		if len(c.Members) != members {
+			t.Errorf("members = %+v, want %d", c.Members, members)
+		}
+		var got []string
+		for _, m := range c.Moderators {
+			got = append(got, m.Username)
+		}
+		if strings.Join(got, ",") != strings.Join(moderators, ",") {
+			t.Errorf("moderators = %v, want %v", got, moderators)
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var community models.Community
+			decode(t, f.do(tt.session, "GET", "/api/r/closed", ""), &community)
+			check(t, &community, tt.members, tt.moderators)
+
+			var communities []*models.Community
+			decode(t, f.do(tt.session, "GET", "/api/r", ""), &communities)
+			if len(communities) != 1 {
+				t.Fatalf("listed %d communities, want 1", len(communities))
+			}
+			check(t, communities[0], tt.members, tt.moderators)
+		})
+	}
+
+	t.Run("leaving member", func(t *testing.T) {
+		var community models.Community
+		decode(t, f.do(bob, "DELETE", "/api/r/closed/members/bob", ""), &community)
+		check(t, &community, 0, []string{"mod"})
+	})
+}
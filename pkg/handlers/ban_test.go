@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"redditclone/pkg/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBans(t *testing.T) {
+	type act func(f *fixture, s *models.Session, post *models.Post, comment string) *httptest.ResponseRecorder
+	actions := []struct {
+		name string
+		// ok is the status of the action when allowed.
+		ok int
+		do act
+	}{
+		{"create", http.StatusCreated, func(f *fixture, s *models.Session, _ *models.Post, _ string) *httptest.ResponseRecorder {
+			return f.do(s, "POST", "/api/posts", `{"category": "music", "type": "text", "title": "t", "text": "x"}`)
+		}},
+		{"comment", http.StatusCreated, func(f *fixture, s *models.Session, post *models.Post, _ string) *httptest.ResponseRecorder {
+			return f.do(s, "POST", "/api/post/"+post.ID, `{"comment": "hi"}`)
+		}},
+		{"reply", http.StatusCreated, func(f *fixture, s *models.Session, post *models.Post, comment string) *httptest.ResponseRecorder {
+			return f.do(s, "POST", "/api/post/"+post.ID+"/"+comment+"/reply", `{"comment": "hi"}`)
+		}},
+		{"vote", http.StatusOK, func(f *fixture, s *models.Session, post *models.Post, _ string) *httptest.ResponseRecorder {
+			return f.do(s, "GET", "/api/post/"+post.ID+"/upvote", "")
+		}},
+		{"vote comment", http.StatusOK, func(f *fixture, s *models.Session, post *models.Post, comment string) *httptest.ResponseRecorder {
+			return f.do(s, "GET", "/api/post/"+post.ID+"/"+comment+"/upvote", "")
+		}},
+		{"edit", http.StatusOK, func(f *fixture, s *models.Session, _ *models.Post, _ string) *httptest.ResponseRecorder {
+			own := f.post("music", s)
+			return f.do(s, "PUT", "/api/post/"+own.ID, `{"text": "edited"}`)
+		}},
+		// Bans only keep users from taking part, not from reading.
+		{"read", http.StatusOK, func(f *fixture, s *models.Session, post *models.Post, _ string) *httptest.ResponseRecorder {
+			return f.do(s, "GET", "/api/post/"+post.ID, "")
+		}},
+	}
+
+	tests := []struct {
+		name      string
+		community string
+		// expires is relative to now, 0 for permanent bans.
+		expires time.Duration
+		banned  bool
+	}{
+		{"permanent", "music", 0, true},
+		{"temporary", "music", time.Hour, true},
+		// Expired bans the sweeper hasn't removed yet don't count.
+		{"expired", "music", -time.Minute, false},
+		{"other community", "news", 0, false},
+	}
+	for _, tt := range tests {
+		for _, a := range actions {
+			t.Run(tt.name+"/"+a.name, func(t *testing.T) {
+				f := newFixture(t)
+				alice, bob, mod := f.user("alice", ""), f.user("bob", ""), f.user("mod", "")
+				f.community("music", models.VisibilityPublic)
+				f.community("news", models.VisibilityPublic)
+				post := f.post("music", alice)
+				comment := f.comment(post, alice)
+
+				ban := &models.Ban{
+					Community: tt.community,
+					UserID:    bob.UserID,
+					Username:  bob.Username,
+					Reason:    "spam",
+					Moderator: &models.Author{ID: mod.UserID, Username: mod.Username},
+					Created:   time.Now().Add(-2 * time.Hour),
+				}
+				if tt.expires != 0 {
+					expires := time.Now().Add(tt.expires)
+					ban.Expires = &expires
+				}
+				if err := f.communities.Ban(ban); err != nil {
+					t.Fatal(err)
+				}
+
+				want := a.ok
+				if tt.banned && a.name != "read" {
+					want = http.StatusForbidden
+				}
+				w := a.do(f, bob, post, comment)
+				expect(t, w, want)
+				if body := w.Body.String(); want == http.StatusForbidden &&
+					(!strings.Contains(body, "banned from r/music") || !strings.Contains(body, "spam")) {
+					t.Fatalf("the ban reason is missing: %s", body)
+				}
+			})
+		}
+	}
+}
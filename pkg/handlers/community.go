@@ -0,0 +1,715 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"redditclone/pkg/models"
+	"redditclone/pkg/repository"
+	"strings"
+	"time"
+)
+
+type CommunityHandler struct {
+	CommunityRepo repository.CommunityStore
+	PostRepo      repository.PostStore
+	UserRepo      repository.UserStore
+	logger        *zap.SugaredLogger
+}
+
+func NewCommunityHandler(logger *zap.SugaredLogger, communities repository.CommunityStore, posts repository.PostStore,
+	users repository.UserStore) *CommunityHandler {
+	return &CommunityHandler{
+		CommunityRepo: communities,
+		PostRepo:      posts,
+		UserRepo:      users,
+		logger:        logger,
+	}
+}
+
+type moderatorRequest struct {
+	Username string `json:"username"`
+	// Permissions defaults to all of them.
+	Permissions []string `json:"permissions"`
+}
+
+type memberRequest struct {
+	Username string `json:"username"`
+}
+
+type banRequest struct {
+	Username string `json:"username"`
+	Reason   string `json:"reason"`
+	Note     string `json:"note"`
+	// Duration is a Go duration such as "72h", empty for a permanent ban.
+	Duration string `json:"duration"`
+}
+
+// communityRequest changes the fields that are set and keeps the others.
+type communityRequest struct {
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	Rules       *[]string `json:"rules"`
+	Visibility  *string   `json:"visibility"`
+}
+
+func (req communityRequest) validate() error {
+	if req.Visibility != nil && !models.ValidVisibility(*req.Visibility) {
+		return errors.New("visibility must be public, restricted or private")
+	}
+	return nil
+}
+
+func (req communityRequest) apply(c *models.Community) {
+	if req.Title != nil {
+		c.Title = *req.Title
+	}
+	if req.Description != nil {
+		c.Description = *req.Description
+	}
+	if req.Rules != nil {
+		c.Rules = *req.Rules
+	}
+	if req.Visibility != nil {
+		c.Visibility = *req.Visibility
+	}
+}
+
+func (h *CommunityHandler) List(w http.ResponseWriter, r *http.Request) {
+	communities, err := h.CommunityRepo.List()
+	if err != nil {
+		h.logger.Errorw("listing communities", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err = h.present(viewerID(r), communities...); err != nil {
+		h.logger.Errorw("checking moderator role", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(communities)
+	if err != nil {
+		h.logger.Errorw("encoding communities", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Create sets up the community named in the path, the caller becomes its
+// creator and full moderator. The title defaults to the name.
+func (h *CommunityHandler) Create(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	name := mux.Vars(r)["NAME"]
+	if !models.ValidCommunityName(name) {
+		http.Error(w, "community names are 3 to 21 letters, digits or underscores", http.StatusBadRequest)
+		return
+	}
+	var req communityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Errorw("error while decoding community request", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	community := &models.Community{
+		Name:    name,
+		Title:   name,
+		Creator: session.Author(),
+		Created: now,
+		Rules:   make([]string, 0),
+		Moderators: []*models.Moderator{{
+			UserID:      session.UserID,
+			Username:    session.Username,
+			Permissions: models.ModeratorPermissions,
+			Invited:     now,
+			Accepted:    &now,
+		}},
+		Visibility: models.VisibilityPublic,
+		Members:    make([]*models.Member, 0),
+	}
+	req.apply(community)
+
+	err := h.CommunityRepo.Create(community)
+	if errors.Is(err, repository.ErrCommunityExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("creating community", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(community)
+	if err != nil {
+		h.logger.Errorw("encoding new community", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *CommunityHandler) Get(w http.ResponseWriter, r *http.Request) {
+	community, err := h.CommunityRepo.GetByName(mux.Vars(r)["NAME"])
+	if err != nil {
+		h.logger.Errorw("getting community", "error", err)
+		http.Error(w, err.Error(), communityStatus(err, http.StatusNotFound))
+		return
+	}
+	if err = h.present(viewerID(r), community); err != nil {
+		h.logger.Errorw("checking moderator role", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(community)
+	if err != nil {
+		h.logger.Errorw("encoding community", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Update changes the title, description, rules or visibility. Moderators
+// allowed to edit the rules and admins may.
+func (h *CommunityHandler) Update(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	community, ok := h.authorize(w, session, mux.Vars(r)["NAME"], func(c *models.Community) bool {
+		return c.Can(session.UserID, models.PermEditRules)
+	})
+	if !ok {
+		return
+	}
+	var req communityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Errorw("error while decoding community request", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.apply(community)
+
+	community, err := h.CommunityRepo.Update(community)
+	if err != nil {
+		h.logger.Errorw("updating community", "error", err)
+		http.Error(w, err.Error(), communityStatus(err, http.StatusNotFound))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(community)
+	if err != nil {
+		h.logger.Errorw("encoding community", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Delete removes a community without posts. Only the creator and admins
+// may.
+func (h *CommunityHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	community, ok := h.authorize(w, session, mux.Vars(r)["NAME"], func(c *models.Community) bool {
+		return c.Creator != nil && c.Creator.ID == session.UserID
+	})
+	if !ok {
+		return
+	}
+	posts, err := h.PostRepo.GetByCategory(community.Name)
+	if err != nil {
+		h.logger.Errorw("getting posts by Category", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(posts) > 0 {
+		http.Error(w, "community still has posts", http.StatusConflict)
+		return
+	}
+	if err = h.CommunityRepo.Delete(community.Name); err != nil {
+		h.logger.Errorw("deleting community", "error", err)
+		http.Error(w, err.Error(), communityStatus(err, http.StatusNotFound))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(deleteResponse{Message: "success"})
+	if err != nil {
+		h.logger.Errorw("encoding community delete", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// InviteModerator invites a user to moderate the community with the given
+// permissions, or changes the permissions of a moderator. Full moderators
+// and admins may.
+func (h *CommunityHandler) InviteModerator(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	community, ok := h.authorize(w, session, mux.Vars(r)["NAME"], func(c *models.Community) bool {
+		return c.IsFullModerator(session.UserID)
+	})
+	if !ok {
+		return
+	}
+	var req moderatorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Errorw("error while decoding moderator request", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Permissions) == 0 {
+		req.Permissions = models.ModeratorPermissions
+	}
+	for _, perm := range req.Permissions {
+		if !models.ValidModeratorPermission(perm) {
+			http.Error(w, "unknown moderator permission "+perm, http.StatusBadRequest)
+			return
+		}
+	}
+	user, err := h.UserRepo.GetByUsername(req.Username)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("getting user by username", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	community, err = h.CommunityRepo.InviteModerator(community.Name, &models.Moderator{
+		UserID:      user.ID,
+		Username:    user.Username,
+		Permissions: req.Permissions,
+		Invited:     time.Now(),
+	})
+	h.respond(w, session.UserID, community, err, "inviting moderator")
+}
+
+// AcceptModerator accepts the caller's invite to moderate the community.
+func (h *CommunityHandler) AcceptModerator(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+	community, err := h.CommunityRepo.AcceptModerator(mux.Vars(r)["NAME"], session.UserID)
+	h.respond(w, session.UserID, community, err, "accepting moderator invite")
+}
+
+// RemoveModerator drops a moderator or an invite. Full moderators and
+// admins may, and moderators may step down themselves.
+func (h *CommunityHandler) RemoveModerator(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	community, ok := h.authorize(w, session, vars["NAME"], func(c *models.Community) bool {
+		return c.IsFullModerator(session.UserID) || session.Username == vars["USERNAME"]
+	})
+	if !ok {
+		return
+	}
+	var userID string
+	for _, m := range community.Moderators {
+		if m.Username == vars["USERNAME"] {
+			userID = m.UserID
+		}
+	}
+	if userID == "" {
+		http.Error(w, repository.ErrModeratorNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	community, err := h.CommunityRepo.RemoveModerator(community.Name, userID)
+	h.respond(w, session.UserID, community, err, "removing moderator")
+}
+
+// ApproveMember lets a user post in the restricted community, or read and
+// post in the private one. Moderators allowed to ban users and admins may.
+func (h *CommunityHandler) ApproveMember(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	community, ok := h.authorize(w, session, mux.Vars(r)["NAME"], func(c *models.Community) bool {
+		return c.Can(session.UserID, models.PermBanUsers)
+	})
+	if !ok {
+		return
+	}
+	var req memberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Errorw("error while decoding member request", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user, err := h.UserRepo.GetByUsername(req.Username)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("getting user by username", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	community, err = h.CommunityRepo.ApproveMember(community.Name, &models.Member{
+		UserID:   user.ID,
+		Username: user.Username,
+		Approved: time.Now(),
+	})
+	h.respond(w, session.UserID, community, err, "approving member")
+}
+
+// RemoveMember revokes a member's approval. Moderators allowed to ban
+// users and admins may, and members may leave themselves.
+func (h *CommunityHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	community, ok := h.authorize(w, session, vars["NAME"], func(c *models.Community) bool {
+		return c.Can(session.UserID, models.PermBanUsers) || session.Username == vars["USERNAME"]
+	})
+	if !ok {
+		return
+	}
+	var userID string
+	for _, m := range community.Members {
+		if m.Username == vars["USERNAME"] {
+			userID = m.UserID
+		}
+	}
+	if userID == "" {
+		http.Error(w, repository.ErrMemberNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	community, err := h.CommunityRepo.RemoveMember(community.Name, userID)
+	h.respond(w, session.UserID, community, err, "removing member")
+}
+
+// BanUser bans a user from posting, commenting and voting in the
+// community, temporarily or for good. Banning again replaces the ban.
+// Moderators allowed to ban users and admins may.
+func (h *CommunityHandler) BanUser(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	community, ok := h.authorize(w, session, mux.Vars(r)["NAME"], func(c *models.Community) bool {
+		return c.Can(session.UserID, models.PermBanUsers)
+	})
+	if !ok {
+		return
+	}
+	var req banRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Errorw("error while decoding ban request", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		http.Error(w, "a ban needs a reason", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	var expires *time.Time
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			http.Error(w, "duration must be a positive duration such as 72h, or empty for a permanent ban", http.StatusBadRequest)
+			return
+		}
+		until := now.Add(d)
+		expires = &until
+	}
+	user, err := h.UserRepo.GetByUsername(req.Username)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("getting user by username", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ban := &models.Ban{
+		Community: community.Name,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Reason:    req.Reason,
+		Note:      req.Note,
+		Moderator: session.Author(),
+		Created:   now,
+		Expires:   expires,
+	}
+	if err = h.CommunityRepo.Ban(ban); err != nil {
+		h.logger.Errorw("banning user", "error", err)
+		http.Error(w, err.Error(), communityStatus(err, http.StatusNotFound))
+		return
+	}
+	h.logger.Infow("user banned", "community", ban.Community, "user", ban.Username, "moderator", session.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(ban)
+	if err != nil {
+		h.logger.Errorw("encoding ban", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ListBans lists the bans of the community with their moderator notes.
+// Moderators allowed to ban users and admins may.
+func (h *CommunityHandler) ListBans(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	community, ok := h.authorize(w, session, mux.Vars(r)["NAME"], func(c *models.Community) bool {
+		return c.Can(session.UserID, models.PermBanUsers)
+	})
+	if !ok {
+		return
+	}
+	bans, err := h.CommunityRepo.Bans(community.Name)
+	if err != nil {
+		h.logger.Errorw("listing bans", "error", err)
+		http.Error(w, err.Error(), communityStatus(err, http.StatusNotFound))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(bans)
+	if err != nil {
+		h.logger.Errorw("encoding bans", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Unban lifts a ban early. Moderators allowed to ban users and admins may.
+func (h *CommunityHandler) Unban(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	community, ok := h.authorize(w, session, vars["NAME"], func(c *models.Community) bool {
+		return c.Can(session.UserID, models.PermBanUsers)
+	})
+	if !ok {
+		return
+	}
+	user, err := h.UserRepo.GetByUsername(vars["USERNAME"])
+	if err == nil {
+		err = h.CommunityRepo.Unban(community.Name, user.ID)
+	}
+	if errors.Is(err, repository.ErrUserNotFound) {
+		err = repository.ErrBanNotFound
+	}
+	if err != nil {
+		h.logger.Errorw("unbanning user", "error", err)
+		http.Error(w, err.Error(), communityStatus(err, http.StatusNotFound))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(deleteResponse{Message: "success"})
+	if err != nil {
+		h.logger.Errorw("encoding unban", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// Subscribe adds the community to the caller's subscriptions and answers
+// with all of them.
+func (h *CommunityHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	h.subscription(w, r, h.CommunityRepo.Subscribe)
+}
+
+// Unsubscribe drops the community from the caller's subscriptions and
+// answers with the rest.
+func (h *CommunityHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	h.subscription(w, r, h.CommunityRepo.Unsubscribe)
+}
+
+func (h *CommunityHandler) subscription(w http.ResponseWriter, r *http.Request, apply func(name, userID string) error) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+	if err := apply(mux.Vars(r)["NAME"], session.UserID); err != nil {
+		h.logger.Errorw("changing subscription", "error", err)
+		http.Error(w, err.Error(), communityStatus(err, http.StatusNotFound))
+		return
+	}
+	h.writeSubscriptions(w, session.UserID)
+}
+
+// Subscriptions lists the communities the caller is subscribed to.
+func (h *CommunityHandler) Subscriptions(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+	h.writeSubscriptions(w, session.UserID)
+}
+
+func (h *CommunityHandler) writeSubscriptions(w http.ResponseWriter, userID string) {
+	communities, err := h.CommunityRepo.Subscriptions(userID)
+	if err != nil {
+		h.logger.Errorw("listing subscriptions", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err = h.present(userID, communities...); err != nil {
+		h.logger.Errorw("checking moderator role", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(communities)
+	if err != nil {
+		h.logger.Errorw("encoding subscriptions", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// present strips the members and the pending moderator invites, but the
+// viewer's own, from the communities the viewer isn't a member of. Site
+// moderators see everything. The communities must be the handler's own
+// copies.
+func (h *CommunityHandler) present(viewer string, communities ...*models.Community) error {
+	moderator, err := hasRole(h.UserRepo, viewer, (*models.User).IsModerator)
+	if err != nil || moderator {
+		return err
+	}
+	for _, c := range communities {
+		if c.IsMember(viewer) {
+			continue
+		}
+		c.Members = make([]*models.Member, 0)
+		mods := make([]*models.Moderator, 0, len(c.Moderators))
+		for _, m := range c.Moderators {
+			if m.Accepted != nil || m.UserID == viewer {
+				mods = append(mods, m)
+			}
+		}
+		c.Moderators = mods
+	}
+	return nil
+}
+
+// respond answers a community mutation with the changed community.
+func (h *CommunityHandler) respond(w http.ResponseWriter, viewer string, community *models.Community, err error, action string) {
+	if err != nil {
+		h.logger.Errorw(action, "error", err)
+		http.Error(w, err.Error(), communityStatus(err, http.StatusNotFound))
+		return
+	}
+	if err = h.present(viewer, community); err != nil {
+		h.logger.Errorw("checking moderator role", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(community)
+	if err != nil {
+		h.logger.Errorw("encoding community", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// authorize loads the community and checks that allowed holds for it or
+// that the caller is an admin. Otherwise it answers the request and returns
+// false.
+func (h *CommunityHandler) authorize(w http.ResponseWriter, session *models.Session, name string,
+	allowed func(*models.Community) bool) (*models.Community, bool) {
+	community, err := h.CommunityRepo.GetByName(name)
+	if err != nil {
+		h.logger.Errorw("getting community", "error", err)
+		http.Error(w, err.Error(), communityStatus(err, http.StatusNotFound))
+		return nil, false
+	}
+	if allowed(community) {
+		return community, true
+	}
+	admin, err := hasRole(h.UserRepo, session.UserID, (*models.User).IsAdmin)
+	if err != nil {
+		h.logger.Errorw("checking admin role", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if !admin {
+		http.Error(w, "not allowed to manage this community", http.StatusForbidden)
+		return nil, false
+	}
+	return community, true
+}
+
+// communityStatus maps a missing community to notFound, which depends on
+// whether the community was addressed or only referenced, missing
+// moderators, invites, members and bans to 404 and anything else to 500.
+func communityStatus(err error, notFound int) int {
+	switch {
+	case errors.Is(err, repository.ErrCommunityNotFound):
+		return notFound
+	case errors.Is(err, repository.ErrModeratorNotFound), errors.Is(err, repository.ErrInviteNotFound),
+		errors.Is(err, repository.ErrMemberNotFound), errors.Is(err, repository.ErrBanNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
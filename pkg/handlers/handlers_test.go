@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"redditclone/pkg/auth"
+	"redditclone/pkg/models"
+	"redditclone/pkg/repository"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// fixture serves the post and community handlers over in-memory stores.
+// Requests carry the session directly, the auth middleware is left out.
+type fixture struct {
+	t           *testing.T
+	posts       *repository.InMemoryPostRepo
+	users       *repository.InMemoryUserRepo
+	communities *repository.InMemoryCommunityRepo
+	postHandler *PostHandler
+	router      *mux.Router
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	f := &fixture{
+		t:           t,
+		posts:       repository.NewInMemoryPostRepo(),
+		users:       repository.NewInMemoryUserRepo(),
+		communities: repository.NewInMemoryCommunityRepo(),
+	}
+	logger := zap.NewNop().Sugar()
+	f.postHandler = NewPostHandler(logger, f.posts, f.users, f.communities)
+	communityHandler := NewCommunityHandler(logger, f.communities, f.posts, f.users)
+
+	// The routes of cmd/redditclone the tests go through.
+	r := mux.NewRouter()
+	r.HandleFunc("/api/posts/", f.postHandler.ListAllPosts).Methods("GET")
+	r.HandleFunc("/api/posts", f.postHandler.CreatePost).Methods("POST")
+	r.HandleFunc("/api/posts/{CATEGORY_NAME}", f.postHandler.ListCategoryPosts).Methods("GET")
+	r.HandleFunc("/api/feed", f.postHandler.Feed).Methods("GET")
+	r.HandleFunc("/api/post/{POST_ID}", f.postHandler.ListPostByID).Methods("GET")
+	r.HandleFunc("/api/post/{POST_ID}", f.postHandler.AddCommentPost).Methods("POST")
+	r.HandleFunc("/api/post/{POST_ID}", f.postHandler.DeletePostByID).Methods("DELETE")
+	r.HandleFunc("/api/post/{POST_ID}", f.postHandler.EditPost).Methods("PUT")
+	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}", f.postHandler.DeleteCommentPost).Methods("DELETE")
+	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}/history", f.postHandler.CommentHistory).Methods("GET")
+	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}/reply", f.postHandler.ReplyCommentPost).Methods("POST")
+	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}/upvote", f.postHandler.UpVoteComment).Methods("GET")
+	r.HandleFunc("/api/post/{POST_ID}/upvote", f.postHandler.UpVote).Methods("GET")
+	r.HandleFunc("/api/post/{POST_ID}/downvote", f.postHandler.DownVote).Methods("GET")
+	r.HandleFunc("/api/r", communityHandler.List).Methods("GET")
+	r.HandleFunc("/api/r/{NAME}", communityHandler.Get).Methods("GET")
+	r.HandleFunc("/api/r/{NAME}/members/{USERNAME}", communityHandler.RemoveMember).Methods("DELETE")
+	r.HandleFunc("/api/r/{NAME}/subscribe", communityHandler.Subscribe).Methods("POST")
+	r.HandleFunc("/api/me/subscriptions", communityHandler.Subscriptions).Methods("GET")
+	r.HandleFunc("/api/user/{USER_LOGIN}", f.postHandler.GetPostsUser).Methods("GET")
+	f.router = r
+	return f
+}
+
+// user registers a user with the role, "" for none, and returns a session
+// of theirs.
+func (f *fixture) user(username, role string) *models.Session {
+	f.t.Helper()
+	user, err := f.users.Create(username, "hash")
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if role != "" {
+		if err = f.users.SetRole(username, role); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+	return &models.Session{ID: username + "-session", UserID: user.ID, Username: username}
+}
+
+// community creates a community with the visibility and approves the
+// members.
+func (f *fixture) community(name, visibility string, members ...*models.Session) {
+	f.t.Helper()
+	err := f.communities.Create(&models.Community{Name: name, Title: name, Created: time.Now(), Visibility: visibility})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	for _, m := range members {
+		_, err = f.communities.ApproveMember(name, &models.Member{UserID: m.UserID, Username: m.Username, Approved: time.Now()})
+		if err != nil {
+			f.t.Fatal(err)
+		}
+	}
+}
+
+// invite invites the user to moderate the community with the permissions.
+func (f *fixture) invite(community string, s *models.Session, perms ...string) {
+	f.t.Helper()
+	_, err := f.communities.InviteModerator(community, &models.Moderator{
+		UserID:      s.UserID,
+		Username:    s.Username,
+		Permissions: perms,
+		Invited:     time.Now(),
+	})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// moderator makes the user an accepted moderator of the community.
+func (f *fixture) moderator(community string, s *models.Session, perms ...string) {
+	f.t.Helper()
+	f.invite(community, s, perms...)
+	if _, err := f.communities.AcceptModerator(community, s.UserID); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// post creates a text post straight in the store, bypassing the checks.
+func (f *fixture) post(community string, s *models.Session) *models.Post {
+	f.t.Helper()
+	post, err := f.posts.Create(repository.PostRequest{Category: community, Type: "text", Title: "title", Text: "text"}, s)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return post
+}
+
+// comment adds a comment straight in the store and returns its ID.
+func (f *fixture) comment(post *models.Post, s *models.Session) string {
+	f.t.Helper()
+	post, err := f.posts.AddCommentToPost("comment", post.ID, s)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return post.Comments[len(post.Comments)-1].ID
+}
+
+// do serves the request as the session, nil for anonymous callers.
+func (f *fixture) do(s *models.Session, method, path, body string) *httptest.ResponseRecorder {
+	f.t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if s != nil {
+		r = r.WithContext(auth.WithSession(r.Context(), s))
+	}
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, r)
+	return w
+}
+
+// expect checks the status of the response.
+func expect(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status %d, want %d: %s", w.Code, status, strings.TrimSpace(w.Body.String()))
+	}
+}
+
+// decode expects 200 and decodes the response into v.
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	expect(t, w, http.StatusOK)
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+	"redditclone/pkg/auth"
+)
+
+type KeyHandler struct {
+	logger *zap.SugaredLogger
+}
+
+func NewKeyHandler(logger *zap.SugaredLogger) *KeyHandler {
+	return &KeyHandler{
+		logger: logger,
+	}
+}
+
+// JWKS serves the public signing keys at /.well-known/jwks.json.
+func (h *KeyHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	keyring := auth.CurrentKeyring()
+	if keyring == nil {
+		http.Error(w, "no signing keys", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	err := json.NewEncoder(w).Encode(keyring.JWKS())
+	if err != nil {
+		h.logger.Errorw("encoding jwks", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"redditclone/pkg/models"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/repository"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPageLimit = 25
+	maxPageLimit     = 100
+	// unpagedLimit bounds the bare array answered without paging
+	// parameters. The frontend still asks for whole listings, so it is
+	// generous, but a big store can't be dumped in one response.
+	unpagedLimit = 500
+)
+
+type (
+	// listing is how a post listing was asked to be ordered and paged.
+	listing struct {
+		sort   string
+		t      string
+		rank   ranking.Ranker
+		window time.Duration
+		// now is the moment the posts are ranked at. Paging keeps the one
+		// of the first page, rising and the top windows shift with it.
+		now time.Time
+
+		// paged is set when any of limit, after or before was given,
+		// otherwise the first unpagedLimit posts are answered as a bare
+		// array.
+		paged  bool
+		limit  int
+		after  *cursor
+		before *cursor
+	}
+
+	// cursor points between two posts of a listing. It remembers the
+	// ordering it was made for, so it can't be replayed against another,
+	// and the moment the listing was ranked at.
+	cursor struct {
+		Sort string    `json:"s"`
+		T    string    `json:"t,omitempty"`
+		Now  time.Time `json:"n"`
+		ranking.Key
+	}
+
+	postPage struct {
+		Posts []*models.Post `json:"posts"`
+		Next  string         `json:"next,omitempty"`
+		Prev  string         `json:"prev,omitempty"`
+	}
+)
+
+// listingOrder reads ?sort=, for top the time window ?t=, and the paging
+// parameters ?limit=, ?after= and ?before=.
+func (h *PostHandler) listingOrder(r *http.Request) (listing, error) {
+	query := r.URL.Query()
+	order := listing{sort: query.Get("sort"), limit: defaultPageLimit, now: time.Now()}
+	if order.sort == "" {
+		order.sort = h.PostSort
+	}
+	rank, ok := ranking.Lookup(order.sort)
+	if !ok {
+		return listing{}, fmt.Errorf("unknown sort %q", order.sort)
+	}
+	order.rank = rank
+	if t := query.Get("t"); t != "" && order.sort == ranking.Top {
+		window, ok := ranking.Window(t)
+		if !ok {
+			return listing{}, fmt.Errorf("unknown time window %q, want hour, day, week, month, year or all", t)
+		}
+		order.t, order.window = t, window
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return listing{}, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		order.paged, order.limit = true, limit
+	}
+	after, before := query.Get("after"), query.Get("before")
+	if after != "" && before != "" {
+		return listing{}, errors.New("after and before can't be combined")
+	}
+	var err error
+	if after != "" {
+		order.paged = true
+		if order.after, err = order.decodeCursor(after); err != nil {
+			return listing{}, err
+		}
+		order.now = order.after.Now
+	}
+	if before != "" {
+		order.paged = true
+		if order.before, err = order.decodeCursor(before); err != nil {
+			return listing{}, err
+		}
+		order.now = order.before.Now
+	}
+	return order, nil
+}
+
+// head returns how many of the best scored posts answer the listing. Only
+// the first page of the all-time top listing can be answered from them,
+// one more post than the page tells whether there is a next one.
+func (l listing) head() (int, bool) {
+	if l.sort != ranking.Top || l.window != 0 || l.after != nil || l.before != nil {
+		return 0, false
+	}
+	if !l.paged {
+		return unpagedLimit, true
+	}
+	return l.limit + 1, true
+}
+
+// categoryPosts loads the posts of the category the listing needs, only
+// the head of the score order when the store keeps one.
+func (h *PostHandler) categoryPosts(category string, order listing) ([]*models.Post, error) {
+	if top, ok := h.PostRepo.(repository.TopPostStore); ok {
+		if n, ok := order.head(); ok {
+			return top.TopByCategory(category, n), nil
+		}
+	}
+	return h.PostRepo.GetByCategory(category)
+}
+
+// authorPosts loads the posts of the user the viewer may read, like
+// categoryPosts.
+func (h *PostHandler) authorPosts(userLogin, viewer string, order listing) ([]*models.Post, error) {
+	if top, ok := h.PostRepo.(repository.TopPostStore); ok {
+		if n, ok := order.head(); ok {
+			posts := top.TopByAuthor(userLogin, n)
+			if len(posts) == 0 {
+				return nil, repository.ErrPostsNotFound
+			}
+			readable, err := h.readable(posts, viewer)
+			// Hidden posts leave gaps on the page only the whole list
+			// can fill.
+			if err != nil || len(readable) == len(posts) {
+				return readable, err
+			}
+		}
+	}
+	posts, err := h.PostRepo.GetAllPostsUser(userLogin)
+	if err != nil {
+		return nil, err
+	}
+	return h.readable(posts, viewer)
+}
+
+// apply orders the posts and cuts out the requested page. It returns what
+// should be encoded, a bare array for unpaged requests, else a postPage,
+// and the posts on the page. Ranking reads the votes, so the page is only
+// presented afterwards.
+func (l listing) apply(posts []*models.Post) (interface{}, []*models.Post) {
+	posts = ranking.Within(posts, l.window, l.now)
+	keys := ranking.Sort(posts, l.rank, l.now)
+	if !l.paged {
+		posts = posts[:min(len(posts), unpagedLimit)]
+		return posts, posts
+	}
+
+	start, end := 0, len(keys)
+	switch {
+	case l.after != nil:
+		start = sort.Search(len(keys), func(i int) bool { return l.after.Key.Less(keys[i]) })
+		end = min(start+l.limit, len(keys))
+	case l.before != nil:
+		end = sort.Search(len(keys), func(i int) bool { return !keys[i].Less(l.before.Key) })
+		start = max(end-l.limit, 0)
+	default:
+		end = min(l.limit, len(keys))
+	}
+
+	page := postPage{Posts: posts[start:end]}
+	if end < len(keys) && end > start {
+		page.Next = l.encodeCursor(keys[end-1])
+	}
+	if start > 0 && end > start {
+		page.Prev = l.encodeCursor(keys[start])
+	}
+	return page, page.Posts
+}
+
+func (l listing) encodeCursor(key ranking.Key) string {
+	// A cursor only holds strings, a number and a time, marshaling it
+	// can't fail.
+	data, _ := json.Marshal(cursor{Sort: l.sort, T: l.t, Now: l.now, Key: key})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (l listing) decodeCursor(raw string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	var c cursor
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	if c.Sort != l.sort || c.T != l.t {
+		return nil, errors.New("cursor belongs to another sort order")
+	}
+	if c.Now.IsZero() {
+		return nil, errors.New("malformed cursor")
+	}
+	return &c, nil
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"redditclone/pkg/models"
+	"redditclone/pkg/ranking"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pageThrough pages the posts with limit 1 from a first page ranked at
+// then, following next cursors, and returns the post IDs in page order.
+func pageThrough(t *testing.T, h *PostHandler, query string, then time.Time, posts []*models.Post) []string {
+	t.Helper()
+	var ids []string
+	next := ""
+	for i := 0; i <= len(posts); i++ {
+		target := "/api/posts/?limit=1&" + query
+		if next != "" {
+			target += "&after=" + next
+		}
+		order, err := h.listingOrder(httptest.NewRequest("GET", target, nil))
+		if err != nil {
+			t.Fatalf("listingOrder(%s): %v", target, err)
+		}
+		if next == "" {
+			order.now = then
+		}
+		res, _ := order.apply(append([]*models.Post(nil), posts...))
+		page := res.(postPage)
+		for _, p := range page.Posts {
+			ids = append(ids, p.ID)
+		}
+		if next = page.Next; next == "" {
+			return ids
+		}
+	}
+	t.Fatalf("paging did not end, got %v", ids)
+	return nil
+}
+
+func TestListingCursorKeepsTheMoment(t *testing.T) {
+	h := NewPostHandler(nil, nil, nil, nil)
+	then := time.Now().Add(-20 * time.Hour)
+	post := func(id string, age time.Duration, score int) *models.Post {
+		return &models.Post{ID: id, Created: then.Add(-age), Score: score}
+	}
+
+	t.Run("rising", func(t *testing.T) {
+		// Ranked at then a leads b, twenty hours later b has overtaken a.
+		posts := []*models.Post{post("a", time.Hour, 10), post("b", 10*time.Hour, 40), post("c", 0, 2)}
+		rank, _ := ranking.Lookup(ranking.Rising)
+		ranked := append([]*models.Post(nil), posts...)
+		ranking.Sort(ranked, rank, time.Now())
+		if ranked[0].ID != "b" {
+			t.Fatalf("the orders at then and now don't differ, fix the test posts")
+		}
+
+		if got := strings.Join(pageThrough(t, h, "sort=rising", then, posts), " "); got != "a b c" {
+			t.Fatalf("pages = %v, want [a b c]", got)
+		}
+	})
+
+	t.Run("top of the day", func(t *testing.T) {
+		// b and x were in the day before then, but aren't any more.
+		posts := []*models.Post{post("a", time.Hour, 1), post("b", 10*time.Hour, 5), post("x", 5*time.Hour, 3),
+			post("c", 30*time.Hour, 9)}
+		if got := strings.Join(pageThrough(t, h, "sort=top&t=day", then, posts), " "); got != "b x a" {
+			t.Fatalf("pages = %v, want [b x a]", got)
+		}
+	})
+}
+
+func TestListingCursorRejects(t *testing.T) {
+	h := NewPostHandler(nil, nil, nil, nil)
+	order, err := h.listingOrder(httptest.NewRequest("GET", "/api/posts/?sort=new&limit=1", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := order.encodeCursor(ranking.Key{Score: 1, Created: time.Now(), ID: "a"})
+
+	for _, target := range []string{
+		"/api/posts/?sort=top&after=" + next,
+		"/api/posts/?sort=new&after=" + next + "&before=" + next,
+		"/api/posts/?sort=new&after=bm9wZQ",
+		// A cursor without the moment it was ranked at.
+		"/api/posts/?sort=new&after=eyJzIjoibmV3In0",
+	} {
+		if _, err := h.listingOrder(httptest.NewRequest("GET", target, nil)); err == nil {
+			t.Errorf("listingOrder(%s) accepted the cursor", target)
+		}
+	}
+	if _, err := h.listingOrder(httptest.NewRequest("GET", "/api/posts/?sort=new&after="+next, nil)); err != nil {
+		t.Errorf("listingOrder rejected its own cursor: %v", err)
+	}
+}
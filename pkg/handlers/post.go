@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
+	"io"
 	"log"
 	"net/http"
-	"redditclone/pkg/auth"
+	"redditclone/pkg/diff"
+	"redditclone/pkg/models"
+	"redditclone/pkg/ranking"
 	"redditclone/pkg/repository"
-	"strings"
+	"strconv"
+	"time"
 )
 
 type commentRequest struct {
@@ -20,31 +24,85 @@ type commentRequest struct {
 type deleteResponse struct {
 	Message string `json:"message"`
 }
+
+// postVotesResponse lists the votes on a post and, by comment ID, on its
+// comments.
+type postVotesResponse struct {
+	Votes    []*models.Vote            `json:"votes"`
+	Comments map[string][]*models.Vote `json:"comments"`
+}
+
+// postEditRequest changes the fields that are set and keeps the others.
+type postEditRequest struct {
+	Title *string `json:"title"`
+	Text  *string `json:"text"`
+}
+
+// DefaultTitleEditWindow is how long after creation a post title may still
+// be changed.
+const DefaultTitleEditWindow = 5 * time.Minute
+
 type PostHandler struct {
-	PostRepo *repository.InMemoryPostRepo
-	logger   *zap.SugaredLogger
+	PostRepo      repository.PostStore
+	UserRepo      repository.UserStore
+	CommunityRepo repository.CommunityStore
+	// PostAuthorsDeleteComments lets post authors delete any comment under
+	// their posts, not only their own.
+	PostAuthorsDeleteComments bool
+	// CommentSort orders comments when the request has no ?sort=,
+	// CategoryCommentSorts overrides it per category.
+	CommentSort          string
+	CategoryCommentSorts map[string]string
+	// TitleEditWindow is how long after creation the title may be edited.
+	TitleEditWindow time.Duration
+	// PostSort orders listings when the request has no ?sort=.
+	PostSort string
+	// HideVoters leaves out who voted how from posts and comments, only
+	// the counts and the viewer's own vote are shown. Admins see the
+	// voters through PostVotes.
+	HideVoters bool
+	logger     *zap.SugaredLogger
 }
 
-func NewPostHandler(logger *zap.SugaredLogger) *PostHandler {
+func NewPostHandler(logger *zap.SugaredLogger, posts repository.PostStore, users repository.UserStore,
+	communities repository.CommunityStore) *PostHandler {
 	return &PostHandler{
-		PostRepo: repository.NewInMemoryPostRepo(),
-		logger:   logger,
+		PostRepo:                  posts,
+		UserRepo:                  users,
+		CommunityRepo:             communities,
+		PostAuthorsDeleteComments: true,
+		CommentSort:               models.CommentSortBest,
+		TitleEditWindow:           DefaultTitleEditWindow,
+		PostSort:                  ranking.Hot,
+		HideVoters:                true,
+		logger:                    logger,
 	}
 }
 
 func (h *PostHandler) ListAllPosts(w http.ResponseWriter, r *http.Request) {
+	order, err := h.listingOrder(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	viewer := viewerID(r)
 	posts, err := h.PostRepo.ListAll()
+	if err == nil {
+		posts, err = h.readable(posts, viewer)
+	}
 	if err != nil {
 		h.logger.Errorw("error while listing posts", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	res, page := order.apply(posts)
+	h.presentAll(page, viewer)
 	h.logger.Infow("!!!Listing posts", "posts", posts)
 
 	w.Header().Set("Content-Type", "application/json")
 
 	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(posts)
+	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
 		h.logger.Errorw("error while encoding posts", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -52,7 +110,68 @@ func (h *PostHandler) ListAllPosts(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Feed lists the posts of the communities the caller is subscribed to,
+// ranked and paged like ListAllPosts. Anonymous callers and users without
+// subscriptions get the global listing.
+func (h *PostHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	order, err := h.listingOrder(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	viewer := viewerID(r)
+	posts, err := h.feedPosts(viewer)
+	if err == nil {
+		posts, err = h.readable(posts, viewer)
+	}
+	if err != nil {
+		h.logger.Errorw("listing feed posts", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res, page := order.apply(posts)
+	h.presentAll(page, viewer)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		h.logger.Errorw("encoding feed", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// feedPosts merges the posts of the viewer's subscriptions, falling back
+// to every post.
+func (h *PostHandler) feedPosts(viewer string) ([]*models.Post, error) {
+	if viewer == "" {
+		return h.PostRepo.ListAll()
+	}
+	subscribed, err := h.CommunityRepo.Subscriptions(viewer)
+	if err != nil {
+		return nil, err
+	}
+	if len(subscribed) == 0 {
+		return h.PostRepo.ListAll()
+	}
+	posts := make([]*models.Post, 0)
+	for _, c := range subscribed {
+		inCommunity, err := h.PostRepo.GetByCategory(c.Name)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, inCommunity...)
+	}
+	return posts, nil
+}
+
 func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
 	var req repository.PostRequest
 	h.logger.Infow("received register request", "r.body", r.Body)
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -62,14 +181,7 @@ func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 	}
 	h.logger.Infow("received post request", "post", req)
 
-	fmt.Printf("\n\n\t%#v\n", r.Header)
-	fmt.Printf("\t%+v\n\n", r.Header)
-
-	inToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-	session, err := auth.ParseToken(inToken)
-	if err != nil {
-		h.logger.Errorw("error while parsing token", "error", err)
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+	if !h.canPost(w, req.Category, session.UserID, http.StatusBadRequest) {
 		return
 	}
 
@@ -79,6 +191,7 @@ func (h *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.present(post, session.UserID)
 	h.logger.Infow("post created", "post", post)
 
 	w.Header().Set("Content-Type", "application/json")
@@ -96,16 +209,27 @@ func (h *PostHandler) ListCategoryPosts(w http.ResponseWriter, r *http.Request)
 	vars := mux.Vars(r)
 	postCatID := vars["CATEGORY_NAME"]
 
-	posts, err := h.PostRepo.GetByCategory(postCatID)
+	order, err := h.listingOrder(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	viewer := viewerID(r)
+	if !h.canRead(w, postCatID, viewer, http.StatusNotFound) {
+		return
+	}
+	posts, err := h.categoryPosts(postCatID, order)
 	if err != nil {
 		h.logger.Errorw("getting posts by Category", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	res, page := order.apply(posts)
+	h.presentAll(page, viewer)
 	h.logger.Infow("got posts by category", "posts", posts)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(posts)
+	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
 		h.logger.Errorw("encoding posts category", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -120,6 +244,14 @@ func (h *PostHandler) ListPostByID(w http.ResponseWriter, r *http.Request) {
 	log.Printf("mux vars: %#v", vars)
 	postID := vars["POST_ID"]
 	log.Printf("postid: %#v", postID)
+	if mode := r.URL.Query().Get("sort"); mode != "" && !models.ValidCommentSort(mode) {
+		http.Error(w, "unknown comment sort "+mode, http.StatusBadRequest)
+		return
+	}
+	// Check access before ListByID counts the view.
+	if _, ok := h.readablePost(w, r); !ok {
+		return
+	}
 	post, err := h.PostRepo.ListByID(postID)
 	if err != nil {
 		h.logger.Errorw("getting post by ID", "error", err)
@@ -130,7 +262,7 @@ func (h *PostHandler) ListPostByID(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(post)
+	err = json.NewEncoder(w).Encode(h.threaded(r, post))
 	if err != nil {
 		h.logger.Errorw("encoding to json post by ID", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -140,6 +272,11 @@ func (h *PostHandler) ListPostByID(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *PostHandler) AddCommentPost(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	log.Printf("\n\tmux vars: %#v", vars)
 	postID := vars["POST_ID"]
@@ -150,6 +287,9 @@ func (h *PostHandler) AddCommentPost(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if !h.canPost(w, post.Category, session.UserID, http.StatusNotFound) {
+		return
+	}
 
 	var req commentRequest
 	h.logger.Infow("received comment request", "r.body", r.Body)
@@ -160,7 +300,7 @@ func (h *PostHandler) AddCommentPost(w http.ResponseWriter, r *http.Request) {
 	}
 	h.logger.Infow("received comment request", "comment", req)
 
-	post, err = h.PostRepo.AddCommentToPost(req.Comment, post.ID)
+	post, err = h.PostRepo.AddCommentToPost(req.Comment, post.ID, session)
 	if err != nil {
 		h.logger.Errorw("adding comment to post", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -169,7 +309,7 @@ func (h *PostHandler) AddCommentPost(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	err = json.NewEncoder(w).Encode(post)
+	err = json.NewEncoder(w).Encode(h.threaded(r, post))
 	if err != nil {
 		h.logger.Errorw("encoding new post comment", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -178,21 +318,93 @@ func (h *PostHandler) AddCommentPost(w http.ResponseWriter, r *http.Request) {
 
 }
 
+func (h *PostHandler) ReplyCommentPost(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	postID, commentID := vars["POST_ID"], vars["COMMENT_ID"]
+	post, err := h.PostRepo.GetByID(postID)
+	if err != nil {
+		h.logger.Errorw("getting post by ID", "error", err)
+		http.Error(w, err.Error(), notFoundStatus(err))
+		return
+	}
+	if !h.canPost(w, post.Category, session.UserID, http.StatusNotFound) {
+		return
+	}
+
+	var req commentRequest
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Errorw("decoding reply request", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.logger.Infow("received reply request", "comment", req, "parent", commentID)
+
+	post, err = h.PostRepo.ReplyToComment(req.Comment, postID, commentID, session)
+	if err != nil {
+		h.logger.Errorw("replying to comment", "error", err)
+		http.Error(w, err.Error(), notFoundStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(h.threaded(r, post))
+	if err != nil {
+		h.logger.Errorw("encoding comment reply", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 func (h *PostHandler) DeleteCommentPost(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	log.Printf("mux vars: %#v", vars)
 	postID, commentID := vars["POST_ID"], vars["COMMENT_ID"]
 	log.Printf("postid: %#v, commID: %#v", postID, commentID)
 
-	post, err := h.PostRepo.DeleteComment(commentID, postID)
+	// Users who lost access to a private community can't reach their old
+	// comments there, nor read the post through the response.
+	post, ok := h.readablePost(w, r)
+	if !ok {
+		return
+	}
+	comment := findComment(post, commentID)
+	if comment == nil || comment.Deleted {
+		h.logger.Errorw("deleting comment", "error", repository.ErrCommentNotFound)
+		http.Error(w, repository.ErrCommentNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	allowed, err := h.canDeleteComment(session, post, comment)
+	if err != nil {
+		h.logger.Errorw("checking comment permissions", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		h.logger.Errorw("deleting comment", "error", errors.New("not allowed to delete comment"))
+		http.Error(w, "not allowed to delete this comment", http.StatusForbidden)
+		return
+	}
+
+	post, err = h.PostRepo.DeleteComment(commentID, postID)
 	if err != nil {
 		h.logger.Errorw("deleting comment", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), notFoundStatus(err))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(post)
+	err = json.NewEncoder(w).Encode(h.threaded(r, post))
 	if err != nil {
 		h.logger.Errorw("encoding post comment delete", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -200,7 +412,112 @@ func (h *PostHandler) DeleteCommentPost(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+func (h *PostHandler) EditCommentPost(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	postID, commentID := vars["POST_ID"], vars["COMMENT_ID"]
+
+	var req commentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Errorw("decoding comment edit request", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	post, err := h.PostRepo.GetByID(postID)
+	if err != nil {
+		h.logger.Errorw("getting post by ID", "error", err)
+		http.Error(w, err.Error(), notFoundStatus(err))
+		return
+	}
+	comment := findComment(post, commentID)
+	if comment == nil || comment.Deleted {
+		h.logger.Errorw("editing comment", "error", repository.ErrCommentNotFound)
+		http.Error(w, repository.ErrCommentNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if comment.Author == nil || comment.Author.ID != session.UserID {
+		h.logger.Errorw("editing comment", "error", errors.New("not the comment author"))
+		http.Error(w, "only the author can edit this comment", http.StatusForbidden)
+		return
+	}
+	if !h.canContribute(w, post.Category, session.UserID, http.StatusNotFound) {
+		return
+	}
+	if !h.notBanned(w, post.Category, session.UserID) {
+		return
+	}
+
+	post, err = h.PostRepo.EditComment(postID, commentID, req.Comment)
+	if err != nil {
+		h.logger.Errorw("editing comment", "error", err)
+		http.Error(w, err.Error(), notFoundStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(h.threaded(r, post))
+	if err != nil {
+		h.logger.Errorw("encoding edited comment", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// CommentHistory lists every version of a comment. Only site moderators and
+// moderators of the community allowed to remove comments may see it.
+func (h *PostHandler) CommentHistory(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	post, err := h.PostRepo.GetByID(vars["POST_ID"])
+	if err != nil {
+		h.logger.Errorw("getting post by ID", "error", err)
+		http.Error(w, err.Error(), notFoundStatus(err))
+		return
+	}
+	allowed, err := h.moderates(post.Category, session.UserID, models.PermRemoveComments)
+	if err != nil {
+		h.logger.Errorw("checking moderator role", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "only moderators can see comment history", http.StatusForbidden)
+		return
+	}
+
+	revisions, err := h.PostRepo.CommentHistory(post.ID, vars["COMMENT_ID"])
+	if err != nil {
+		h.logger.Errorw("getting comment history", "error", err)
+		http.Error(w, err.Error(), notFoundStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(revisions)
+	if err != nil {
+		h.logger.Errorw("encoding comment history", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 func (h *PostHandler) UpVote(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	log.Printf("UPVOTE mux vars: %#v", vars)
 	postID := vars["POST_ID"]
@@ -210,16 +527,17 @@ func (h *PostHandler) UpVote(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if !h.canPost(w, post.Category, session.UserID, http.StatusNotFound) {
+		return
+	}
 
-	inToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-	session, err := auth.ParseToken(inToken)
+	post, err = h.PostRepo.UpVote(post.ID, session.UserID)
 	if err != nil {
-		h.logger.Errorw("error while parsing token", "error", err)
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		h.logger.Errorw("voting post", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	h.PostRepo.UpVote(session.ID, post)
+	h.present(post, session.UserID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -232,6 +550,11 @@ func (h *PostHandler) UpVote(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *PostHandler) DownVote(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	log.Printf("DOWNVOTE mux vars: %#v", vars)
 	postID := vars["POST_ID"]
@@ -241,16 +564,17 @@ func (h *PostHandler) DownVote(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if !h.canPost(w, post.Category, session.UserID, http.StatusNotFound) {
+		return
+	}
 
-	inToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-	session, err := auth.ParseToken(inToken)
+	post, err = h.PostRepo.DownVote(post.ID, session.UserID)
 	if err != nil {
-		h.logger.Errorw("error while parsing token", "error", err)
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		h.logger.Errorw("voting post", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	h.PostRepo.DownVote(session.ID, post)
+	h.present(post, session.UserID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -263,6 +587,11 @@ func (h *PostHandler) DownVote(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *PostHandler) UnVote(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	log.Printf("UNVOTE mux vars: %#v", vars)
 	postID := vars["POST_ID"]
@@ -272,16 +601,17 @@ func (h *PostHandler) UnVote(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if !h.canPost(w, post.Category, session.UserID, http.StatusNotFound) {
+		return
+	}
 
-	inToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-	session, err := auth.ParseToken(inToken)
+	post, err = h.PostRepo.UnVote(post.ID, session.UserID)
 	if err != nil {
-		h.logger.Errorw("error while parsing token", "error", err)
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		h.logger.Errorw("voting post", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	h.PostRepo.UnVote(session.ID, post)
+	h.present(post, session.UserID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -293,32 +623,91 @@ func (h *PostHandler) UnVote(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *PostHandler) DeletePostByID(w http.ResponseWriter, r *http.Request) {
+func (h *PostHandler) UpVoteComment(w http.ResponseWriter, r *http.Request) {
+	h.voteComment(w, r, h.PostRepo.UpVoteComment)
+}
+
+func (h *PostHandler) DownVoteComment(w http.ResponseWriter, r *http.Request) {
+	h.voteComment(w, r, h.PostRepo.DownVoteComment)
+}
+
+func (h *PostHandler) UnVoteComment(w http.ResponseWriter, r *http.Request) {
+	h.voteComment(w, r, h.PostRepo.UnVoteComment)
+}
+
+func (h *PostHandler) voteComment(w http.ResponseWriter, r *http.Request, apply func(postID, commentID, userID string) (*models.Post, error)) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
-	log.Printf("DeletePost mux vars: %#v", vars)
-	postID := vars["POST_ID"]
+	postID, commentID := vars["POST_ID"], vars["COMMENT_ID"]
 	post, err := h.PostRepo.GetByID(postID)
 	if err != nil {
 		h.logger.Errorw("getting post by ID", "error", err)
+		http.Error(w, err.Error(), notFoundStatus(err))
+		return
+	}
+	if !h.canPost(w, post.Category, session.UserID, http.StatusNotFound) {
+		return
+	}
+
+	post, err = apply(postID, commentID, session.UserID)
+	if err != nil {
+		h.logger.Errorw("voting comment", "error", err)
+		http.Error(w, err.Error(), notFoundStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(h.threaded(r, post))
+	if err != nil {
+		h.logger.Errorw("encoding comment vote", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+}
+
+// DeletePostByID removes the post. Its author, moderators of its community
+// allowed to remove posts and site moderators may.
+func (h *PostHandler) DeletePostByID(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
 
-	inToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
-	session, err := auth.ParseToken(inToken)
+	vars := mux.Vars(r)
+	log.Printf("DeletePost mux vars: %#v", vars)
+	postID := vars["POST_ID"]
+	post, err := h.PostRepo.GetByID(postID)
 	if err != nil {
-		h.logger.Errorw("error while parsing token", "error", err)
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		h.logger.Errorw("getting post by ID", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if post.Author.ID != session.ID {
+	allowed := post.Author.ID == session.UserID
+	if !allowed {
+		allowed, err = h.moderates(post.Category, session.UserID, models.PermRemovePosts)
+		if err != nil {
+			h.logger.Errorw("checking moderator rights", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if !allowed {
 		h.logger.Errorw("invalid post author", "error", errors.New("invalid post author"))
-		http.Error(w, "post.Author.ID != session.ID", http.StatusUnauthorized)
+		http.Error(w, "only the author and moderators can delete the post", http.StatusForbidden)
 		return
 	}
 	fmt.Printf("\n\tREADY TO DELETE POST, postid: %s", post.ID)
-	h.PostRepo.DeletePost(post)
+	if err = h.PostRepo.DeletePost(post.ID); err != nil {
+		h.logger.Errorw("deleting post", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -331,24 +720,337 @@ func (h *PostHandler) DeletePostByID(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// EditPost changes the text of a text post and, within TitleEditWindow of
+// its creation, the title. Only the author may edit.
+func (h *PostHandler) EditPost(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req postEditRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Errorw("decoding post edit request", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	post, err := h.PostRepo.GetByID(mux.Vars(r)["POST_ID"])
+	if err != nil {
+		h.logger.Errorw("getting post by ID", "error", err)
+		http.Error(w, err.Error(), notFoundStatus(err))
+		return
+	}
+	if post.Author == nil || post.Author.ID != session.UserID {
+		h.logger.Errorw("editing post", "error", errors.New("not the post author"))
+		http.Error(w, "only the author can edit this post", http.StatusForbidden)
+		return
+	}
+	if !h.canContribute(w, post.Category, session.UserID, http.StatusNotFound) {
+		return
+	}
+	if !h.notBanned(w, post.Category, session.UserID) {
+		return
+	}
+	if post.Type != "text" {
+		http.Error(w, "only text posts can be edited", http.StatusBadRequest)
+		return
+	}
+	title, text := post.Title, post.Text
+	if req.Text != nil {
+		text = *req.Text
+	}
+	if req.Title != nil && *req.Title != post.Title {
+		if time.Since(post.Created) > h.TitleEditWindow {
+			http.Error(w, "the title can only be changed within "+h.TitleEditWindow.String()+" of posting", http.StatusForbidden)
+			return
+		}
+		title = *req.Title
+	}
+
+	post, err = h.PostRepo.EditPost(post.ID, title, text)
+	if err != nil {
+		h.logger.Errorw("editing post", "error", err)
+		http.Error(w, err.Error(), notFoundStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(h.threaded(r, post))
+	if err != nil {
+		h.logger.Errorw("encoding edited post", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *PostHandler) PostRevisions(w http.ResponseWriter, r *http.Request) {
+	post, ok := h.readablePost(w, r)
+	if !ok {
+		return
+	}
+	revisions, err := h.PostRepo.PostRevisions(post.ID)
+	if err != nil {
+		h.logger.Errorw("getting post revisions", "error", err)
+		http.Error(w, err.Error(), notFoundStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(revisions)
+	if err != nil {
+		h.logger.Errorw("encoding post revisions", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// PostVotes shows admins who voted how on the post and on its comments.
+func (h *PostHandler) PostVotes(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+	admin, err := h.isAdmin(session.UserID)
+	if err != nil {
+		h.logger.Errorw("checking admin role", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !admin {
+		http.Error(w, "only admins can see who voted", http.StatusForbidden)
+		return
+	}
+
+	post, err := h.PostRepo.GetByID(mux.Vars(r)["POST_ID"])
+	if err != nil {
+		h.logger.Errorw("getting post by ID", "error", err)
+		http.Error(w, err.Error(), notFoundStatus(err))
+		return
+	}
+	res := postVotesResponse{
+		Votes:    post.Votes.List(),
+		Comments: make(map[string][]*models.Vote),
+	}
+	for _, c := range post.Comments {
+		if len(c.Votes) > 0 {
+			res.Comments[c.ID] = c.Votes
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		h.logger.Errorw("encoding post votes", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// PostDiff answers a unified diff between the revisions ?from= and ?to=,
+// by default between the previous and the current one.
+func (h *PostHandler) PostDiff(w http.ResponseWriter, r *http.Request) {
+	post, ok := h.readablePost(w, r)
+	if !ok {
+		return
+	}
+	revisions, err := h.PostRepo.PostRevisions(post.ID)
+	if err != nil {
+		h.logger.Errorw("getting post revisions", "error", err)
+		http.Error(w, err.Error(), notFoundStatus(err))
+		return
+	}
+
+	to, err := revisionParam(r, "to", len(revisions), len(revisions))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := revisionParam(r, "from", max(to-1, 1), len(revisions))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a, b := revisions[from-1], revisions[to-1]
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, err = io.WriteString(w, diff.Unified(revisionLabel(a), revisionLabel(b), revisionText(a), revisionText(b), 3))
+	if err != nil {
+		h.logger.Errorw("writing post diff", "error", err)
+	}
+}
+
+func revisionParam(r *http.Request, name string, def, last int) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return def, nil
+	}
+	version, err := strconv.Atoi(raw)
+	if err != nil || version < 1 || version > last {
+		return 0, fmt.Errorf("%s must be a revision between 1 and %d", name, last)
+	}
+	return version, nil
+}
+
+func revisionLabel(rev *models.Revision) string {
+	return fmt.Sprintf("revision %d\t%s", rev.Version, rev.Created.Format(time.RFC3339))
+}
+
+// revisionText lays a post revision out for diffing: the title, a blank
+// line and the text.
+func revisionText(rev *models.Revision) string {
+	return rev.Title + "\n\n" + rev.Body
+}
+
 func (h *PostHandler) GetPostsUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	log.Printf("UNVOTE mux vars: %#v", vars)
 	userLogin := vars["USER_LOGIN"]
 
-	posts, err := h.PostRepo.GetAllPostsUser(userLogin)
+	order, err := h.listingOrder(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	viewer := viewerID(r)
+	posts, err := h.authorPosts(userLogin, viewer, order)
 	if err != nil {
 		h.logger.Errorw("getting all posts user", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	res, page := order.apply(posts)
+	h.presentAll(page, viewer)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(posts)
+	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
 		h.logger.Errorw("encoding posts user", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
+
+// canDeleteComment reports whether the caller may delete the comment: its
+// author, the post author when PostAuthorsDeleteComments is on, moderators
+// of the community allowed to remove comments and site moderators may.
+func (h *PostHandler) canDeleteComment(session *models.Session, post *models.Post, comment *models.Comment) (bool, error) {
+	if comment.Author != nil && comment.Author.ID == session.UserID {
+		return true, nil
+	}
+	if h.PostAuthorsDeleteComments && post.Author != nil && post.Author.ID == session.UserID {
+		return true, nil
+	}
+	return h.moderates(post.Category, session.UserID, models.PermRemoveComments)
+}
+
+// moderates reports whether the user is a site moderator or a moderator of
+// the community holding the permission.
+func (h *PostHandler) moderates(community, userID, perm string) (bool, error) {
+	c, err := h.CommunityRepo.GetByName(community)
+	if err != nil && !errors.Is(err, repository.ErrCommunityNotFound) {
+		return false, err
+	}
+	if c != nil && c.Can(userID, perm) {
+		return true, nil
+	}
+	return h.isModerator(userID)
+}
+
+// isModerator reports whether the user has a site-wide moderator role.
+func (h *PostHandler) isModerator(userID string) (bool, error) {
+	return hasRole(h.UserRepo, userID, (*models.User).IsModerator)
+}
+
+// isAdmin reports whether the user has the admin role.
+func (h *PostHandler) isAdmin(userID string) (bool, error) {
+	return hasRole(h.UserRepo, userID, (*models.User).IsAdmin)
+}
+
+func findComment(post *models.Post, commentID string) *models.Comment {
+	for _, c := range post.Comments {
+		if c.ID == commentID {
+			return c
+		}
+	}
+	return nil
+}
+
+// threaded returns a copy of the post with its comments arranged as a
+// sorted tree, prepared by present.
+func (h *PostHandler) threaded(r *http.Request, post *models.Post) *models.Post {
+	res := *post
+	res.Comments = models.CommentTree(post.Comments)
+	models.SortComments(res.Comments, h.commentSort(r, post.Category))
+	h.present(&res, viewerID(r))
+	return &res
+}
+
+// commentSort picks the comment order: ?sort= of the request, then the
+// default of the category, then the global default.
+func (h *PostHandler) commentSort(r *http.Request, category string) string {
+	if mode := r.URL.Query().Get("sort"); mode != "" {
+		return mode
+	}
+	if mode, ok := h.CategoryCommentSorts[category]; ok {
+		return mode
+	}
+	return h.CommentSort
+}
+
+// present fills in the vote counts and the viewer's own votes on the post
+// and its comments, then cuts the voter lists down to the viewer's own vote
+// when HideVoters is set. The frontend finds that vote in the list. The
+// post must be the handler's own copy.
+func (h *PostHandler) present(post *models.Post, viewer string) {
+	post.MyVote = post.Votes.Of(viewer)
+	post.Upvotes, post.Downvotes = post.Votes.Up(), post.Votes.Down()
+	markMyVotes(post.Comments, viewer)
+	if h.HideVoters {
+		post.Votes = models.NewVotes(ownVote(viewer, post.MyVote))
+		hideCommentVoters(post.Comments, viewer)
+	}
+}
+
+func (h *PostHandler) presentAll(posts []*models.Post, viewer string) {
+	for _, p := range posts {
+		h.present(p, viewer)
+	}
+}
+
+func hideCommentVoters(comments []*models.Comment, viewer string) {
+	for _, c := range comments {
+		c.Votes = ownVote(viewer, c.MyVote)
+		hideCommentVoters(c.Replies, viewer)
+	}
+}
+
+// ownVote is the voter list left when voters are hidden: the viewer's own
+// vote, if any.
+func ownVote(viewer string, vote int) []*models.Vote {
+	if viewer == "" || vote == 0 {
+		return make([]*models.Vote, 0)
+	}
+	return []*models.Vote{{User: viewer, Vote: vote}}
+}
+
+func markMyVotes(comments []*models.Comment, userID string) {
+	for _, c := range comments {
+		c.MyVote = c.VoteOf(userID)
+		markMyVotes(c.Replies, userID)
+	}
+}
+
+// notFoundStatus maps missing posts and comments to 404 and anything else
+// to 500.
+func notFoundStatus(err error) int {
+	if errors.Is(err, repository.ErrPostNotFound) || errors.Is(err, repository.ErrCommentNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"net/http"
+	"redditclone/pkg/models"
+	"testing"
+	"time"
+)
+
+// moderationCase is who tries a moderation action in r/music, where alice
+// wrote the post and bob the comment.
+type moderationCase struct {
+	name string
+	// user is alice, bob, carol, mod, invited, othermod or sam.
+	user string
+	// perms are the permissions of mod, invited and othermod.
+	perms []string
+	want  int
+}
+
+// moderationFixture sets up the users of moderationCase.
+func moderationFixture(t *testing.T, tt moderationCase) (*fixture, map[string]*models.Session, *models.Post, string) {
+	t.Helper()
+	f := newFixture(t)
+	users := map[string]*models.Session{
+		"alice":    f.user("alice", ""),
+		"bob":      f.user("bob", ""),
+		"carol":    f.user("carol", ""),
+		"mod":      f.user("mod", ""),
+		"invited":  f.user("invited", ""),
+		"othermod": f.user("othermod", ""),
+		"sam":      f.user("sam", models.RoleModerator),
+	}
+	f.community("music", models.VisibilityPublic)
+	f.community("news", models.VisibilityPublic)
+	f.moderator("music", users["mod"], tt.perms...)
+	f.invite("music", users["invited"], tt.perms...)
+	f.moderator("news", users["othermod"], tt.perms...)
+	post := f.post("music", users["alice"])
+	return f, users, post, f.comment(post, users["bob"])
+}
+
+func TestDeletePostPermissions(t *testing.T) {
+	tests := []moderationCase{
+		{"author", "alice", nil, http.StatusOK},
+		{"other user", "carol", nil, http.StatusForbidden},
+		{"moderator removing posts", "mod", []string{models.PermRemovePosts}, http.StatusOK},
+		{"full moderator", "mod", models.ModeratorPermissions, http.StatusOK},
+		{"moderator removing comments only", "mod", []string{models.PermRemoveComments}, http.StatusForbidden},
+		{"moderator without permissions", "mod", nil, http.StatusForbidden},
+		{"pending invite", "invited", []string{models.PermRemovePosts}, http.StatusForbidden},
+		{"moderator elsewhere", "othermod", []string{models.PermRemovePosts}, http.StatusForbidden},
+		{"site moderator", "sam", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, users, post, _ := moderationFixture(t, tt)
+			expect(t, f.do(users[tt.user], "DELETE", "/api/post/"+post.ID, ""), tt.want)
+			_, err := f.posts.GetByID(post.ID)
+			if deleted := err != nil; deleted != (tt.want == http.StatusOK) {
+				t.Fatalf("post deleted: %v, want %v", deleted, tt.want == http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestDeleteCommentPermissions(t *testing.T) {
+	tests := []moderationCase{
+		{"comment author", "bob", nil, http.StatusOK},
+		{"post author", "alice", nil, http.StatusOK},
+		{"other user", "carol", nil, http.StatusForbidden},
+		{"moderator removing comments", "mod", []string{models.PermRemoveComments}, http.StatusOK},
+		{"moderator removing posts only", "mod", []string{models.PermRemovePosts}, http.StatusForbidden},
+		{"pending invite", "invited", []string{models.PermRemoveComments}, http.StatusForbidden},
+		{"moderator elsewhere", "othermod", []string{models.PermRemoveComments}, http.StatusForbidden},
+		{"site moderator", "sam", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, users, post, comment := moderationFixture(t, tt)
+			expect(t, f.do(users[tt.user], "DELETE", "/api/post/"+post.ID+"/"+comment, ""), tt.want)
+		})
+	}
+
+	t.Run("post author without PostAuthorsDeleteComments", func(t *testing.T) {
+		f, users, post, comment := moderationFixture(t, moderationCase{})
+		f.postHandler.PostAuthorsDeleteComments = false
+		expect(t, f.do(users["alice"], "DELETE", "/api/post/"+post.ID+"/"+comment, ""), http.StatusForbidden)
+		expect(t, f.do(users["bob"], "DELETE", "/api/post/"+post.ID+"/"+comment, ""), http.StatusOK)
+	})
+}
+
+func TestCommentHistoryPermissions(t *testing.T) {
+	tests := []moderationCase{
+		// Not even the author, the history keeps what they took back.
+		{"comment author", "bob", nil, http.StatusForbidden},
+		{"other user", "carol", nil, http.StatusForbidden},
+		{"moderator removing comments", "mod", []string{models.PermRemoveComments}, http.StatusOK},
+		{"moderator removing posts only", "mod", []string{models.PermRemovePosts}, http.StatusForbidden},
+		{"pending invite", "invited", []string{models.PermRemoveComments}, http.StatusForbidden},
+		{"moderator elsewhere", "othermod", []string{models.PermRemoveComments}, http.StatusForbidden},
+		{"site moderator", "sam", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, users, post, comment := moderationFixture(t, tt)
+			if _, err := f.posts.EditComment(post.ID, comment, "edited"); err != nil {
+				t.Fatal(err)
+			}
+			w := f.do(users[tt.user], "GET", "/api/post/"+post.ID+"/"+comment+"/history", "")
+			if tt.want != http.StatusOK {
+				expect(t, w, tt.want)
+				return
+			}
+			var revisions []*models.Revision
+			decode(t, w, &revisions)
+			if len(revisions) != 2 || revisions[0].Body != "comment" || revisions[1].Body != "edited" {
+				t.Fatalf("history = %+v", revisions)
+			}
+		})
+	}
+}
+
+func TestEditPostTitleWindow(t *testing.T) {
+	tests := []struct {
+		name   string
+		window time.Duration
+		body   string
+		want   int
+		title  string
+		text   string
+	}{
+		{"title within the window", time.Hour, `{"title": "new"}`, http.StatusOK, "new", "text"},
+		{"title after the window", 0, `{"title": "new", "text": "new text"}`, http.StatusForbidden, "title", "text"},
+		{"text after the window", 0, `{"text": "new text"}`, http.StatusOK, "title", "new text"},
+		// Clients sending the whole post back keep the title unchanged.
+		{"same title after the window", 0, `{"title": "title", "text": "new text"}`, http.StatusOK, "title", "new text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			f.postHandler.TitleEditWindow = tt.window
+			alice := f.user("alice", "")
+			f.community("music", models.VisibilityPublic)
+			post := f.post("music", alice)
+
+			expect(t, f.do(alice, "PUT", "/api/post/"+post.ID, tt.body), tt.want)
+			got, err := f.posts.GetByID(post.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Title != tt.title || got.Text != tt.text {
+				t.Fatalf("post is %q/%q, want %q/%q", got.Title, got.Text, tt.title, tt.text)
+			}
+		})
+	}
+
+	t.Run("other user", func(t *testing.T) {
+		f := newFixture(t)
+		alice, bob := f.user("alice", ""), f.user("bob", "")
+		f.community("music", models.VisibilityPublic)
+		post := f.post("music", alice)
+		expect(t, f.do(bob, "PUT", "/api/post/"+post.ID, `{"text": "mine"}`), http.StatusForbidden)
+	})
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"redditclone/pkg/auth"
+	"redditclone/pkg/models"
+	"redditclone/pkg/repository"
+)
+
+// requireSession returns the caller's session put into the context by
+// middleware.Auth. Without one it answers 401 and returns false.
+func requireSession(w http.ResponseWriter, r *http.Request) (*models.Session, bool) {
+	session, ok := auth.SessionFromContext(r.Context())
+	if !ok {
+		http.Error(w, "authorization required", http.StatusUnauthorized)
+		return nil, false
+	}
+	return session, true
+}
+
+// viewerID returns the ID of the signed in caller, or "" for anonymous
+// requests.
+func viewerID(r *http.Request) string {
+	if session, ok := auth.SessionFromContext(r.Context()); ok {
+		return session.UserID
+	}
+	return ""
+}
+
+// hasRole applies the role check to the user, unknown users have no role.
+func hasRole(users repository.UserStore, userID string, check func(*models.User) bool) (bool, error) {
+	user, err := users.GetByID(userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return check(user), nil
+}
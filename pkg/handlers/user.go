@@ -2,34 +2,55 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
+	"net"
 	"net/http"
 	"redditclone/pkg/auth"
+	"redditclone/pkg/models"
 	"redditclone/pkg/repository"
+	"strings"
+	"time"
 )
 
 type UserHandler struct {
-	UserRepo *repository.InMemoryUserRepo
-	Sessions *repository.InMemorySessionRepo
-	logger   *zap.SugaredLogger
+	UserRepo      repository.UserStore
+	Sessions      repository.SessionStore
+	RefreshTokens repository.RefreshTokenStore
+	logger        *zap.SugaredLogger
 }
 
-func NewUserHandler(logger *zap.SugaredLogger) *UserHandler {
+func NewUserHandler(logger *zap.SugaredLogger, users repository.UserStore, sessions repository.SessionStore,
+	refreshTokens repository.RefreshTokenStore) *UserHandler {
 	return &UserHandler{
-		UserRepo: repository.NewInMemoryUserRepo(),
-		Sessions: repository.NewInMemorySessionRepo(),
-		logger:   logger,
+		UserRepo:      users,
+		Sessions:      sessions,
+		RefreshTokens: refreshTokens,
+		logger:        logger,
 	}
 }
 
 type authRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Device   string `json:"device,omitempty"`
 }
 
 type authResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type sessionResponse struct {
+	*models.Session
+	Current bool `json:"current"`
 }
 
 func (h *UserHandler) Index(w http.ResponseWriter, r *http.Request) {
@@ -62,7 +83,7 @@ func (h *UserHandler) RegisterPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, err := h.Sessions.Create(user.Username)
+	session, err := h.Sessions.Create(user, sessionInfo(r, req.Device))
 	if err != nil {
 		h.logger.Errorw("error while creating session", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -70,17 +91,16 @@ func (h *UserHandler) RegisterPage(w http.ResponseWriter, r *http.Request) {
 	}
 	h.logger.Infow("session register", "session", session)
 
-	token, err := auth.GenerateToken(session.ID, session.Username)
+	resp, err := h.issueTokens(session)
 	if err != nil {
 		h.logger.Errorw("error while generating token", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	h.logger.Infow("token register", "token", token)
 
 	w.Header().Set("Content-Type", "application/json")
 
-	err = json.NewEncoder(w).Encode(authResponse{Token: token})
+	err = json.NewEncoder(w).Encode(resp)
 	if err != nil {
 		h.logger.Errorw("error while encoding response", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -111,7 +131,7 @@ func (h *UserHandler) LoginPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, err := h.Sessions.Create(user.Username)
+	session, err := h.Sessions.Create(user, sessionInfo(r, req.Device))
 	if err != nil {
 		h.logger.Errorw("error while creating session", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -119,20 +139,228 @@ func (h *UserHandler) LoginPage(w http.ResponseWriter, r *http.Request) {
 	}
 	h.logger.Infow("session login", "session", session)
 
-	token, err := auth.GenerateToken(session.ID, session.Username)
+	resp, err := h.issueTokens(session)
 	if err != nil {
 		h.logger.Errorw("error while generating token", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	h.logger.Infow("token login", "token", token)
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		h.logger.Errorw("error while encoding response", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.revokeSession(session.ID); err != nil {
+		h.logger.Errorw("error while deleting session", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.logger.Infow("session logout", "session", session.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(deleteResponse{Message: "success"})
+	if err != nil {
+		h.logger.Errorw("error while encoding response", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *UserHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.Sessions.ListByUser(session.UserID)
+	if err != nil {
+		h.logger.Errorw("error while listing sessions", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res := make([]sessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		res = append(res, sessionResponse{Session: s, Current: s.ID == session.ID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		h.logger.Errorw("error while encoding response", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *UserHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID := mux.Vars(r)["SESSION_ID"]
+	target, err := h.Sessions.GetByID(sessionID)
+	if err == nil && target.UserID != session.UserID {
+		// Other users' sessions are reported as missing, not as forbidden.
+		err = repository.ErrSessionNotFound
+	}
+	if err == nil {
+		err = h.revokeSession(sessionID)
+	}
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		h.logger.Errorw("error while deleting session", "error", err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("error while deleting session", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.logger.Infow("session revoked", "session", sessionID)
 
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(authResponse{Token: token})
+	err = json.NewEncoder(w).Encode(deleteResponse{Message: "success"})
 	if err != nil {
 		h.logger.Errorw("error while encoding response", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. Presenting a refresh token that was already exchanged means
+// it leaked, so the whole session with every token of it is revoked.
+func (h *UserHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Errorw("error while decoding request body", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hash := auth.HashRefreshToken(req.RefreshToken)
+	token, err := h.RefreshTokens.MarkUsed(hash)
+	if errors.Is(err, repository.ErrTokenUsed) {
+		reused, err := h.RefreshTokens.GetByHash(hash)
+		if err == nil {
+			h.logger.Warnw("refresh token reuse, revoking session", "session", reused.SessionID)
+			err = h.revokeSession(reused.SessionID)
+		}
+		if err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+			h.logger.Errorw("error while revoking session", "error", err)
+		}
+		http.Error(w, "refresh token reuse detected", http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, repository.ErrTokenNotFound) {
+		h.logger.Errorw("unknown refresh token", "error", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("error while using refresh token", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if time.Now().After(token.Expires) {
+		http.Error(w, "refresh token expired", http.StatusUnauthorized)
+		return
+	}
+
+	session, err := h.Sessions.Touch(token.SessionID)
+	if err != nil {
+		h.logger.Errorw("error while getting session", "error", err)
+		http.Error(w, "invalid session", http.StatusUnauthorized)
+		return
+	}
+
+	resp, err := h.issueTokens(session)
+	if err != nil {
+		h.logger.Errorw("error while generating token", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		h.logger.Errorw("error while encoding response", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// issueTokens creates an access token and a fresh refresh token of the
+// session's family.
+func (h *UserHandler) issueTokens(session *models.Session) (authResponse, error) {
+	token, err := auth.GenerateToken(session)
+	if err != nil {
+		return authResponse{}, err
+	}
+	refresh, record, err := auth.NewRefreshToken(session)
+	if err != nil {
+		return authResponse{}, err
+	}
+	if err = h.RefreshTokens.Create(record); err != nil {
+		return authResponse{}, err
+	}
+	return authResponse{
+		Token:        token,
+		RefreshToken: refresh,
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// revokeSession deletes the session and its refresh token family.
+func (h *UserHandler) revokeSession(sessionID string) error {
+	if err := h.RefreshTokens.RevokeFamily(sessionID); err != nil {
+		return err
+	}
+	return h.Sessions.Delete(sessionID)
+}
+
+// sessionInfo describes the client of r. device is what the client called
+// itself, when empty a rough platform name is taken from the user agent.
+func sessionInfo(r *http.Request, device string) models.SessionInfo {
+	ua := r.UserAgent()
+	if device == "" {
+		device = deviceFromUserAgent(ua)
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return models.SessionInfo{
+		Device:    device,
+		IP:        ip,
+		UserAgent: ua,
+	}
+}
+
+func deviceFromUserAgent(ua string) string {
+	for _, platform := range []struct{ marker, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Macintosh", "Mac"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, platform.marker) {
+			return platform.name
+		}
+	}
+	return "unknown"
+}
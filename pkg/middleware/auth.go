@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"go.uber.org/zap"
+	"net/http"
+	"redditclone/pkg/auth"
+	"strings"
+)
+
+// Auth parses the bearer token of a request once and puts the session it
+// belongs to into the request context, see auth.SessionFromContext.
+type Auth struct {
+	sessions auth.SessionChecker
+	logger   *zap.SugaredLogger
+}
+
+func NewAuth(logger *zap.SugaredLogger, sessions auth.SessionChecker) *Auth {
+	return &Auth{
+		sessions: sessions,
+		logger:   logger,
+	}
+}
+
+// RequireAuth rejects requests without a valid token with 401.
+func (a *Auth) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inToken, ok := bearerToken(r)
+		if !ok {
+			http.Error(w, "authorization required", http.StatusUnauthorized)
+			return
+		}
+		session, err := auth.ParseToken(inToken, a.sessions)
+		if err != nil {
+			a.logger.Errorw("error while parsing token", "error", err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithSession(r.Context(), session)))
+	})
+}
+
+// OptionalAuth attaches the session when the request carries a valid
+// token and serves it anonymously otherwise.
+func (a *Auth) OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inToken, ok := bearerToken(r); ok {
+			session, err := auth.ParseToken(inToken, a.sessions)
+			if err == nil {
+				r = r.WithContext(auth.WithSession(r.Context(), session))
+			} else {
+				a.logger.Infow("ignoring invalid token", "error", err)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	return token, token != ""
+}
@@ -0,0 +1,210 @@
+// Package migrations keeps the versioned SQL schema of the relational
+// storage backend and applies it to a database.
+//
+// Every migration is a pair of files in sql/ named
+// "<version>_<name>.up.sql" and "<version>_<name>.down.sql". Applied
+// versions are recorded in the schema_migrations table.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// All returns every known migration ordered by version.
+func All() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: unknown direction", name)
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		versionStr, title, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: bad file name", name)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: bad version: %w", name, err)
+		}
+		body, err := fs.ReadFile(files, "sql/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	res := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s: missing up or down script", m.Version, m.Name)
+		}
+		res = append(res, *m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, nil
+}
+
+// Runner applies migrations to one database.
+type Runner struct {
+	db     *sql.DB
+	rebind func(string) string
+}
+
+// NewRunner creates a runner. rebind converts "?" placeholders into the
+// driver's native style, pass nil for drivers that accept "?".
+func NewRunner(db *sql.DB, rebind func(string) string) *Runner {
+	if rebind == nil {
+		rebind = func(q string) string { return q }
+	}
+	return &Runner{db: db, rebind: rebind}
+}
+
+func (r *Runner) init() error {
+	_, err := r.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    INTEGER PRIMARY KEY,
+    name       TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+)`)
+	return err
+}
+
+// Version returns the latest applied migration version, 0 for an empty
+// database.
+func (r *Runner) Version() (int, error) {
+	if err := r.init(); err != nil {
+		return 0, err
+	}
+	var version sql.NullInt64
+	if err := r.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// Up applies every pending migration and returns how many were applied.
+func (r *Runner) Up() (int, error) {
+	all, err := All()
+	if err != nil {
+		return 0, err
+	}
+	current, err := r.Version()
+	if err != nil {
+		return 0, err
+	}
+	applied := 0
+	for _, m := range all {
+		if m.Version <= current {
+			continue
+		}
+		err = r.apply(m.Up, func(tx *sql.Tx) error {
+			_, err := tx.Exec(r.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+				m.Version, m.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %d_%s up: %w", m.Version, m.Name, err)
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// Down rolls back the latest steps migrations and returns how many were
+// rolled back.
+func (r *Runner) Down(steps int) (int, error) {
+	all, err := All()
+	if err != nil {
+		return 0, err
+	}
+	rolledBack := 0
+	for rolledBack < steps {
+		current, err := r.Version()
+		if err != nil {
+			return rolledBack, err
+		}
+		if current == 0 {
+			break
+		}
+		idx := sort.Search(len(all), func(i int) bool { return all[i].Version >= current })
+		if idx == len(all) || all[idx].Version != current {
+			return rolledBack, fmt.Errorf("migration %d is applied but unknown", current)
+		}
+		m := all[idx]
+		err = r.apply(m.Down, func(tx *sql.Tx) error {
+			_, err := tx.Exec(r.rebind(`DELETE FROM schema_migrations WHERE version = ?`), m.Version)
+			return err
+		})
+		if err != nil {
+			return rolledBack, fmt.Errorf("migration %d_%s down: %w", m.Version, m.Name, err)
+		}
+		rolledBack++
+	}
+	return rolledBack, nil
+}
+
+func (r *Runner) apply(script string, record func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range statements(script) {
+		if _, err = tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if err = record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// statements splits a script on semicolons so that drivers which refuse
+// multi-statement Exec calls can run it.
+func statements(script string) []string {
+	var res []string
+	for _, stmt := range strings.Split(script, ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			res = append(res, stmt)
+		}
+	}
+	return res
+}
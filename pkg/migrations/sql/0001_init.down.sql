@@ -0,0 +1,5 @@
+DROP TABLE comments;
+DROP TABLE votes;
+DROP TABLE posts;
+DROP TABLE sessions;
+DROP TABLE users;
@@ -0,0 +1,5 @@
+-- Posts, comments and votes stay keyed by user ID, the per-login session
+-- IDs they had before cannot be restored.
+DROP INDEX users_id_idx;
+ALTER TABLE sessions DROP COLUMN user_id;
+ALTER TABLE users DROP COLUMN id;
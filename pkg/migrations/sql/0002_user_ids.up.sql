@@ -0,0 +1,28 @@
+-- Users get a permanent ID. Accounts created before this migration keep
+-- their username as ID, which is unique already.
+ALTER TABLE users ADD COLUMN id TEXT;
+UPDATE users SET id = username WHERE id IS NULL;
+CREATE UNIQUE INDEX users_id_idx ON users (id);
+
+ALTER TABLE sessions ADD COLUMN user_id TEXT NOT NULL DEFAULT '';
+UPDATE sessions SET user_id = (SELECT users.id FROM users WHERE users.username = sessions.username);
+
+-- Ownership used to be the per-login session ID, switch it to the user ID.
+UPDATE posts SET author_id = (SELECT users.id FROM users WHERE users.username = posts.author_username)
+WHERE author_username IN (SELECT username FROM users);
+UPDATE comments SET author_id = (SELECT users.id FROM users WHERE users.username = comments.author_username)
+WHERE author_username IN (SELECT username FROM users);
+
+-- Votes were keyed by session ID too. A user who voted from several
+-- sessions keeps a single vote, the one from the greatest session ID.
+DELETE FROM votes WHERE EXISTS (
+    SELECT 1 FROM votes other
+    JOIN sessions other_session ON other_session.id = other.user_id
+    JOIN sessions this_session ON this_session.id = votes.user_id
+    WHERE other.post_id = votes.post_id
+      AND other_session.username = this_session.username
+      AND other.user_id > votes.user_id
+);
+UPDATE votes SET user_id = (
+    SELECT sessions.user_id FROM sessions WHERE sessions.id = votes.user_id
+) WHERE user_id IN (SELECT id FROM sessions);
@@ -0,0 +1,6 @@
+DROP INDEX sessions_user_id_idx;
+ALTER TABLE sessions DROP COLUMN last_seen;
+ALTER TABLE sessions DROP COLUMN created;
+ALTER TABLE sessions DROP COLUMN user_agent;
+ALTER TABLE sessions DROP COLUMN ip;
+ALTER TABLE sessions DROP COLUMN device;
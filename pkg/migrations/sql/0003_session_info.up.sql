@@ -0,0 +1,7 @@
+ALTER TABLE sessions ADD COLUMN device TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN created TIMESTAMP;
+ALTER TABLE sessions ADD COLUMN last_seen TIMESTAMP;
+UPDATE sessions SET created = CURRENT_TIMESTAMP, last_seen = CURRENT_TIMESTAMP;
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
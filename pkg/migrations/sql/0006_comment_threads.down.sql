@@ -0,0 +1,6 @@
+DROP INDEX comments_parent_id_idx;
+-- Replies become plain comments, placeholders have nothing to show.
+DELETE FROM comments WHERE deleted;
+ALTER TABLE comments DROP COLUMN deleted;
+ALTER TABLE comments DROP COLUMN depth;
+ALTER TABLE comments DROP COLUMN parent_id;
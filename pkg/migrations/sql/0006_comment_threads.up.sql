@@ -0,0 +1,6 @@
+-- Replies point at their parent comment. Cleanup of replies happens in
+-- the application, so there is no foreign key on parent_id.
+ALTER TABLE comments ADD COLUMN parent_id TEXT;
+ALTER TABLE comments ADD COLUMN depth INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX comments_parent_id_idx ON comments (parent_id);
@@ -0,0 +1,6 @@
+CREATE TABLE comment_votes (
+    comment_id TEXT NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+    user_id    TEXT NOT NULL,
+    vote       INTEGER NOT NULL,
+    PRIMARY KEY (comment_id, user_id)
+);
@@ -0,0 +1,2 @@
+DROP TABLE comment_revisions;
+ALTER TABLE comments DROP COLUMN edited;
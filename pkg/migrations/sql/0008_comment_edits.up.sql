@@ -0,0 +1,9 @@
+ALTER TABLE comments ADD COLUMN edited TIMESTAMP;
+
+CREATE TABLE comment_revisions (
+    comment_id TEXT NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+    version    INTEGER NOT NULL,
+    body       TEXT NOT NULL,
+    created    TIMESTAMP NOT NULL,
+    PRIMARY KEY (comment_id, version)
+);
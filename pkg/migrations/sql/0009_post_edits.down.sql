@@ -0,0 +1,2 @@
+DROP TABLE post_revisions;
+ALTER TABLE posts DROP COLUMN edited;
@@ -0,0 +1,10 @@
+ALTER TABLE posts ADD COLUMN edited TIMESTAMP;
+
+CREATE TABLE post_revisions (
+    post_id TEXT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    title   TEXT NOT NULL,
+    text    TEXT NOT NULL,
+    created TIMESTAMP NOT NULL,
+    PRIMARY KEY (post_id, version)
+);
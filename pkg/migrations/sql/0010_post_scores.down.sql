@@ -0,0 +1,2 @@
+DROP INDEX posts_created_idx;
+DROP INDEX posts_score_idx;
@@ -0,0 +1,4 @@
+-- The score column used to stay at its initial value, make it the vote sum.
+UPDATE posts SET score = (SELECT COALESCE(SUM(vote), 0) FROM votes WHERE votes.post_id = posts.id);
+CREATE INDEX posts_score_idx ON posts (score);
+CREATE INDEX posts_created_idx ON posts (created);
@@ -0,0 +1,2 @@
+DROP TABLE community_rules;
+DROP TABLE communities;
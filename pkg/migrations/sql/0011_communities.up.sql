@@ -0,0 +1,15 @@
+CREATE TABLE communities (
+    name             TEXT PRIMARY KEY,
+    title            TEXT NOT NULL DEFAULT '',
+    description      TEXT NOT NULL DEFAULT '',
+    creator_id       TEXT NOT NULL DEFAULT '',
+    creator_username TEXT NOT NULL DEFAULT '',
+    created          TIMESTAMP NOT NULL
+);
+
+CREATE TABLE community_rules (
+    community_name TEXT NOT NULL REFERENCES communities (name) ON DELETE CASCADE,
+    position       INTEGER NOT NULL,
+    rule           TEXT NOT NULL,
+    PRIMARY KEY (community_name, position)
+);
@@ -0,0 +1 @@
+DROP TABLE community_moderators;
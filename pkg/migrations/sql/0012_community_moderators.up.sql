@@ -0,0 +1,10 @@
+CREATE TABLE community_moderators (
+    community_name TEXT NOT NULL REFERENCES communities (name) ON DELETE CASCADE,
+    user_id        TEXT NOT NULL,
+    username       TEXT NOT NULL,
+    -- comma separated permission names
+    permissions    TEXT NOT NULL DEFAULT '',
+    invited        TIMESTAMP NOT NULL,
+    accepted       TIMESTAMP,
+    PRIMARY KEY (community_name, user_id)
+);
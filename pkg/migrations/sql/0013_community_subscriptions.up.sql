@@ -0,0 +1,6 @@
+CREATE TABLE community_subscriptions (
+    user_id        TEXT NOT NULL,
+    community_name TEXT NOT NULL REFERENCES communities (name) ON DELETE CASCADE,
+    subscribed     TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, community_name)
+);
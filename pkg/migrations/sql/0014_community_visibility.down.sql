@@ -0,0 +1,2 @@
+DROP TABLE community_members;
+ALTER TABLE communities DROP COLUMN visibility;
@@ -0,0 +1,9 @@
+ALTER TABLE communities ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public';
+
+CREATE TABLE community_members (
+    community_name TEXT NOT NULL REFERENCES communities (name) ON DELETE CASCADE,
+    user_id        TEXT NOT NULL,
+    username       TEXT NOT NULL,
+    approved       TIMESTAMP NOT NULL,
+    PRIMARY KEY (community_name, user_id)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE community_bans (
+    community_name     TEXT NOT NULL REFERENCES communities (name) ON DELETE CASCADE,
+    user_id            TEXT NOT NULL,
+    username           TEXT NOT NULL,
+    reason             TEXT NOT NULL DEFAULT '',
+    note               TEXT NOT NULL DEFAULT '',
+    moderator_id       TEXT NOT NULL DEFAULT '',
+    moderator_username TEXT NOT NULL DEFAULT '',
+    created            TIMESTAMP NOT NULL,
+    -- NULL for permanent bans
+    expires            TIMESTAMP,
+    PRIMARY KEY (community_name, user_id)
+);
+
+CREATE INDEX community_bans_expires_idx ON community_bans (expires);
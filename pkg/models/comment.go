@@ -2,11 +2,89 @@ package models
 
 import "time"
 
+const (
+	// DeletedCommentBody replaces the body of a deleted comment that still
+	// has replies.
+	DeletedCommentBody = "[deleted]"
+	// DeletedCommentAuthor is the username shown in place of its author.
+	// The frontend expects every comment to have an author object.
+	DeletedCommentAuthor = "[deleted]"
+)
+
 type (
 	Comment struct {
-		Created time.Time `json:"created"`
-		Author  *Session  `json:"author"`
-		Body    string    `json:"body"`
-		ID      string    `json:"id"`
+		Created  time.Time `json:"created"`
+		Author   *Author   `json:"author"`
+		Body     string    `json:"body"`
+		ID       string    `json:"id"`
+		ParentID string    `json:"parentId,omitempty"`
+		Depth    int       `json:"depth"`
+		Deleted  bool      `json:"deleted,omitempty"`
+		// Edited is when the body was last changed, nil if never.
+		Edited *time.Time `json:"edited,omitempty"`
+
+		Score      int     `json:"score"`
+		UpVotePerc int     `json:"upvotePercentage"`
+		Votes      []*Vote `json:"votes"`
+		// MyVote is the vote of the user the comment is shown to, filled
+		// per request.
+		MyVote int `json:"myVote"`
+		// Replies is only filled in the tree built by CommentTree, posts
+		// keep their comments as a flat list.
+		Replies []*Comment `json:"replies,omitempty"`
 	}
 )
+
+// Tombstone turns the comment into a "[deleted]" placeholder that keeps its
+// place in the thread.
+func (c *Comment) Tombstone() {
+	c.Author = &Author{Username: DeletedCommentAuthor}
+	c.Body = DeletedCommentBody
+	c.Deleted = true
+}
+
+// Revision describes the current version of the comment as the version
+// following the given number of earlier ones.
+func (c *Comment) Revision(earlier int) *Revision {
+	created := c.Created
+	if c.Edited != nil {
+		created = *c.Edited
+	}
+	return &Revision{Version: earlier + 1, Body: c.Body, Created: created}
+}
+
+// VoteOf returns the user's vote on the comment: 1, -1 or 0 when the user
+// did not vote.
+func (c *Comment) VoteOf(userID string) int {
+	for _, v := range c.Votes {
+		if v.User == userID {
+			return v.Vote
+		}
+	}
+	return 0
+}
+
+// CommentTree arranges a flat, oldest first comment list into threads and
+// returns the top-level comments. The comments are copied, the list passed
+// in is left untouched. Replies whose parent is missing become top-level.
+func CommentTree(comments []*Comment) []*Comment {
+	nodes := make(map[string]*Comment, len(comments))
+	for _, c := range comments {
+		node := *c
+		node.Replies = nil
+		if node.Votes == nil {
+			node.Votes = make([]*Vote, 0)
+		}
+		nodes[c.ID] = &node
+	}
+	roots := make([]*Comment, 0)
+	for _, c := range comments {
+		node := nodes[c.ID]
+		if parent, ok := nodes[c.ParentID]; ok && c.ParentID != "" {
+			parent.Replies = append(parent.Replies, node)
+			continue
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
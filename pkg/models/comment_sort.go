@@ -0,0 +1,110 @@
+package models
+
+import (
+	"math"
+	"sort"
+)
+
+// Comment sort modes accepted by SortComments.
+const (
+	CommentSortBest          = "best"
+	CommentSortTop           = "top"
+	CommentSortNew           = "new"
+	CommentSortOld           = "old"
+	CommentSortControversial = "controversial"
+)
+
+// wilsonZ is the z-score of the 80% confidence level used for the "best"
+// sort.
+const wilsonZ = 1.281551565545
+
+var commentSorts = map[string]func(a, b *Comment) bool{
+	CommentSortBest: func(a, b *Comment) bool {
+		return wilsonScore(a) > wilsonScore(b)
+	},
+	CommentSortTop: func(a, b *Comment) bool {
+		return a.Score > b.Score
+	},
+	CommentSortNew: func(a, b *Comment) bool {
+		return a.Created.After(b.Created)
+	},
+	CommentSortOld: func(a, b *Comment) bool {
+		return a.Created.Before(b.Created)
+	},
+	CommentSortControversial: func(a, b *Comment) bool {
+		return controversy(a) > controversy(b)
+	},
+}
+
+// ValidCommentSort reports whether mode is a known comment sort mode.
+func ValidCommentSort(mode string) bool {
+	_, ok := commentSorts[mode]
+	return ok
+}
+
+// SortComments orders a comment tree built by CommentTree in place, every
+// level of replies separately. Comments that rank the same stay oldest
+// first. Unknown modes leave the order untouched.
+func SortComments(comments []*Comment, mode string) {
+	less, ok := commentSorts[mode]
+	if !ok {
+		return
+	}
+	sortLevel(comments, less)
+}
+
+func sortLevel(comments []*Comment, less func(a, b *Comment) bool) {
+	sort.SliceStable(comments, func(i, j int) bool {
+		a, b := comments[i], comments[j]
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		return a.Created.Before(b.Created)
+	})
+	for _, c := range comments {
+		sortLevel(c.Replies, less)
+	}
+}
+
+func (c *Comment) upsDowns() (ups, downs int) {
+	for _, v := range c.Votes {
+		switch v.Vote {
+		case 1:
+			ups++
+		case -1:
+			downs++
+		}
+	}
+	return ups, downs
+}
+
+// wilsonScore is the lower bound of the Wilson score interval of the share
+// of upvotes: few votes rank below many votes of the same ratio.
+func wilsonScore(c *Comment) float64 {
+	ups, downs := c.upsDowns()
+	n := float64(ups + downs)
+	if n == 0 {
+		return 0
+	}
+	p := float64(ups) / n
+	z2 := wilsonZ * wilsonZ
+	return (p + z2/(2*n) - wilsonZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+}
+
+// controversy is high for comments with many votes split evenly between up
+// and down.
+func controversy(c *Comment) float64 {
+	ups, downs := c.upsDowns()
+	if ups == 0 || downs == 0 {
+		return 0
+	}
+	magnitude := float64(ups + downs)
+	balance := float64(downs) / float64(ups)
+	if ups < downs {
+		balance = float64(ups) / float64(downs)
+	}
+	return math.Pow(magnitude, balance)
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+var communityNameRe = regexp.MustCompile(`^[A-Za-z0-9_]{3,21}$`)
+
+// Moderator permissions, each allows one kind of community moderation.
+const (
+	PermRemovePosts    = "posts"
+	PermRemoveComments = "comments"
+	PermBanUsers       = "bans"
+	PermEditRules      = "rules"
+	PermManageFlair    = "flair"
+)
+
+// Community visibility modes. Anyone reads and posts in public
+// communities, anyone reads restricted ones but only members post, and
+// private ones are closed to everyone but members.
+const (
+	VisibilityPublic     = "public"
+	VisibilityRestricted = "restricted"
+	VisibilityPrivate    = "private"
+)
+
+// ModeratorPermissions lists every moderator permission. Moderators holding
+// all of them are full moderators and manage the other moderators.
+var ModeratorPermissions = []string{PermRemovePosts, PermRemoveComments, PermBanUsers, PermEditRules, PermManageFlair}
+
+type (
+	// Community is a subreddit. Posts belong to one through their Category,
+	// which holds the community name.
+	Community struct {
+		Name        string `json:"name"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		// Creator is nil for communities set up by the server at startup.
+		Creator *Author   `json:"creator"`
+		Created time.Time `json:"created"`
+		Rules   []string  `json:"rules"`
+		// Moderators holds accepted moderators and pending invites.
+		Moderators []*Moderator `json:"moderators"`
+		// Visibility is one of the Visibility modes, empty means public.
+		Visibility string `json:"visibility"`
+		// Members are the users approved to post in restricted communities
+		// and to read and post in private ones.
+		Members []*Member `json:"members"`
+	}
+
+	Moderator struct {
+		UserID      string    `json:"userId"`
+		Username    string    `json:"username"`
+		Permissions []string  `json:"permissions"`
+		Invited     time.Time `json:"invited"`
+		// Accepted is when the user accepted the invite, nil while pending.
+		Accepted *time.Time `json:"accepted,omitempty"`
+	}
+
+	Member struct {
+		UserID   string    `json:"userId"`
+		Username string    `json:"username"`
+		Approved time.Time `json:"approved"`
+	}
+
+	// Ban keeps a user from posting, commenting and voting in a community.
+	Ban struct {
+		Community string `json:"community"`
+		UserID    string `json:"userId"`
+		Username  string `json:"username"`
+		// Reason is shown to the banned user, Note only to moderators.
+		Reason    string    `json:"reason"`
+		Note      string    `json:"note"`
+		Moderator *Author   `json:"moderator"`
+		Created   time.Time `json:"created"`
+		// Expires is nil for permanent bans.
+		Expires *time.Time `json:"expires,omitempty"`
+	}
+)
+
+// ValidCommunityName reports whether name may name a community: 3 to 21
+// letters, digits or underscores.
+func ValidCommunityName(name string) bool {
+	return communityNameRe.MatchString(name)
+}
+
+// ValidModeratorPermission reports whether perm is one of
+// ModeratorPermissions.
+func ValidModeratorPermission(perm string) bool {
+	for _, p := range ModeratorPermissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidVisibility reports whether mode is one of the Visibility modes.
+func ValidVisibility(mode string) bool {
+	return mode == VisibilityPublic || mode == VisibilityRestricted || mode == VisibilityPrivate
+}
+
+// Moderator returns the user's moderator entry, accepted or pending, or nil.
+func (c *Community) Moderator(userID string) *Moderator {
+	for _, m := range c.Moderators {
+		if m.UserID == userID {
+			return m
+		}
+	}
+	return nil
+}
+
+// Can reports whether the user is an accepted moderator of the community
+// holding the permission.
+func (c *Community) Can(userID, perm string) bool {
+	m := c.Moderator(userID)
+	return m != nil && m.Accepted != nil && m.Has(perm)
+}
+
+// IsFullModerator reports whether the user is an accepted moderator holding
+// every permission.
+func (c *Community) IsFullModerator(userID string) bool {
+	for _, perm := range ModeratorPermissions {
+		if !c.Can(userID, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Moderator) Has(perm string) bool {
+	for _, p := range m.Permissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// IsMember reports whether the user is an approved member or an accepted
+// moderator of the community.
+func (c *Community) IsMember(userID string) bool {
+	if userID == "" {
+		return false
+	}
+	for _, m := range c.Members {
+		if m.UserID == userID {
+			return true
+		}
+	}
+	m := c.Moderator(userID)
+	return m != nil && m.Accepted != nil
+}
+
+// CanRead reports whether the user, "" for anonymous, may read the posts of
+// the community.
+func (c *Community) CanRead(userID string) bool {
+	return c.Visibility != VisibilityPrivate || c.IsMember(userID)
+}
+
+// CanPost reports whether the user may post and comment in the community.
+func (c *Community) CanPost(userID string) bool {
+	return c.Visibility == VisibilityPublic || c.Visibility == "" || c.IsMember(userID)
+}
+
+// Active reports whether the ban is still in force at now.
+func (b *Ban) Active(now time.Time) bool {
+	return b.Expires == nil || now.Before(*b.Expires)
+}
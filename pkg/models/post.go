@@ -4,22 +4,39 @@ import "time"
 
 type (
 	Post struct {
-		Score      int        `json:"score"`
-		Views      int        `json:"views"`
-		Type       string     `json:"type"`
-		Title      string     `json:"title"`
-		Author     *Session   `json:"author"`
-		Category   string     `json:"category"`
-		Text       string     `json:"text,omitempty"`
-		URL        string     `json:"url,omitempty"`
-		Votes      []*Vote    `json:"votes"`
-		Comments   []*Comment `json:"comments"`
-		Created    time.Time  `json:"created"`
+		Score    int        `json:"score"`
+		Views    int        `json:"views"`
+		Type     string     `json:"type"`
+		Title    string     `json:"title"`
+		Author   *Author    `json:"author"`
+		Category string     `json:"category"`
+		Text     string     `json:"text,omitempty"`
+		URL      string     `json:"url,omitempty"`
+		Votes    Votes      `json:"votes"`
+		Comments []*Comment `json:"comments"`
+		Created  time.Time  `json:"created"`
+		// Edited is when the title or text was last changed, nil if never.
+		Edited     *time.Time `json:"edited,omitempty"`
 		UpVotePerc int        `json:"upvotePercentage"`
 		ID         string     `json:"id"`
+		// MyVote is the vote of the user the post is shown to, Upvotes and
+		// Downvotes count the votes. All three are filled per request.
+		MyVote    int `json:"myVote"`
+		Upvotes   int `json:"upvotes"`
+		Downvotes int `json:"downvotes"`
 	}
 	Vote struct {
 		User string `json:"user"`
 		Vote int    `json:"vote"`
 	}
 )
+
+// Revision describes the current title and text of the post as the version
+// following the given number of earlier ones.
+func (p *Post) Revision(earlier int) *Revision {
+	created := p.Created
+	if p.Edited != nil {
+		created = *p.Edited
+	}
+	return &Revision{Version: earlier + 1, Title: p.Title, Body: p.Text, Created: created}
+}
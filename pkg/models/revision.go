@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type (
+	// Revision is one version of an edited comment or post, Body holds the
+	// text. Versions count from 1, the original.
+	Revision struct {
+		Version int       `json:"version"`
+		Title   string    `json:"title,omitempty"`
+		Body    string    `json:"body"`
+		Created time.Time `json:"created"`
+	}
+)
@@ -1,12 +1,31 @@
 package models
 
+import "time"
+
 type (
+	// Session is one login of a user. ID changes on every login, UserID is
+	// the permanent identity used for ownership and votes.
 	Session struct {
 		ID       string `json:"id"`
+		UserID   string `json:"userId"`
 		Username string `json:"username"`
+		SessionInfo
+		Created  time.Time `json:"created"`
+		LastSeen time.Time `json:"lastSeen"`
 	}
 
-	SessionRepo interface {
-		Create(*Session) (*Session, error)
+	// SessionInfo describes the client a session was opened from.
+	SessionInfo struct {
+		Device    string `json:"device"`
+		IP        string `json:"ip"`
+		UserAgent string `json:"userAgent"`
 	}
 )
+
+// Author returns the public identity of the session owner.
+func (s *Session) Author() *Author {
+	return &Author{
+		ID:       s.UserID,
+		Username: s.Username,
+	}
+}
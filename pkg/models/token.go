@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+type (
+	// RefreshToken is the server side record of an opaque refresh token.
+	// Only the hash of the token is kept. Every token issued for one session
+	// belongs to the same family, identified by SessionID.
+	RefreshToken struct {
+		Hash      string    `json:"hash"`
+		SessionID string    `json:"sessionId"`
+		UserID    string    `json:"userId"`
+		Created   time.Time `json:"created"`
+		Expires   time.Time `json:"expires"`
+		UsedAt    time.Time `json:"usedAt"`
+	}
+)
+
+// Used reports whether the token was already exchanged for a new one.
+func (t *RefreshToken) Used() bool {
+	return !t.UsedAt.IsZero()
+}
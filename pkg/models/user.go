@@ -1,12 +1,33 @@
 package models
 
+// Site-wide user roles. Regular users have an empty role.
+const (
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
 type (
 	User struct {
+		ID       string `json:"id"`
 		Username string `json:"username"`
 		Password string `json:"password"`
+		Role     string `json:"role,omitempty"`
 	}
 
-	UserRepo interface {
-		Create(user *User) (*User, error)
+	// Author is the public identity of a user attached to posts and comments.
+	Author struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
 	}
 )
+
+// IsModerator reports whether the user may moderate content site-wide.
+// Admins are moderators too.
+func (u *User) IsModerator() bool {
+	return u.Role == RoleModerator || u.Role == RoleAdmin
+}
+
+// IsAdmin reports whether the user has the admin role.
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
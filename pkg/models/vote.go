@@ -0,0 +1,120 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+type (
+	// Votes holds the votes on a post keyed by user ID along with running
+	// up and down counts, so a user's vote is read, changed or removed
+	// without looking at anyone else's. The zero value is empty and ready to
+	// use. It serializes as the list of votes, the form stored before.
+	Votes struct {
+		byUser map[string]int
+		up     int
+		down   int
+	}
+)
+
+// NewVotes builds a vote set from a list, later votes of the same user
+// replacing earlier ones.
+func NewVotes(list []*Vote) Votes {
+	var v Votes
+	for _, vote := range list {
+		v.Set(vote.User, vote.Vote)
+	}
+	return v
+}
+
+// Set records the user's vote, replacing any earlier one. A zero vote
+// removes it.
+func (v *Votes) Set(userID string, vote int) {
+	v.Remove(userID)
+	if vote == 0 {
+		return
+	}
+	if v.byUser == nil {
+		v.byUser = make(map[string]int)
+	}
+	v.byUser[userID] = vote
+	v.count(vote, 1)
+}
+
+// Remove drops the user's vote, if any.
+func (v *Votes) Remove(userID string) {
+	old, ok := v.byUser[userID]
+	if !ok {
+		return
+	}
+	delete(v.byUser, userID)
+	v.count(old, -1)
+}
+
+func (v *Votes) count(vote, delta int) {
+	if vote > 0 {
+		v.up += delta
+	} else {
+		v.down += delta
+	}
+}
+
+// Of returns the user's vote: 1, -1 or 0 when the user did not vote.
+func (v Votes) Of(userID string) int {
+	return v.byUser[userID]
+}
+
+// Up returns the number of upvotes.
+func (v Votes) Up() int { return v.up }
+
+// Down returns the number of downvotes.
+func (v Votes) Down() int { return v.down }
+
+// Len returns the number of users who voted.
+func (v Votes) Len() int { return len(v.byUser) }
+
+// Score is upvotes minus downvotes.
+func (v Votes) Score() int { return v.up - v.down }
+
+// UpVotePercent is the share of upvotes among all votes, 0 without votes.
+func (v Votes) UpVotePercent() int {
+	if v.up+v.down == 0 {
+		return 0
+	}
+	return v.up * 100 / (v.up + v.down)
+}
+
+// Clone returns an independent copy.
+func (v Votes) Clone() Votes {
+	c := Votes{up: v.up, down: v.down}
+	if v.byUser != nil {
+		c.byUser = make(map[string]int, len(v.byUser))
+		for user, vote := range v.byUser {
+			c.byUser[user] = vote
+		}
+	}
+	return c
+}
+
+// List returns the votes ordered by user ID.
+func (v Votes) List() []*Vote {
+	res := make([]*Vote, 0, len(v.byUser))
+	for user, vote := range v.byUser {
+		res = append(res, &Vote{User: user, Vote: vote})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].User < res[j].User })
+	return res
+}
+
+func (v Votes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.List())
+}
+
+func (v *Votes) UnmarshalJSON(data []byte) error {
+	var list []*Vote
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*v = NewVotes(list)
+	return nil
+}
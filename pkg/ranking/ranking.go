@@ -0,0 +1,143 @@
+// Package ranking orders post listings. Every sort mode is a Ranker that
+// scores a post, higher scores are listed first. New modes plug in with
+// Register.
+package ranking
+
+import (
+	"math"
+	"redditclone/pkg/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// Ranker scores a post at the moment now.
+	Ranker func(post *models.Post, now time.Time) float64
+
+	// Key is the position of a post in a ranked listing.
+	Key struct {
+		Score   float64   `json:"r"`
+		Created time.Time `json:"c"`
+		ID      string    `json:"i"`
+	}
+)
+
+// Built-in sort modes.
+const (
+	Hot           = "hot"
+	New           = "new"
+	Top           = "top"
+	Rising        = "rising"
+	Controversial = "controversial"
+)
+
+// hotEpoch is the reference time of the hot ranking, only differences of
+// scores matter so any fixed moment works.
+var hotEpoch = time.Date(2005, time.December, 8, 7, 46, 43, 0, time.UTC)
+
+var (
+	rankersMu sync.RWMutex
+	rankers   = map[string]Ranker{
+		Hot:           hot,
+		New:           newest,
+		Top:           top,
+		Rising:        rising,
+		Controversial: controversial,
+	}
+)
+
+// Register adds or replaces the ranker of a sort mode.
+func Register(mode string, r Ranker) {
+	rankersMu.Lock()
+	defer rankersMu.Unlock()
+	rankers[mode] = r
+}
+
+// Lookup returns the ranker of a sort mode.
+func Lookup(mode string) (Ranker, bool) {
+	rankersMu.RLock()
+	defer rankersMu.RUnlock()
+	r, ok := rankers[mode]
+	return r, ok
+}
+
+// Less reports whether k is listed before o: higher scores first, then
+// newer posts, then by ID, so no two posts tie.
+func (k Key) Less(o Key) bool {
+	if k.Score != o.Score {
+		return k.Score > o.Score
+	}
+	if !k.Created.Equal(o.Created) {
+		return k.Created.After(o.Created)
+	}
+	return k.ID > o.ID
+}
+
+// Sort orders posts by the ranker, best first, and returns their keys in
+// the same order.
+func Sort(posts []*models.Post, rank Ranker, now time.Time) []Key {
+	keys := make([]Key, len(posts))
+	for i, p := range posts {
+		keys[i] = Key{Score: rank(p, now), Created: p.Created, ID: p.ID}
+	}
+	sort.Sort(byKey{posts: posts, keys: keys})
+	return keys
+}
+
+// byKey sorts posts together with their keys.
+type byKey struct {
+	posts []*models.Post
+	keys  []Key
+}
+
+func (s byKey) Len() int           { return len(s.keys) }
+func (s byKey) Less(i, j int) bool { return s.keys[i].Less(s.keys[j]) }
+func (s byKey) Swap(i, j int) {
+	s.posts[i], s.posts[j] = s.posts[j], s.posts[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// hot weighs the order of magnitude of the score against the age: a post
+// needs ten times the score to rank level with one 12.5 hours newer.
+func hot(post *models.Post, _ time.Time) float64 {
+	order := math.Log10(math.Max(math.Abs(float64(post.Score)), 1))
+	sign := 0.0
+	switch {
+	case post.Score > 0:
+		sign = 1
+	case post.Score < 0:
+		sign = -1
+	}
+	seconds := post.Created.Sub(hotEpoch).Seconds()
+	return sign*order + seconds/45000
+}
+
+func newest(post *models.Post, _ time.Time) float64 {
+	return float64(post.Created.UnixNano())
+}
+
+func top(post *models.Post, _ time.Time) float64 {
+	return float64(post.Score)
+}
+
+// rising favors posts collecting votes fast: the score decays with the age
+// in hours.
+func rising(post *models.Post, now time.Time) float64 {
+	hours := math.Max(now.Sub(post.Created).Hours(), 0)
+	return float64(post.Score) / math.Pow(hours+2, 1.5)
+}
+
+// controversial is high for posts with many votes split evenly between up
+// and down.
+func controversial(post *models.Post, _ time.Time) float64 {
+	ups, downs := post.Votes.Up(), post.Votes.Down()
+	if ups == 0 || downs == 0 {
+		return 0
+	}
+	balance := float64(downs) / float64(ups)
+	if ups < downs {
+		balance = float64(ups) / float64(downs)
+	}
+	return math.Pow(float64(ups+downs), balance)
+}
@@ -0,0 +1,38 @@
+package ranking
+
+import (
+	"redditclone/pkg/models"
+	"time"
+)
+
+// Time windows of the top listing.
+var windows = map[string]time.Duration{
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"year":  365 * 24 * time.Hour,
+	"all":   0,
+}
+
+// Window returns the length of a named time window, 0 for "all".
+func Window(name string) (time.Duration, bool) {
+	d, ok := windows[name]
+	return d, ok
+}
+
+// Within returns the posts created during the window before now. A zero
+// window keeps all of them.
+func Within(posts []*models.Post, window time.Duration, now time.Time) []*models.Post {
+	if window == 0 {
+		return posts
+	}
+	since := now.Add(-window)
+	res := make([]*models.Post, 0, len(posts))
+	for _, p := range posts {
+		if !p.Created.Before(since) {
+			res = append(res, p)
+		}
+	}
+	return res
+}
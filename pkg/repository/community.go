@@ -0,0 +1,449 @@
+package repository
+
+import (
+	"redditclone/pkg/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	InMemoryCommunityRepo struct {
+		communities map[string]*models.Community
+		// subscriptions holds the names of the communities each user is
+		// subscribed to, by user ID.
+		subscriptions map[string]map[string]struct{}
+		// bans holds the bans of each community by user ID.
+		bans map[string]map[string]*models.Ban
+		mu   sync.RWMutex
+	}
+)
+
+func NewInMemoryCommunityRepo() *InMemoryCommunityRepo {
+	return &InMemoryCommunityRepo{
+		communities:   make(map[string]*models.Community),
+		subscriptions: make(map[string]map[string]struct{}),
+		bans:          make(map[string]map[string]*models.Ban),
+	}
+}
+
+func (r *InMemoryCommunityRepo) Create(community *models.Community) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.communities[community.Name]; exists {
+		return ErrCommunityExists
+	}
+	r.communities[community.Name] = copyCommunity(community)
+	return nil
+}
+
+func (r *InMemoryCommunityRepo) GetByName(name string) (*models.Community, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	community, ok := r.communities[name]
+	if !ok {
+		return nil, ErrCommunityNotFound
+	}
+	return copyCommunity(community), nil
+}
+
+func (r *InMemoryCommunityRepo) List() ([]*models.Community, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]*models.Community, 0, len(r.communities))
+	for _, c := range r.communities {
+		res = append(res, copyCommunity(c))
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func (r *InMemoryCommunityRepo) Update(community *models.Community) (*models.Community, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.communities[community.Name]
+	if !ok {
+		return nil, ErrCommunityNotFound
+	}
+	stored.Title = community.Title
+	stored.Description = community.Description
+	stored.Rules = append([]string(nil), community.Rules...)
+	stored.Visibility = community.Visibility
+	return copyCommunity(stored), nil
+}
+
+func (r *InMemoryCommunityRepo) Delete(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.communities[name]; !ok {
+		return ErrCommunityNotFound
+	}
+	delete(r.communities, name)
+	delete(r.bans, name)
+	r.unsubscribeAll(name)
+	return nil
+}
+
+func (r *InMemoryCommunityRepo) InviteModerator(name string, mod *models.Moderator) (*models.Community, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	community, ok := r.communities[name]
+	if !ok {
+		return nil, ErrCommunityNotFound
+	}
+	if existing := community.Moderator(mod.UserID); existing != nil {
+		existing.Permissions = append([]string(nil), mod.Permissions...)
+		return copyCommunity(community), nil
+	}
+	community.Moderators = append(community.Moderators, copyModerator(mod))
+	return copyCommunity(community), nil
+}
+
+func (r *InMemoryCommunityRepo) AcceptModerator(name, userID string) (*models.Community, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	community, ok := r.communities[name]
+	if !ok {
+		return nil, ErrCommunityNotFound
+	}
+	mod := community.Moderator(userID)
+	if mod == nil || mod.Accepted != nil {
+		return nil, ErrInviteNotFound
+	}
+	now := time.Now()
+	mod.Accepted = &now
+	return copyCommunity(community), nil
+}
+
+func (r *InMemoryCommunityRepo) RemoveModerator(name, userID string) (*models.Community, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	community, ok := r.communities[name]
+	if !ok {
+		return nil, ErrCommunityNotFound
+	}
+	for i, m := range community.Moderators {
+		if m.UserID == userID {
+			community.Moderators = append(community.Moderators[:i:i], community.Moderators[i+1:]...)
+			return copyCommunity(community), nil
+		}
+	}
+	return nil, ErrModeratorNotFound
+}
+
+func (r *InMemoryCommunityRepo) ApproveMember(name string, member *models.Member) (*models.Community, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	community, ok := r.communities[name]
+	if !ok {
+		return nil, ErrCommunityNotFound
+	}
+	for _, m := range community.Members {
+		if m.UserID == member.UserID {
+			return copyCommunity(community), nil
+		}
+	}
+	approved := *member
+	community.Members = append(community.Members, &approved)
+	return copyCommunity(community), nil
+}
+
+func (r *InMemoryCommunityRepo) RemoveMember(name, userID string) (*models.Community, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	community, ok := r.communities[name]
+	if !ok {
+		return nil, ErrCommunityNotFound
+	}
+	for i, m := range community.Members {
+		if m.UserID == userID {
+			community.Members = append(community.Members[:i:i], community.Members[i+1:]...)
+			return copyCommunity(community), nil
+		}
+	}
+	return nil, ErrMemberNotFound
+}
+
+func (r *InMemoryCommunityRepo) Ban(ban *models.Ban) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.communities[ban.Community]; !ok {
+		return ErrCommunityNotFound
+	}
+	banned, ok := r.bans[ban.Community]
+	if !ok {
+		banned = make(map[string]*models.Ban)
+		r.bans[ban.Community] = banned
+	}
+	banned[ban.UserID] = copyBan(ban)
+	return nil
+}
+
+func (r *InMemoryCommunityRepo) Unban(name, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.communities[name]; !ok {
+		return ErrCommunityNotFound
+	}
+	if _, ok := r.bans[name][userID]; !ok {
+		return ErrBanNotFound
+	}
+	delete(r.bans[name], userID)
+	if len(r.bans[name]) == 0 {
+		delete(r.bans, name)
+	}
+	return nil
+}
+
+func (r *InMemoryCommunityRepo) GetBan(name, userID string) (*models.Ban, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.communities[name]; !ok {
+		return nil, ErrCommunityNotFound
+	}
+	ban, ok := r.bans[name][userID]
+	if !ok {
+		return nil, ErrBanNotFound
+	}
+	return copyBan(ban), nil
+}
+
+func (r *InMemoryCommunityRepo) Bans(name string) ([]*models.Ban, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.communities[name]; !ok {
+		return nil, ErrCommunityNotFound
+	}
+	res := make([]*models.Ban, 0, len(r.bans[name]))
+	for _, ban := range r.bans[name] {
+		res = append(res, copyBan(ban))
+	}
+	sortBans(res)
+	return res, nil
+}
+
+func (r *InMemoryCommunityRepo) ExpireBans(now time.Time) (int, error) {
+	return len(r.expireBans(now)), nil
+}
+
+// expireBans removes the bans expired by now and returns them.
+func (r *InMemoryCommunityRepo) expireBans(now time.Time) []*models.Ban {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var expired []*models.Ban
+	for name, banned := range r.bans {
+		for userID, ban := range banned {
+			if !ban.Active(now) {
+				expired = append(expired, ban)
+				delete(banned, userID)
+			}
+		}
+		if len(banned) == 0 {
+			delete(r.bans, name)
+		}
+	}
+	return expired
+}
+
+// allBans returns every ban, used to snapshot persisted state.
+func (r *InMemoryCommunityRepo) allBans() []*models.Ban {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]*models.Ban, 0)
+	for _, banned := range r.bans {
+		for _, ban := range banned {
+			res = append(res, copyBan(ban))
+		}
+	}
+	sortBans(res)
+	return res
+}
+
+func (r *InMemoryCommunityRepo) Subscribe(name, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.communities[name]; !ok {
+		return ErrCommunityNotFound
+	}
+	names, ok := r.subscriptions[userID]
+	if !ok {
+		names = make(map[string]struct{})
+		r.subscriptions[userID] = names
+	}
+	names[name] = struct{}{}
+	return nil
+}
+
+func (r *InMemoryCommunityRepo) Unsubscribe(name, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.communities[name]; !ok {
+		return ErrCommunityNotFound
+	}
+	delete(r.subscriptions[userID], name)
+	if len(r.subscriptions[userID]) == 0 {
+		delete(r.subscriptions, userID)
+	}
+	return nil
+}
+
+func (r *InMemoryCommunityRepo) Subscriptions(userID string) ([]*models.Community, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]*models.Community, 0, len(r.subscriptions[userID]))
+	for name := range r.subscriptions[userID] {
+		res = append(res, copyCommunity(r.communities[name]))
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+// unsubscribeAll drops every subscription to a deleted community. The
+// caller holds the lock.
+func (r *InMemoryCommunityRepo) unsubscribeAll(name string) {
+	for userID, names := range r.subscriptions {
+		delete(names, name)
+		if len(names) == 0 {
+			delete(r.subscriptions, userID)
+		}
+	}
+}
+
+// subscribers returns the subscribed community names by user ID, used to
+// snapshot persisted state.
+func (r *InMemoryCommunityRepo) subscribers() map[string][]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make(map[string][]string, len(r.subscriptions))
+	for userID, names := range r.subscriptions {
+		for name := range names {
+			res[userID] = append(res[userID], name)
+		}
+		sort.Strings(res[userID])
+	}
+	return res
+}
+
+// restore puts a community back as-is, used when replaying persisted state.
+func (r *InMemoryCommunityRepo) restore(community *models.Community) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.communities[community.Name] = community
+}
+
+func (r *InMemoryCommunityRepo) forget(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.communities, name)
+	delete(r.bans, name)
+	r.unsubscribeAll(name)
+}
+
+// communityState is everything the repo keeps about one community, taken
+// before a mutation so it can be undone when its journal record can't be
+// written.
+type communityState struct {
+	name        string
+	community   *models.Community
+	bans        map[string]*models.Ban
+	subscribers []string
+}
+
+// state captures a community with its bans and subscribers, community is
+// nil if it is missing.
+func (r *InMemoryCommunityRepo) state(name string) *communityState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s := &communityState{name: name}
+	community, ok := r.communities[name]
+	if !ok {
+		return s
+	}
+	s.community = copyCommunity(community)
+	if banned := r.bans[name]; len(banned) > 0 {
+		s.bans = make(map[string]*models.Ban, len(banned))
+		for userID, ban := range banned {
+			s.bans[userID] = copyBan(ban)
+		}
+	}
+	for userID, names := range r.subscriptions {
+		if _, ok := names[name]; ok {
+			s.subscribers = append(s.subscribers, userID)
+		}
+	}
+	return s
+}
+
+// reset puts a community back the way state captured it.
+func (r *InMemoryCommunityRepo) reset(s *communityState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.communities, s.name)
+	delete(r.bans, s.name)
+	r.unsubscribeAll(s.name)
+	if s.community == nil {
+		return
+	}
+	r.communities[s.name] = s.community
+	if s.bans != nil {
+		r.bans[s.name] = s.bans
+	}
+	for _, userID := range s.subscribers {
+		names, ok := r.subscriptions[userID]
+		if !ok {
+			names = make(map[string]struct{})
+			r.subscriptions[userID] = names
+		}
+		names[s.name] = struct{}{}
+	}
+}
+
+// copyCommunity returns a copy sharing nothing that the repo modifies in
+// place. The creator and accept times are only ever replaced.
+func copyCommunity(c *models.Community) *models.Community {
+	res := *c
+	res.Rules = append(make([]string, 0, len(c.Rules)), c.Rules...)
+	res.Moderators = make([]*models.Moderator, len(c.Moderators))
+	for i, m := range c.Moderators {
+		res.Moderators[i] = copyModerator(m)
+	}
+	res.Members = make([]*models.Member, len(c.Members))
+	for i, m := range c.Members {
+		member := *m
+		res.Members[i] = &member
+	}
+	return &res
+}
+
+func copyModerator(m *models.Moderator) *models.Moderator {
+	res := *m
+	res.Permissions = append(make([]string, 0, len(m.Permissions)), m.Permissions...)
+	return &res
+}
+
+func copyBan(b *models.Ban) *models.Ban {
+	res := *b
+	if b.Moderator != nil {
+		moderator := *b.Moderator
+		res.Moderator = &moderator
+	}
+	if b.Expires != nil {
+		expires := *b.Expires
+		res.Expires = &expires
+	}
+	return &res
+}
+
+// sortBans orders bans by community, then oldest first.
+func sortBans(bans []*models.Ban) {
+	sort.Slice(bans, func(i, j int) bool {
+		a, b := bans[i], bans[j]
+		if a.Community != b.Community {
+			return a.Community < b.Community
+		}
+		if !a.Created.Equal(b.Created) {
+			return a.Created.Before(b.Created)
+		}
+		return a.UserID < b.UserID
+	})
+}
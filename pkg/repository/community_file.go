@@ -0,0 +1,245 @@
+package repository
+
+import (
+	"encoding/json"
+	"redditclone/pkg/models"
+	"sync"
+	"time"
+)
+
+const (
+	communityOpPut         = "put"
+	communityOpDelete      = "delete"
+	communityOpSubscribe   = "subscribe"
+	communityOpUnsubscribe = "unsubscribe"
+	communityOpBan         = "ban"
+	communityOpUnban       = "unban"
+)
+
+type (
+	// FileCommunityRepo keeps communities in an InMemoryCommunityRepo and
+	// makes every mutation durable in a journal under its data directory.
+	FileCommunityRepo struct {
+		*InMemoryCommunityRepo
+		journal *journal
+		mu      sync.Mutex
+	}
+
+	// communityRecord carries the whole community as it looked after the
+	// mutation, only its name for deletes, the name and the user for
+	// subscriptions and unbans, or the ban.
+	communityRecord struct {
+		Op        string            `json:"op"`
+		Name      string            `json:"name,omitempty"`
+		UserID    string            `json:"userId,omitempty"`
+		Community *models.Community `json:"community,omitempty"`
+		Ban       *models.Ban       `json:"ban,omitempty"`
+	}
+
+	communitySnapshot struct {
+		Communities []*models.Community `json:"communities"`
+		// Subscriptions holds the subscribed community names by user ID.
+		Subscriptions map[string][]string `json:"subscriptions,omitempty"`
+		Bans          []*models.Ban       `json:"bans,omitempty"`
+	}
+)
+
+var _ CommunityStore = (*FileCommunityRepo)(nil)
+
+// NewFileCommunityRepo opens (or creates) the community journal in dir and
+// replays it.
+func NewFileCommunityRepo(dir string) (*FileCommunityRepo, error) {
+	j, err := openJournal(dir, "communities")
+	if err != nil {
+		return nil, err
+	}
+	repo := &FileCommunityRepo{
+		InMemoryCommunityRepo: NewInMemoryCommunityRepo(),
+		journal:               j,
+	}
+
+	var snap communitySnapshot
+	if err = j.loadSnapshot(&snap); err != nil {
+		return nil, err
+	}
+	for _, c := range snap.Communities {
+		repo.restore(c)
+	}
+	for userID, names := range snap.Subscriptions {
+		for _, name := range names {
+			if err = repo.InMemoryCommunityRepo.Subscribe(name, userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, ban := range snap.Bans {
+		if err = repo.InMemoryCommunityRepo.Ban(ban); err != nil {
+			return nil, err
+		}
+	}
+	err = j.replay(func(data json.RawMessage) error {
+		var rec communityRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return err
+		}
+		switch rec.Op {
+		case communityOpDelete:
+			repo.forget(rec.Name)
+		case communityOpSubscribe:
+			return repo.InMemoryCommunityRepo.Subscribe(rec.Name, rec.UserID)
+		case communityOpUnsubscribe:
+			return repo.InMemoryCommunityRepo.Unsubscribe(rec.Name, rec.UserID)
+		case communityOpBan:
+			return repo.InMemoryCommunityRepo.Ban(rec.Ban)
+		case communityOpUnban:
+			return repo.InMemoryCommunityRepo.Unban(rec.Name, rec.UserID)
+		default:
+			repo.restore(rec.Community)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (f *FileCommunityRepo) Create(community *models.Community) error {
+	return f.update(community.Name, func() (communityRecord, error) {
+		return communityRecord{Op: communityOpPut, Community: community}, f.InMemoryCommunityRepo.Create(community)
+	})
+}
+
+func (f *FileCommunityRepo) Update(community *models.Community) (*models.Community, error) {
+	return f.put(community.Name, func() (*models.Community, error) { return f.InMemoryCommunityRepo.Update(community) })
+}
+
+func (f *FileCommunityRepo) InviteModerator(name string, mod *models.Moderator) (*models.Community, error) {
+	return f.put(name, func() (*models.Community, error) { return f.InMemoryCommunityRepo.InviteModerator(name, mod) })
+}
+
+func (f *FileCommunityRepo) AcceptModerator(name, userID string) (*models.Community, error) {
+	return f.put(name, func() (*models.Community, error) { return f.InMemoryCommunityRepo.AcceptModerator(name, userID) })
+}
+
+func (f *FileCommunityRepo) RemoveModerator(name, userID string) (*models.Community, error) {
+	return f.put(name, func() (*models.Community, error) { return f.InMemoryCommunityRepo.RemoveModerator(name, userID) })
+}
+
+// put applies a mutation and journals the community as it left it.
+func (f *FileCommunityRepo) put(name string, apply func() (*models.Community, error)) (*models.Community, error) {
+	var community *models.Community
+	err := f.update(name, func() (communityRecord, error) {
+		var err error
+		community, err = apply()
+		return communityRecord{Op: communityOpPut, Community: community}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return community, nil
+}
+
+func (f *FileCommunityRepo) Delete(name string) error {
+	return f.update(name, func() (communityRecord, error) {
+		return communityRecord{Op: communityOpDelete, Name: name}, f.InMemoryCommunityRepo.Delete(name)
+	})
+}
+
+func (f *FileCommunityRepo) ApproveMember(name string, member *models.Member) (*models.Community, error) {
+	return f.put(name, func() (*models.Community, error) { return f.InMemoryCommunityRepo.ApproveMember(name, member) })
+}
+
+func (f *FileCommunityRepo) RemoveMember(name, userID string) (*models.Community, error) {
+	return f.put(name, func() (*models.Community, error) { return f.InMemoryCommunityRepo.RemoveMember(name, userID) })
+}
+
+func (f *FileCommunityRepo) Subscribe(name, userID string) error {
+	return f.update(name, func() (communityRecord, error) {
+		return communityRecord{Op: communityOpSubscribe, Name: name, UserID: userID}, f.InMemoryCommunityRepo.Subscribe(name, userID)
+	})
+}
+
+func (f *FileCommunityRepo) Unsubscribe(name, userID string) error {
+	return f.update(name, func() (communityRecord, error) {
+		return communityRecord{Op: communityOpUnsubscribe, Name: name, UserID: userID}, f.InMemoryCommunityRepo.Unsubscribe(name, userID)
+	})
+}
+
+func (f *FileCommunityRepo) Ban(ban *models.Ban) error {
+	return f.update(ban.Community, func() (communityRecord, error) {
+		return communityRecord{Op: communityOpBan, Ban: ban}, f.InMemoryCommunityRepo.Ban(ban)
+	})
+}
+
+func (f *FileCommunityRepo) Unban(name, userID string) error {
+	return f.update(name, func() (communityRecord, error) {
+		return communityRecord{Op: communityOpUnban, Name: name, UserID: userID}, f.InMemoryCommunityRepo.Unban(name, userID)
+	})
+}
+
+// update applies a mutation of the named community and journals the record
+// it returns. If the record can't be written the community, its bans and
+// its subscribers are put back as they were.
+func (f *FileCommunityRepo) update(name string, apply func() (communityRecord, error)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prev := f.InMemoryCommunityRepo.state(name)
+	rec, err := apply()
+	if err != nil {
+		return err
+	}
+	return f.log(rec, func() { f.reset(prev) })
+}
+
+// ExpireBans journals an unban for every expired ban. When that fails the
+// bans not journaled yet are put back, the next sweep expires them.
+func (f *FileCommunityRepo) ExpireBans(now time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	expired := f.expireBans(now)
+	for i, ban := range expired {
+		rec := communityRecord{Op: communityOpUnban, Name: ban.Community, UserID: ban.UserID}
+		if err := f.log(rec, func() { f.InMemoryCommunityRepo.Ban(ban) }); err != nil {
+			for _, ban := range expired[i+1:] {
+				f.InMemoryCommunityRepo.Ban(ban)
+			}
+			return i, err
+		}
+	}
+	return len(expired), nil
+}
+
+// Compact folds the journal into a fresh snapshot.
+func (f *FileCommunityRepo) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.compact()
+}
+
+// Close compacts the journal and releases the log file.
+func (f *FileCommunityRepo) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.compact(); err != nil {
+		return err
+	}
+	return f.journal.close()
+}
+
+// log journals rec, see journal.commit.
+func (f *FileCommunityRepo) log(rec communityRecord, undo func()) error {
+	return f.journal.commit(rec, true, undo, f.compact)
+}
+
+func (f *FileCommunityRepo) compact() error {
+	communities, err := f.InMemoryCommunityRepo.List()
+	if err != nil {
+		return err
+	}
+	return f.journal.compact(communitySnapshot{
+		Communities:   communities,
+		Subscriptions: f.subscribers(),
+		Bans:          f.allBans(),
+	})
+}
@@ -0,0 +1,502 @@
+package repository
+
+import (
+	"database/sql"
+	"redditclone/pkg/models"
+	"strings"
+	"time"
+)
+
+const (
+	communityColumns = `name, title, description, creator_id, creator_username, created, visibility`
+	banColumns       = `community_name, user_id, username, reason, note, moderator_id, moderator_username, created, expires`
+)
+
+type (
+	SQLCommunityRepo struct {
+		db *SQLDB
+	}
+)
+
+var _ CommunityStore = (*SQLCommunityRepo)(nil)
+
+func NewSQLCommunityRepo(db *SQLDB) *SQLCommunityRepo {
+	return &SQLCommunityRepo{db: db}
+}
+
+func (r *SQLCommunityRepo) Create(community *models.Community) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow(r.db.Rebind(`SELECT COUNT(*) FROM communities WHERE name = ?`), community.Name).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return ErrCommunityExists
+	}
+	creator := community.Creator
+	if creator == nil {
+		creator = &models.Author{}
+	}
+	_, err = tx.Exec(r.db.Rebind(`INSERT INTO communities (`+communityColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		community.Name, community.Title, community.Description, creator.ID, creator.Username, community.Created,
+		visibility(community))
+	if err != nil {
+		return err
+	}
+	if err = r.insertRules(tx, community); err != nil {
+		return err
+	}
+	for _, mod := range community.Moderators {
+		if err = r.insertModerator(tx, community.Name, mod); err != nil {
+			return err
+		}
+	}
+	for _, member := range community.Members {
+		if err = r.insertMember(tx, community.Name, member); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SQLCommunityRepo) GetByName(name string) (*models.Community, error) {
+	communities, err := r.query(r.db, `SELECT `+communityColumns+` FROM communities WHERE name = ?`, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(communities) == 0 {
+		return nil, ErrCommunityNotFound
+	}
+	return communities[0], nil
+}
+
+func (r *SQLCommunityRepo) List() ([]*models.Community, error) {
+	return r.query(r.db, `SELECT `+communityColumns+` FROM communities ORDER BY name`)
+}
+
+func (r *SQLCommunityRepo) Update(community *models.Community) (*models.Community, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(r.db.Rebind(`UPDATE communities SET title = ?, description = ?, visibility = ? WHERE name = ?`),
+		community.Title, community.Description, visibility(community), community.Name)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, ErrCommunityNotFound
+	}
+	if _, err = tx.Exec(r.db.Rebind(`DELETE FROM community_rules WHERE community_name = ?`), community.Name); err != nil {
+		return nil, err
+	}
+	if err = r.insertRules(tx, community); err != nil {
+		return nil, err
+	}
+	communities, err := r.query(tx, `SELECT `+communityColumns+` FROM communities WHERE name = ?`, community.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return communities[0], nil
+}
+
+func (r *SQLCommunityRepo) Delete(name string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM community_subscriptions WHERE community_name = ?`,
+		`DELETE FROM community_bans WHERE community_name = ?`,
+		`DELETE FROM community_members WHERE community_name = ?`,
+		`DELETE FROM community_moderators WHERE community_name = ?`,
+		`DELETE FROM community_rules WHERE community_name = ?`,
+	} {
+		if _, err = tx.Exec(r.db.Rebind(query), name); err != nil {
+			return err
+		}
+	}
+	res, err := tx.Exec(r.db.Rebind(`DELETE FROM communities WHERE name = ?`), name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrCommunityNotFound
+	}
+	return tx.Commit()
+}
+
+func (r *SQLCommunityRepo) InviteModerator(name string, mod *models.Moderator) (*models.Community, error) {
+	return r.change(name, func(tx *sql.Tx) error {
+		res, err := tx.Exec(r.db.Rebind(`UPDATE community_moderators SET permissions = ? WHERE community_name = ? AND user_id = ?`),
+			strings.Join(mod.Permissions, ","), name, mod.UserID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n > 0 {
+			return err
+		}
+		return r.insertModerator(tx, name, mod)
+	})
+}
+
+func (r *SQLCommunityRepo) AcceptModerator(name, userID string) (*models.Community, error) {
+	return r.change(name, func(tx *sql.Tx) error {
+		res, err := tx.Exec(r.db.Rebind(`UPDATE community_moderators SET accepted = ? WHERE community_name = ? AND user_id = ? AND accepted IS NULL`),
+			time.Now(), name, userID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrInviteNotFound
+		}
+		return err
+	})
+}
+
+func (r *SQLCommunityRepo) RemoveModerator(name, userID string) (*models.Community, error) {
+	return r.change(name, func(tx *sql.Tx) error {
+		res, err := tx.Exec(r.db.Rebind(`DELETE FROM community_moderators WHERE community_name = ? AND user_id = ?`), name, userID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrModeratorNotFound
+		}
+		return err
+	})
+}
+
+func (r *SQLCommunityRepo) ApproveMember(name string, member *models.Member) (*models.Community, error) {
+	return r.change(name, func(tx *sql.Tx) error {
+		var exists int
+		err := tx.QueryRow(r.db.Rebind(`SELECT COUNT(*) FROM community_members WHERE community_name = ? AND user_id = ?`),
+			name, member.UserID).Scan(&exists)
+		if err != nil || exists > 0 {
+			return err
+		}
+		return r.insertMember(tx, name, member)
+	})
+}
+
+func (r *SQLCommunityRepo) RemoveMember(name, userID string) (*models.Community, error) {
+	return r.change(name, func(tx *sql.Tx) error {
+		res, err := tx.Exec(r.db.Rebind(`DELETE FROM community_members WHERE community_name = ? AND user_id = ?`), name, userID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrMemberNotFound
+		}
+		return err
+	})
+}
+
+func (r *SQLCommunityRepo) Ban(ban *models.Ban) error {
+	_, err := r.change(ban.Community, func(tx *sql.Tx) error {
+		_, err := tx.Exec(r.db.Rebind(`DELETE FROM community_bans WHERE community_name = ? AND user_id = ?`), ban.Community, ban.UserID)
+		if err != nil {
+			return err
+		}
+		moderator := ban.Moderator
+		if moderator == nil {
+			moderator = &models.Author{}
+		}
+		var expires sql.NullTime
+		if ban.Expires != nil {
+			expires = sql.NullTime{Time: ban.Expires.UTC(), Valid: true}
+		}
+		_, err = tx.Exec(r.db.Rebind(`INSERT INTO community_bans (`+banColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			ban.Community, ban.UserID, ban.Username, ban.Reason, ban.Note, moderator.ID, moderator.Username, ban.Created, expires)
+		return err
+	})
+	return err
+}
+
+func (r *SQLCommunityRepo) Unban(name, userID string) error {
+	_, err := r.change(name, func(tx *sql.Tx) error {
+		res, err := tx.Exec(r.db.Rebind(`DELETE FROM community_bans WHERE community_name = ? AND user_id = ?`), name, userID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrBanNotFound
+		}
+		return err
+	})
+	return err
+}
+
+func (r *SQLCommunityRepo) GetBan(name, userID string) (*models.Ban, error) {
+	bans, err := r.queryBans(`SELECT `+banColumns+` FROM community_bans WHERE community_name = ? AND user_id = ?`, name, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(bans) > 0 {
+		return bans[0], nil
+	}
+	if _, err = r.GetByName(name); err != nil {
+		return nil, err
+	}
+	return nil, ErrBanNotFound
+}
+
+func (r *SQLCommunityRepo) Bans(name string) ([]*models.Ban, error) {
+	if _, err := r.GetByName(name); err != nil {
+		return nil, err
+	}
+	return r.queryBans(`SELECT `+banColumns+` FROM community_bans WHERE community_name = ? ORDER BY created, user_id`, name)
+}
+
+func (r *SQLCommunityRepo) ExpireBans(now time.Time) (int, error) {
+	res, err := r.db.Exec(r.db.Rebind(`DELETE FROM community_bans WHERE expires IS NOT NULL AND expires <= ?`), now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (r *SQLCommunityRepo) queryBans(query string, args ...interface{}) ([]*models.Ban, error) {
+	rows, err := r.db.Query(r.db.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := make([]*models.Ban, 0)
+	for rows.Next() {
+		ban := &models.Ban{Moderator: &models.Author{}}
+		var expires sql.NullTime
+		err = rows.Scan(&ban.Community, &ban.UserID, &ban.Username, &ban.Reason, &ban.Note,
+			&ban.Moderator.ID, &ban.Moderator.Username, &ban.Created, &expires)
+		if err != nil {
+			return nil, err
+		}
+		if ban.Moderator.ID == "" {
+			ban.Moderator = nil
+		}
+		if expires.Valid {
+			ban.Expires = &expires.Time
+		}
+		bans = append(bans, ban)
+	}
+	return bans, rows.Err()
+}
+
+func (r *SQLCommunityRepo) Subscribe(name, userID string) error {
+	_, err := r.change(name, func(tx *sql.Tx) error {
+		var exists int
+		err := tx.QueryRow(r.db.Rebind(`SELECT COUNT(*) FROM community_subscriptions WHERE user_id = ? AND community_name = ?`),
+			userID, name).Scan(&exists)
+		if err != nil || exists > 0 {
+			return err
+		}
+		_, err = tx.Exec(r.db.Rebind(`INSERT INTO community_subscriptions (user_id, community_name, subscribed) VALUES (?, ?, ?)`),
+			userID, name, time.Now())
+		return err
+	})
+	return err
+}
+
+func (r *SQLCommunityRepo) Unsubscribe(name, userID string) error {
+	_, err := r.change(name, func(tx *sql.Tx) error {
+		_, err := tx.Exec(r.db.Rebind(`DELETE FROM community_subscriptions WHERE user_id = ? AND community_name = ?`), userID, name)
+		return err
+	})
+	return err
+}
+
+func (r *SQLCommunityRepo) Subscriptions(userID string) ([]*models.Community, error) {
+	return r.query(r.db, `SELECT `+communityColumns+` FROM communities WHERE name IN (SELECT community_name FROM community_subscriptions WHERE user_id = ?) ORDER BY name`, userID)
+}
+
+// change runs apply in a transaction on an existing community and returns
+// the community as apply left it.
+func (r *SQLCommunityRepo) change(name string, apply func(tx *sql.Tx) error) (*models.Community, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow(r.db.Rebind(`SELECT COUNT(*) FROM communities WHERE name = ?`), name).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, ErrCommunityNotFound
+	}
+	if err = apply(tx); err != nil {
+		return nil, err
+	}
+	communities, err := r.query(tx, `SELECT `+communityColumns+` FROM communities WHERE name = ?`, name)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return communities[0], nil
+}
+
+func (r *SQLCommunityRepo) insertModerator(q sqlQueryer, name string, mod *models.Moderator) error {
+	var accepted sql.NullTime
+	if mod.Accepted != nil {
+		accepted = sql.NullTime{Time: *mod.Accepted, Valid: true}
+	}
+	_, err := q.Exec(r.db.Rebind(`INSERT INTO community_moderators (community_name, user_id, username, permissions, invited, accepted) VALUES (?, ?, ?, ?, ?, ?)`),
+		name, mod.UserID, mod.Username, strings.Join(mod.Permissions, ","), mod.Invited, accepted)
+	return err
+}
+
+func (r *SQLCommunityRepo) insertMember(q sqlQueryer, name string, member *models.Member) error {
+	_, err := q.Exec(r.db.Rebind(`INSERT INTO community_members (community_name, user_id, username, approved) VALUES (?, ?, ?, ?)`),
+		name, member.UserID, member.Username, member.Approved)
+	return err
+}
+
+func (r *SQLCommunityRepo) insertRules(q sqlQueryer, community *models.Community) error {
+	for i, rule := range community.Rules {
+		_, err := q.Exec(r.db.Rebind(`INSERT INTO community_rules (community_name, position, rule) VALUES (?, ?, ?)`),
+			community.Name, i, rule)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// query loads the communities selected by query together with their rules,
+// moderators and members.
+func (r *SQLCommunityRepo) query(q sqlQueryer, query string, args ...interface{}) ([]*models.Community, error) {
+	rows, err := q.Query(r.db.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	communities := make([]*models.Community, 0)
+	byName := make(map[string]*models.Community)
+	for rows.Next() {
+		c := &models.Community{
+			Creator:    &models.Author{},
+			Rules:      make([]string, 0),
+			Moderators: make([]*models.Moderator, 0),
+			Members:    make([]*models.Member, 0),
+		}
+		err = rows.Scan(&c.Name, &c.Title, &c.Description, &c.Creator.ID, &c.Creator.Username, &c.Created, &c.Visibility)
+		if err != nil {
+			return nil, err
+		}
+		if c.Creator.ID == "" {
+			c.Creator = nil
+		}
+		communities = append(communities, c)
+		byName[c.Name] = c
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	names := make([]string, 0, len(communities))
+	for _, c := range communities {
+		names = append(names, c.Name)
+	}
+	for start := 0; start < len(names); start += sqlChunk {
+		end := min(start+sqlChunk, len(names))
+		if err = r.loadRules(q, byName, names[start:end]); err != nil {
+			return nil, err
+		}
+		if err = r.loadModerators(q, byName, names[start:end]); err != nil {
+			return nil, err
+		}
+		if err = r.loadMembers(q, byName, names[start:end]); err != nil {
+			return nil, err
+		}
+	}
+	return communities, nil
+}
+
+func (r *SQLCommunityRepo) loadRules(q sqlQueryer, byName map[string]*models.Community, names []string) error {
+	rows, err := q.Query(r.db.Rebind(`SELECT community_name, rule FROM community_rules WHERE community_name IN (`+placeholders(len(names))+`) ORDER BY community_name, position`),
+		stringArgs(names)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, rule string
+		if err = rows.Scan(&name, &rule); err != nil {
+			return err
+		}
+		byName[name].Rules = append(byName[name].Rules, rule)
+	}
+	return rows.Err()
+}
+
+func (r *SQLCommunityRepo) loadModerators(q sqlQueryer, byName map[string]*models.Community, names []string) error {
+	rows, err := q.Query(r.db.Rebind(`SELECT community_name, user_id, username, permissions, invited, accepted FROM community_moderators WHERE community_name IN (`+placeholders(len(names))+`) ORDER BY community_name, invited, user_id`),
+		stringArgs(names)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, permissions string
+		var accepted sql.NullTime
+		mod := &models.Moderator{Permissions: make([]string, 0)}
+		if err = rows.Scan(&name, &mod.UserID, &mod.Username, &permissions, &mod.Invited, &accepted); err != nil {
+			return err
+		}
+		if permissions != "" {
+			mod.Permissions = strings.Split(permissions, ",")
+		}
+		if accepted.Valid {
+			mod.Accepted = &accepted.Time
+		}
+		byName[name].Moderators = append(byName[name].Moderators, mod)
+	}
+	return rows.Err()
+}
+
+func (r *SQLCommunityRepo) loadMembers(q sqlQueryer, byName map[string]*models.Community, names []string) error {
+	rows, err := q.Query(r.db.Rebind(`SELECT community_name, user_id, username, approved FROM community_members WHERE community_name IN (`+placeholders(len(names))+`) ORDER BY community_name, approved, user_id`),
+		stringArgs(names)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		member := &models.Member{}
+		if err = rows.Scan(&name, &member.UserID, &member.Username, &member.Approved); err != nil {
+			return err
+		}
+		byName[name].Members = append(byName[name].Members, member)
+	}
+	return rows.Err()
+}
+
+// visibility stores communities created without a visibility as public.
+func visibility(c *models.Community) string {
+	if c.Visibility == "" {
+		return models.VisibilityPublic
+	}
+	return c.Visibility
+}
@@ -0,0 +1,511 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"redditclone/pkg/models"
+	"sort"
+	"testing"
+	"time"
+)
+
+var (
+	fileAlice = &models.Session{ID: "alice-session", UserID: "alice-id", Username: "alice"}
+	fileBob   = &models.Session{ID: "bob-session", UserID: "bob-id", Username: "bob"}
+)
+
+func fileTextPost(title string) PostRequest {
+	return PostRequest{Category: "music", Title: title, Text: "text", Type: "text"}
+}
+
+// encode renders state as JSON, so replayed state compares equal to what
+// was written even though times lose their monotonic reading.
+func encode(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func mustOK(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// breakJournal swaps the log for a read-only handle on the same file, so
+// appends fail until the returned func puts the log back.
+func breakJournal(t *testing.T, j *journal) func() {
+	t.Helper()
+	ro, err := os.Open(j.walPath())
+	mustOK(t, err)
+	if _, err = ro.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	wal := j.wal
+	j.wal = ro
+	return func() {
+		ro.Close()
+		j.wal = wal
+	}
+}
+
+// checkRollback runs mutate against a broken journal and checks that it
+// fails and leaves state as it was.
+func checkRollback(t *testing.T, j *journal, state func() string, mutate func() error) {
+	t.Helper()
+	before := state()
+	restore := breakJournal(t, j)
+	defer restore()
+	if err := mutate(); err == nil {
+		t.Fatal("mutation succeeded although the journal append failed")
+	}
+	if after := state(); after != before {
+		t.Fatalf("state after failed append:\n%s\nwant:\n%s", after, before)
+	}
+}
+
+func openPosts(t *testing.T, dir string) *FilePostRepo {
+	t.Helper()
+	repo, err := NewFilePostRepo(dir)
+	mustOK(t, err)
+	return repo
+}
+
+func postsState(t *testing.T, repo *FilePostRepo) string {
+	t.Helper()
+	posts, err := repo.ListAll()
+	mustOK(t, err)
+	return encode(t, postSnapshot{
+		Posts:            posts,
+		PostRevisions:    repo.livePostRevisions(),
+		CommentRevisions: repo.liveCommentRevisions(),
+	})
+}
+
+// writePosts runs every kind of post mutation.
+func writePosts(t *testing.T, repo *FilePostRepo) *models.Post {
+	t.Helper()
+	post, err := repo.Create(fileTextPost("first"), fileAlice)
+	mustOK(t, err)
+	post, err = repo.AddCommentToPost("root", post.ID, fileBob)
+	mustOK(t, err)
+	root := post.Comments[0]
+	post, err = repo.ReplyToComment("reply", post.ID, root.ID, fileAlice)
+	mustOK(t, err)
+	reply := post.Comments[1]
+	_, err = repo.AddCommentToPost("gone", post.ID, fileBob)
+	mustOK(t, err)
+	_, err = repo.UpVote(post.ID, fileBob.UserID)
+	mustOK(t, err)
+	_, err = repo.DownVoteComment(post.ID, reply.ID, fileBob.UserID)
+	mustOK(t, err)
+	_, err = repo.EditComment(post.ID, reply.ID, "reply, edited")
+	mustOK(t, err)
+	_, err = repo.EditPost(post.ID, "first, edited", "more text")
+	mustOK(t, err)
+	_, err = repo.ListByID(post.ID)
+	mustOK(t, err)
+	post, err = repo.ListByID(post.ID)
+	mustOK(t, err)
+	_, err = repo.DeleteComment(post.Comments[2].ID, post.ID)
+	mustOK(t, err)
+	// A comment with replies stays as a tombstone.
+	_, err = repo.DeleteComment(root.ID, post.ID)
+	mustOK(t, err)
+
+	gone, err := repo.Create(fileTextPost("gone"), fileBob)
+	mustOK(t, err)
+	mustOK(t, repo.DeletePost(gone.ID))
+	return post
+}
+
+func TestFilePostRepoReplay(t *testing.T) {
+	dir := t.TempDir()
+	repo := openPosts(t, dir)
+	post := writePosts(t, repo)
+	want := postsState(t, repo)
+
+	// The first repo is dropped without Close, as if the process died.
+	reopened := openPosts(t, dir)
+	if got := postsState(t, reopened); got != want {
+		t.Fatalf("replayed state:\n%s\nwant:\n%s", got, want)
+	}
+	got, err := reopened.GetByID(post.ID)
+	mustOK(t, err)
+	if got.Views != 2 {
+		t.Errorf("Views = %d, want 2", got.Views)
+	}
+	if tomb := got.Comments[0]; !tomb.Deleted || tomb.Author == nil || tomb.Author.Username != models.DeletedCommentAuthor {
+		t.Errorf("tombstone = %+v", tomb)
+	}
+}
+
+func TestFilePostRepoLegacyViewRecord(t *testing.T) {
+	dir := t.TempDir()
+	repo := openPosts(t, dir)
+	post, err := repo.Create(fileTextPost("first"), fileAlice)
+	mustOK(t, err)
+	// Views used to be journaled with the whole post.
+	post.Views = 3
+	mustOK(t, repo.journal.append(postRecord{Op: postOpView, Post: post}, true))
+
+	got, err := openPosts(t, dir).GetByID(post.ID)
+	mustOK(t, err)
+	if got.Views != 3 {
+		t.Fatalf("Views = %d, want 3", got.Views)
+	}
+}
+
+func TestJournalTornTail(t *testing.T) {
+	dir := t.TempDir()
+	repo := openPosts(t, dir)
+	writePosts(t, repo)
+	want := postsState(t, repo)
+	info, err := os.Stat(repo.journal.walPath())
+	mustOK(t, err)
+
+	f, err := os.OpenFile(repo.journal.walPath(), os.O_APPEND|os.O_WRONLY, 0)
+	mustOK(t, err)
+	_, err = f.WriteString(`1a2b3c {"op":"create","post":{"id":`)
+	mustOK(t, err)
+	mustOK(t, f.Close())
+
+	reopened := openPosts(t, dir)
+	if got := postsState(t, reopened); got != want {
+		t.Fatalf("state after torn tail:\n%s\nwant:\n%s", got, want)
+	}
+	after, err := os.Stat(reopened.journal.walPath())
+	mustOK(t, err)
+	if after.Size() != info.Size() {
+		t.Fatalf("log is %d bytes, want the torn record cut back to %d", after.Size(), info.Size())
+	}
+
+	// The log keeps working after the cut.
+	_, err = reopened.Create(fileTextPost("after"), fileAlice)
+	mustOK(t, err)
+	want = postsState(t, reopened)
+	if got := postsState(t, openPosts(t, dir)); got != want {
+		t.Fatalf("state after appending past the cut:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestJournalCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	repo := openPosts(t, dir)
+	for _, title := range []string{"one", "two", "three"} {
+		_, err := repo.Create(fileTextPost(title), fileAlice)
+		mustOK(t, err)
+	}
+
+	data, err := os.ReadFile(repo.journal.walPath())
+	mustOK(t, err)
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	lines[1] = bytes.Replace(lines[1], []byte(`"two"`), []byte(`"tw0"`), 1)
+	mustOK(t, os.WriteFile(repo.journal.walPath(), bytes.Join(lines, nil), 0o644))
+
+	if _, err = NewFilePostRepo(dir); !errors.Is(err, errCorruptJournal) {
+		t.Fatalf("NewFilePostRepo: err = %v, want errCorruptJournal", err)
+	}
+}
+
+func TestJournalRewind(t *testing.T) {
+	dir := t.TempDir()
+	repo := openPosts(t, dir)
+	_, err := repo.Create(fileTextPost("one"), fileAlice)
+	mustOK(t, err)
+
+	// Half a record, as a failed write might leave it.
+	end, err := repo.journal.wal.Seek(0, io.SeekCurrent)
+	mustOK(t, err)
+	_, err = repo.journal.wal.WriteString(`1a2b3c {"op":"crea`)
+	mustOK(t, err)
+	errWrite := errors.New("write failed")
+	if err = repo.journal.rewind(end, errWrite); err != errWrite {
+		t.Fatalf("rewind: err = %v, want the write error", err)
+	}
+	info, err := os.Stat(repo.journal.walPath())
+	mustOK(t, err)
+	if info.Size() != end {
+		t.Fatalf("log is %d bytes after rewind, want %d", info.Size(), end)
+	}
+
+	_, err = repo.Create(fileTextPost("two"), fileAlice)
+	mustOK(t, err)
+	want := postsState(t, repo)
+	if got := postsState(t, openPosts(t, dir)); got != want {
+		t.Fatalf("state after rewind:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestJournalCommitCompactionFailure(t *testing.T) {
+	repo := openPosts(t, t.TempDir())
+	repo.journal.appended = journalCompactEvery - 1
+	undone := false
+	err := repo.journal.commit(postRecord{Op: postOpView, ID: "x", Views: 1}, false,
+		func() { undone = true },
+		func() error { return errors.New("disk full") })
+	// The record is in the log, the mutation stays committed.
+	if err != nil || undone {
+		t.Fatalf("commit: err = %v, undone = %v, want nil and false", err, undone)
+	}
+}
+
+func TestFilePostRepoCompact(t *testing.T) {
+	dir := t.TempDir()
+	repo := openPosts(t, dir)
+	post := writePosts(t, repo)
+	mustOK(t, repo.Compact())
+
+	info, err := os.Stat(repo.journal.walPath())
+	mustOK(t, err)
+	if info.Size() != 0 {
+		t.Fatalf("log is %d bytes after compaction, want 0", info.Size())
+	}
+	if _, err = os.Stat(repo.journal.snapshotPath()); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	// Records after the snapshot are replayed on top of it.
+	_, err = repo.UnVote(post.ID, fileBob.UserID)
+	mustOK(t, err)
+
+	want := postsState(t, repo)
+	if got := postsState(t, openPosts(t, dir)); got != want {
+		t.Fatalf("state after compaction:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFilePostRepoCompactsOnItsOwn(t *testing.T) {
+	dir := t.TempDir()
+	repo := openPosts(t, dir)
+	post, err := repo.Create(fileTextPost("first"), fileAlice)
+	mustOK(t, err)
+	for i := 0; i < journalCompactEvery; i++ {
+		_, err = repo.ListByID(post.ID)
+		mustOK(t, err)
+	}
+	if repo.journal.appended >= journalCompactEvery {
+		t.Fatalf("%d records in the log, want a compaction", repo.journal.appended)
+	}
+
+	got, err := openPosts(t, dir).GetByID(post.ID)
+	mustOK(t, err)
+	if got.Views != journalCompactEvery {
+		t.Fatalf("Views = %d, want %d", got.Views, journalCompactEvery)
+	}
+}
+
+func TestFilePostRepoRollback(t *testing.T) {
+	dir := t.TempDir()
+	repo := openPosts(t, dir)
+	post := writePosts(t, repo)
+	reply := post.Comments[1]
+	state := func() string { return postsState(t, repo) }
+
+	tests := []struct {
+		name   string
+		mutate func() error
+	}{
+		{"Create", func() error { _, err := repo.Create(fileTextPost("new"), fileAlice); return err }},
+		{"ListByID", func() error { _, err := repo.ListByID(post.ID); return err }},
+		{"AddCommentToPost", func() error { _, err := repo.AddCommentToPost("new", post.ID, fileBob); return err }},
+		{"ReplyToComment", func() error { _, err := repo.ReplyToComment("new", post.ID, reply.ID, fileBob); return err }},
+		{"DeleteComment", func() error { _, err := repo.DeleteComment(reply.ID, post.ID); return err }},
+		{"UpVote", func() error { _, err := repo.UpVote(post.ID, "carol-id"); return err }},
+		{"DownVote", func() error { _, err := repo.DownVote(post.ID, fileBob.UserID); return err }},
+		{"UnVote", func() error { _, err := repo.UnVote(post.ID, fileBob.UserID); return err }},
+		{"UpVoteComment", func() error { _, err := repo.UpVoteComment(post.ID, reply.ID, fileBob.UserID); return err }},
+		{"EditComment", func() error { _, err := repo.EditComment(post.ID, reply.ID, "again"); return err }},
+		{"EditPost", func() error { _, err := repo.EditPost(post.ID, "again", "again"); return err }},
+		{"DeletePost", func() error { return repo.DeletePost(post.ID) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkRollback(t, repo.journal, state, tt.mutate)
+		})
+	}
+
+	// Nothing of the failed mutations reached the log.
+	want := state()
+	if got := postsState(t, openPosts(t, dir)); got != want {
+		t.Fatalf("replayed state:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func usersState(t *testing.T, repo *FileUserRepo) string {
+	t.Helper()
+	users := repo.list()
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return encode(t, users)
+}
+
+func TestFileUserRepo(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := NewFileUserRepo(dir)
+	mustOK(t, err)
+	_, err = repo.Create("alice", "hash")
+	mustOK(t, err)
+	_, err = repo.Create("bob", "hash")
+	mustOK(t, err)
+	mustOK(t, repo.SetRole("bob", models.RoleModerator))
+
+	state := func() string { return usersState(t, repo) }
+	t.Run("Rollback", func(t *testing.T) {
+		checkRollback(t, repo.journal, state, func() error { _, err := repo.Create("carol", "hash"); return err })
+		checkRollback(t, repo.journal, state, func() error { return repo.SetRole("alice", models.RoleAdmin) })
+	})
+
+	want := state()
+	reopened, err := NewFileUserRepo(dir)
+	mustOK(t, err)
+	if got := usersState(t, reopened); got != want {
+		t.Fatalf("replayed users:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func sessionsState(t *testing.T, repo *FileSessionRepo) string {
+	t.Helper()
+	sessions := repo.list()
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return encode(t, sessions)
+}
+
+func TestFileSessionRepo(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := NewFileSessionRepo(dir)
+	mustOK(t, err)
+	alice := &models.User{ID: "alice-id", Username: "alice"}
+	kept, err := repo.Create(alice, models.SessionInfo{Device: "phone"})
+	mustOK(t, err)
+	gone, err := repo.Create(alice, models.SessionInfo{Device: "laptop"})
+	mustOK(t, err)
+	mustOK(t, repo.Delete(gone.ID))
+
+	state := func() string { return sessionsState(t, repo) }
+	t.Run("Rollback", func(t *testing.T) {
+		checkRollback(t, repo.journal, state, func() error { _, err := repo.Create(alice, models.SessionInfo{}); return err })
+		checkRollback(t, repo.journal, state, func() error { return repo.Delete(kept.ID) })
+		// Only a touch after sessionTouchInterval is journaled.
+		repo.restore(&models.Session{ID: "stale", UserID: alice.ID, Username: alice.Username, LastSeen: time.Now().Add(-time.Hour)})
+		checkRollback(t, repo.journal, state, func() error { _, err := repo.Touch("stale"); return err })
+		repo.forget("stale")
+	})
+
+	want := state()
+	reopened, err := NewFileSessionRepo(dir)
+	mustOK(t, err)
+	if got := sessionsState(t, reopened); got != want {
+		t.Fatalf("replayed sessions:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func tokensState(t *testing.T, repo *FileRefreshTokenRepo) string {
+	t.Helper()
+	tokens := repo.live()
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Hash < tokens[j].Hash })
+	return encode(t, tokens)
+}
+
+func TestFileRefreshTokenRepo(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := NewFileRefreshTokenRepo(dir)
+	mustOK(t, err)
+	token := func(hash, sessionID string) *models.RefreshToken {
+		now := time.Now()
+		return &models.RefreshToken{Hash: hash, SessionID: sessionID, UserID: "alice-id", Created: now, Expires: now.Add(time.Hour)}
+	}
+	mustOK(t, repo.Create(token("a1", "a")))
+	mustOK(t, repo.Create(token("a2", "a")))
+	mustOK(t, repo.Create(token("b1", "b")))
+	_, err = repo.MarkUsed("a1")
+	mustOK(t, err)
+	mustOK(t, repo.Create(token("c1", "c")))
+	mustOK(t, repo.RevokeFamily("c"))
+
+	state := func() string { return tokensState(t, repo) }
+	t.Run("Rollback", func(t *testing.T) {
+		checkRollback(t, repo.journal, state, func() error { return repo.Create(token("d1", "d")) })
+		checkRollback(t, repo.journal, state, func() error { _, err := repo.MarkUsed("a2"); return err })
+		checkRollback(t, repo.journal, state, func() error { return repo.RevokeFamily("a") })
+	})
+
+	want := state()
+	reopened, err := NewFileRefreshTokenRepo(dir)
+	mustOK(t, err)
+	if got := tokensState(t, reopened); got != want {
+		t.Fatalf("replayed tokens:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func communitiesState(t *testing.T, repo *FileCommunityRepo) string {
+	t.Helper()
+	communities, err := repo.List()
+	mustOK(t, err)
+	return encode(t, communitySnapshot{
+		Communities:   communities,
+		Subscriptions: repo.subscribers(),
+		Bans:          repo.allBans(),
+	})
+}
+
+func TestFileCommunityRepo(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := NewFileCommunityRepo(dir)
+	mustOK(t, err)
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	mustOK(t, repo.Create(&models.Community{Name: "club", Title: "Club", Created: now, Visibility: models.VisibilityPrivate}))
+	mustOK(t, repo.Create(&models.Community{Name: "gone", Title: "Gone", Created: now}))
+	_, err = repo.InviteModerator("club", &models.Moderator{UserID: "bob-id", Username: "bob", Permissions: []string{models.PermBanUsers}, Invited: now})
+	mustOK(t, err)
+	_, err = repo.AcceptModerator("club", "bob-id")
+	mustOK(t, err)
+	_, err = repo.ApproveMember("club", &models.Member{UserID: "carol-id", Username: "carol", Approved: now})
+	mustOK(t, err)
+	mustOK(t, repo.Subscribe("club", "carol-id"))
+	mustOK(t, repo.Subscribe("gone", "carol-id"))
+	mustOK(t, repo.Ban(&models.Ban{Community: "club", UserID: "dave-id", Username: "dave", Reason: "spam", Created: now}))
+	mustOK(t, repo.Ban(&models.Ban{Community: "club", UserID: "erin-id", Username: "erin", Created: now, Expires: &past}))
+	mustOK(t, repo.Delete("gone"))
+
+	state := func() string { return communitiesState(t, repo) }
+	t.Run("Rollback", func(t *testing.T) {
+		checkRollback(t, repo.journal, state, func() error {
+			return repo.Create(&models.Community{Name: "new", Title: "New", Created: now})
+		})
+		checkRollback(t, repo.journal, state, func() error {
+			_, err := repo.RemoveMember("club", "carol-id")
+			return err
+		})
+		checkRollback(t, repo.journal, state, func() error { return repo.Unsubscribe("club", "carol-id") })
+		checkRollback(t, repo.journal, state, func() error { return repo.Unban("club", "dave-id") })
+		checkRollback(t, repo.journal, state, func() error {
+			n, err := repo.ExpireBans(now)
+			if n != 0 {
+				t.Errorf("ExpireBans: %d journaled, want 0", n)
+			}
+			return err
+		})
+		// Deleting takes the bans and subscriptions along, all come back.
+		checkRollback(t, repo.journal, state, func() error { return repo.Delete("club") })
+	})
+
+	n, err := repo.ExpireBans(now)
+	mustOK(t, err)
+	if n != 1 {
+		t.Fatalf("ExpireBans = %d, want 1", n)
+	}
+
+	want := state()
+	reopened, err := NewFileCommunityRepo(dir)
+	mustOK(t, err)
+	if got := communitiesState(t, reopened); got != want {
+		t.Fatalf("replayed communities:\n%s\nwant:\n%s", got, want)
+	}
+}
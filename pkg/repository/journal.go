@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// journalCompactEvery is the number of appended records after which the
+// journal owner is asked to write a fresh snapshot.
+const journalCompactEvery = 1000
+
+var errCorruptJournal = errors.New("journal is corrupt")
+
+// journal is an append-only write-ahead log with a snapshot next to it.
+//
+// Every record is written as a single line "<crc32> <json>\n" and fsynced
+// before append returns. On open the snapshot is loaded first and then the
+// log is replayed on top of it. A torn record at the tail of the log (the
+// process died mid-write) is truncated away, corruption anywhere else is
+// reported as an error.
+//
+// Records must be idempotent (full record puts and deletes), so replaying
+// a log that was already folded into the snapshot is harmless. This is what
+// makes compaction crash-safe: the snapshot is atomically replaced first and
+// the log is truncated afterwards.
+type journal struct {
+	dir      string
+	name     string
+	wal      *os.File
+	appended int
+}
+
+func openJournal(dir, name string) (*journal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &journal{dir: dir, name: name}, nil
+}
+
+func (j *journal) snapshotPath() string {
+	return filepath.Join(j.dir, j.name+".snapshot")
+}
+
+func (j *journal) walPath() string {
+	return filepath.Join(j.dir, j.name+".wal")
+}
+
+// loadSnapshot decodes the last snapshot into snap. A missing snapshot
+// leaves snap untouched.
+func (j *journal) loadSnapshot(snap interface{}) error {
+	data, err := os.ReadFile(j.snapshotPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, snap); err != nil {
+		return fmt.Errorf("%s: decoding snapshot: %w", j.name, err)
+	}
+	return nil
+}
+
+// replay calls apply for every record in the log, in order. It must be
+// called once, after loadSnapshot and before append.
+func (j *journal) replay(apply func(json.RawMessage) error) error {
+	f, err := os.OpenFile(j.walPath(), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	good, err := j.replayLog(f, apply)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Truncate(good); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err = f.Seek(good, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	j.wal = f
+	return nil
+}
+
+func (j *journal) replayLog(f *os.File, apply func(json.RawMessage) error) (int64, error) {
+	var good int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// A partial line without the trailing newline is a torn write.
+			return good, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		payload, ok := decodeJournalLine(line)
+		if !ok {
+			if _, err = r.Peek(1); err == io.EOF {
+				return good, nil
+			}
+			return 0, fmt.Errorf("%s: %w at offset %d", j.name, errCorruptJournal, good)
+		}
+		if err = apply(payload); err != nil {
+			return 0, fmt.Errorf("%s: replaying record at offset %d: %w", j.name, good, err)
+		}
+		good += int64(len(line))
+		j.appended++
+	}
+}
+
+func decodeJournalLine(line []byte) (json.RawMessage, bool) {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	sep := bytes.IndexByte(line, ' ')
+	if sep < 0 {
+		return nil, false
+	}
+	sum, err := strconv.ParseUint(string(line[:sep]), 16, 32)
+	if err != nil {
+		return nil, false
+	}
+	payload := line[sep+1:]
+	if crc32.ChecksumIEEE(payload) != uint32(sum) {
+		return nil, false
+	}
+	return payload, true
+}
+
+// append writes one record to the log. With sync set the record is on
+// stable storage when append returns. A failed append cuts the log back to
+// where it was, so callers can undo the mutation the record described.
+func (j *journal) append(record interface{}, sync bool) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line := make([]byte, 0, len(payload)+10)
+	line = strconv.AppendUint(line, uint64(crc32.ChecksumIEEE(payload)), 16)
+	line = append(line, ' ')
+	line = append(line, payload...)
+	line = append(line, '\n')
+	end, err := j.wal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = j.wal.Write(line); err != nil {
+		return j.rewind(end, err)
+	}
+	if sync {
+		if err = j.wal.Sync(); err != nil {
+			return j.rewind(end, err)
+		}
+	}
+	j.appended++
+	return nil
+}
+
+// rewind drops whatever a failed append left behind end and returns the
+// error that failed it.
+func (j *journal) rewind(end int64, err error) error {
+	if terr := j.wal.Truncate(end); terr != nil {
+		return errors.Join(err, terr)
+	}
+	if _, serr := j.wal.Seek(end, io.SeekStart); serr != nil {
+		return errors.Join(err, serr)
+	}
+	return err
+}
+
+// commit appends the record of a mutation already applied in memory. If
+// the append fails undo reverts the mutation and the error is returned.
+// Once the record is in the log the mutation is committed, so a failed
+// compaction afterwards is only logged: failing the request would make
+// clients retry a mutation that happened. The next append retries it.
+func (j *journal) commit(record interface{}, sync bool, undo func(), compact func() error) error {
+	if err := j.append(record, sync); err != nil {
+		undo()
+		return err
+	}
+	if j.needsCompaction() {
+		if err := compact(); err != nil {
+			log.Printf("%s: compacting journal: %v", j.name, err)
+		}
+	}
+	return nil
+}
+
+// needsCompaction reports whether enough records piled up in the log since
+// the last snapshot.
+func (j *journal) needsCompaction() bool {
+	return j.appended >= journalCompactEvery
+}
+
+// compact atomically replaces the snapshot with snap and empties the log.
+func (j *journal) compact(snap interface{}) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(j.dir, j.name+".snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), j.snapshotPath()); err != nil {
+		return err
+	}
+	if err = syncDir(j.dir); err != nil {
+		return err
+	}
+
+	if err = j.wal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err = j.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	j.appended = 0
+	return j.wal.Sync()
+}
+
+func (j *journal) close() error {
+	if j.wal == nil {
+		return nil
+	}
+	return j.wal.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
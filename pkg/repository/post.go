@@ -1,11 +1,10 @@
 package repository
 
 import (
-	"errors"
-	"fmt"
 	"github.com/google/uuid"
 	"log"
 	"redditclone/pkg/models"
+	"sort"
 	"sync"
 	"time"
 )
@@ -13,7 +12,17 @@ import (
 type (
 	InMemoryPostRepo struct {
 		posts map[string]*models.Post
-		mu    sync.RWMutex
+		// commentRevisions keeps the replaced versions of edited comments
+		// by comment ID.
+		commentRevisions map[string][]*models.Revision
+		// postRevisions keeps the replaced versions of edited posts by
+		// post ID.
+		postRevisions map[string][]*models.Revision
+		// byCategory and byAuthor index the posts by category and by author
+		// username, so listing one of them does not scan the whole store.
+		byCategory postIndexes
+		byAuthor   postIndexes
+		mu         sync.RWMutex
 	}
 	PostRequest struct {
 		Category string `json:"category"`
@@ -26,7 +35,11 @@ type (
 
 func NewInMemoryPostRepo() *InMemoryPostRepo {
 	return &InMemoryPostRepo{
-		posts: make(map[string]*models.Post),
+		posts:            make(map[string]*models.Post),
+		commentRevisions: make(map[string][]*models.Revision),
+		postRevisions:    make(map[string][]*models.Revision),
+		byCategory:       make(postIndexes),
+		byAuthor:         make(postIndexes),
 	}
 }
 
@@ -37,8 +50,9 @@ func (h *InMemoryPostRepo) ListAll() ([]*models.Post, error) {
 	log.Printf("listAll: %v", len(h.posts))
 	log.Printf("listAll: %v", h.posts)
 	for _, p := range h.posts {
-		res = append(res, p)
+		res = append(res, copyPost(p))
 	}
+	sortByCreated(res)
 	return res, nil
 }
 
@@ -54,9 +68,8 @@ func (h *InMemoryPostRepo) Create(postReq PostRequest, session *models.Session)
 		Created:    time.Now(),
 		UpVotePerc: 100,
 		ID:         uuid.NewString(),
-		Votes:      make([]*models.Vote, 0),
 		Comments:   make([]*models.Comment, 0),
-		Author:     session,
+		Author:     session.Author(),
 	}
 	switch postReq.Type {
 	case "text":
@@ -65,50 +78,76 @@ func (h *InMemoryPostRepo) Create(postReq PostRequest, session *models.Session)
 		post.URL = postReq.URL
 	}
 	h.posts[post.ID] = post
-	h.UpVote(session.ID, post)
-	return post, nil
+	h.vote(post, session.UserID, upVote(session.UserID))
+	h.index(post)
+	return copyPost(post), nil
 }
 
 func (h *InMemoryPostRepo) ListByID(id string) (*models.Post, error) {
-	post, err := h.GetByID(id)
-	if err != nil {
-		return nil, err
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	post, ok := h.posts[id]
+	if !ok {
+		return nil, ErrPostNotFound
 	}
 	post.Views++
-	return post, nil
+	return copyPost(post), nil
 }
 
 func (h *InMemoryPostRepo) GetByID(id string) (*models.Post, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	post, ok := h.posts[id]
 	if !ok {
-		return nil, errors.New("post not found")
+		return nil, ErrPostNotFound
 	}
-	return post, nil
+	return copyPost(post), nil
 }
 
 func (h *InMemoryPostRepo) GetByCategory(category string) ([]*models.Post, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	var res []*models.Post
-	for _, p := range h.posts {
-		if p.Category == category {
-			res = append(res, p)
-		}
+	return h.byCategory.oldest(category), nil
+}
+
+// TopByCategory returns up to limit posts of the category, best score
+// first.
+func (h *InMemoryPostRepo) TopByCategory(category string, limit int) []*models.Post {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.byCategory.best(category, limit)
+}
+
+func (h *InMemoryPostRepo) AddCommentToPost(body string, postID string, session *models.Session) (*models.Post, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	post, ok := h.posts[postID]
+	if !ok {
+		return nil, ErrPostNotFound
 	}
-	return res, nil
+
+	comm := h.addComment(body, session.Author())
+	post.Comments = append(post.Comments, comm)
+	return copyPost(post), nil
 }
 
-func (h *InMemoryPostRepo) AddCommentToPost(body string, postID string) (*models.Post, error) {
+func (h *InMemoryPostRepo) ReplyToComment(body, postID, parentID string, session *models.Session) (*models.Post, error) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	post, ok := h.posts[postID]
 	if !ok {
-		return nil, errors.New("post not found")
+		return nil, ErrPostNotFound
+	}
+	parent := findComment(post, parentID)
+	if parent == nil || parent.Deleted {
+		return nil, ErrCommentNotFound
 	}
 
-	comm := h.addComment(body, post.ID)
+	comm := h.addComment(body, session.Author())
+	comm.ParentID = parent.ID
+	comm.Depth = parent.Depth + 1
 	post.Comments = append(post.Comments, comm)
-	return post, nil
+	return copyPost(post), nil
 }
 
 func (h *InMemoryPostRepo) DeleteComment(commentID, postID string) (*models.Post, error) {
@@ -116,32 +155,55 @@ func (h *InMemoryPostRepo) DeleteComment(commentID, postID string) (*models.Post
 	defer h.mu.Unlock()
 	post, ok := h.posts[postID]
 	if !ok {
-		return nil, errors.New("post not found")
+		return nil, ErrPostNotFound
 	}
 	err := h.deleteComment(post.ID, commentID)
 	if err != nil {
 		return nil, err
 	}
-	return post, nil
+	return copyPost(post), nil
 }
 
-func (h *InMemoryPostRepo) checkVote(postID string) bool {
-	return len(h.posts[postID].Votes) > 0
+func (h *InMemoryPostRepo) EditComment(postID, commentID, body string) (*models.Post, error) {
+	post, _, err := h.editComment(postID, commentID, body)
+	return post, err
 }
 
-func (h *InMemoryPostRepo) deleteVote(sessionID, postID string) {
+// editComment also returns the revision the edit replaced.
+func (h *InMemoryPostRepo) editComment(postID, commentID, body string) (*models.Post, *models.Revision, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	post, ok := h.posts[postID]
+	if !ok {
+		return nil, nil, ErrPostNotFound
+	}
+	comment := findComment(post, commentID)
+	if comment == nil || comment.Deleted {
+		return nil, nil, ErrCommentNotFound
+	}
+	prev := comment.Revision(len(h.commentRevisions[commentID]))
+	h.commentRevisions[commentID] = append(h.commentRevisions[commentID], prev)
+	now := time.Now()
+	comment.Body = body
+	comment.Edited = &now
+	return copyPost(post), prev, nil
+}
 
-	position := -1
-	for i, vote := range h.posts[postID].Votes {
-		if vote.User == sessionID {
-			position = i
-			break
-		}
+func (h *InMemoryPostRepo) CommentHistory(postID, commentID string) ([]*models.Revision, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	post, ok := h.posts[postID]
+	if !ok {
+		return nil, ErrPostNotFound
 	}
-	if position == -1 {
-		return
+	comment := findComment(post, commentID)
+	if comment == nil {
+		return nil, ErrCommentNotFound
 	}
-	h.posts[postID].Votes = append(h.posts[postID].Votes[:position], h.posts[postID].Votes[position+1:]...)
+	earlier := h.commentRevisions[commentID]
+	res := make([]*models.Revision, 0, len(earlier)+1)
+	res = append(res, earlier...)
+	return append(res, comment.Revision(len(earlier))), nil
 }
 
 func upVote(userID string) *models.Vote {
@@ -160,76 +222,186 @@ func downVote(userID string) *models.Vote {
 	return vote
 }
 
-func (h *InMemoryPostRepo) calcUpVotePercent(post *models.Post) {
-	if len(post.Votes) == 0 {
-		h.posts[post.ID].UpVotePerc = 0
-		return
+func upVotePercent(votes []*models.Vote) int {
+	if len(votes) == 0 {
+		return 0
 	}
 	up := 0
-	for _, v := range post.Votes {
+	for _, v := range votes {
 		if v.Vote == 1 {
 			up++
 		}
 	}
-	if up == 0 {
-		h.posts[post.ID].UpVotePerc = 0
-		return
+	return up * 100 / len(votes)
+}
+
+func (h *InMemoryPostRepo) vote(post *models.Post, userID string, vote *models.Vote) {
+	if vote == nil {
+		post.Votes.Remove(userID)
+	} else {
+		post.Votes.Set(userID, vote.Vote)
+	}
+	post.Score = post.Votes.Score()
+	post.UpVotePerc = post.Votes.UpVotePercent()
+}
+
+func (h *InMemoryPostRepo) UpVote(postID, userID string) (*models.Post, error) {
+	return h.updateVote(postID, userID, upVote(userID))
+}
+
+func (h *InMemoryPostRepo) DownVote(postID, userID string) (*models.Post, error) {
+	return h.updateVote(postID, userID, downVote(userID))
+}
+
+func (h *InMemoryPostRepo) UnVote(postID, userID string) (*models.Post, error) {
+	return h.updateVote(postID, userID, nil)
+}
+
+func (h *InMemoryPostRepo) updateVote(postID, userID string, vote *models.Vote) (*models.Post, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	post, ok := h.posts[postID]
+	if !ok {
+		return nil, ErrPostNotFound
 	}
-	percentage := up * 100 / len(post.Votes)
-	h.posts[post.ID].UpVotePerc = percentage
+	score := post.Score
+	h.vote(post, userID, vote)
+	h.byCategory.rescore(post.Category, post, score)
+	h.byAuthor.rescore(post.Author.Username, post, score)
+	return copyPost(post), nil
 }
 
-func (h *InMemoryPostRepo) UpVote(sessionID string, post *models.Post) {
-	if h.checkVote(post.ID) {
-		h.deleteVote(sessionID, post.ID)
+func (h *InMemoryPostRepo) UpVoteComment(postID, commentID, userID string) (*models.Post, error) {
+	return h.updateCommentVote(postID, commentID, userID, upVote(userID))
+}
+
+func (h *InMemoryPostRepo) DownVoteComment(postID, commentID, userID string) (*models.Post, error) {
+	return h.updateCommentVote(postID, commentID, userID, downVote(userID))
+}
+
+func (h *InMemoryPostRepo) UnVoteComment(postID, commentID, userID string) (*models.Post, error) {
+	return h.updateCommentVote(postID, commentID, userID, nil)
+}
+
+func (h *InMemoryPostRepo) updateCommentVote(postID, commentID, userID string, vote *models.Vote) (*models.Post, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	post, ok := h.posts[postID]
+	if !ok {
+		return nil, ErrPostNotFound
+	}
+	comment := findComment(post, commentID)
+	if comment == nil || comment.Deleted {
+		return nil, ErrCommentNotFound
+	}
+	votes := make([]*models.Vote, 0, len(comment.Votes)+1)
+	for _, v := range comment.Votes {
+		if v.User != userID {
+			votes = append(votes, v)
+		}
+	}
+	if vote != nil {
+		votes = append(votes, vote)
 	}
+	comment.Votes = votes
+	comment.Score = voteScore(votes)
+	comment.UpVotePerc = upVotePercent(votes)
+	return copyPost(post), nil
+}
 
-	vote := upVote(sessionID)
-	post.Votes = append(post.Votes, vote)
-	h.calcUpVotePercent(post)
+func voteScore(votes []*models.Vote) int {
+	score := 0
+	for _, v := range votes {
+		score += v.Vote
+	}
+	return score
 }
 
-func (h *InMemoryPostRepo) DownVote(sessionID string, post *models.Post) {
-	if h.checkVote(post.ID) {
-		h.deleteVote(sessionID, post.ID)
+func (h *InMemoryPostRepo) DeletePost(postID string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	post, ok := h.posts[postID]
+	if !ok {
+		return ErrPostNotFound
 	}
-	vote := downVote(sessionID)
-	post.Votes = append(post.Votes, vote)
-	h.calcUpVotePercent(post)
+	for _, c := range post.Comments {
+		delete(h.commentRevisions, c.ID)
+	}
+	delete(h.postRevisions, postID)
+	delete(h.posts, postID)
+	h.unindex(post)
+	return nil
 }
 
-func (h *InMemoryPostRepo) UnVote(sessionID string, post *models.Post) {
-	if h.checkVote(post.ID) {
-		h.deleteVote(sessionID, post.ID)
+func (h *InMemoryPostRepo) EditPost(postID, title, text string) (*models.Post, error) {
+	post, _, err := h.editPost(postID, title, text)
+	return post, err
+}
+
+// editPost also returns the revision the edit replaced.
+func (h *InMemoryPostRepo) editPost(postID, title, text string) (*models.Post, *models.Revision, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	post, ok := h.posts[postID]
+	if !ok {
+		return nil, nil, ErrPostNotFound
 	}
-	h.calcUpVotePercent(post)
+	prev := post.Revision(len(h.postRevisions[postID]))
+	h.postRevisions[postID] = append(h.postRevisions[postID], prev)
+	now := time.Now()
+	post.Title = title
+	post.Text = text
+	post.Edited = &now
+	return copyPost(post), prev, nil
 }
 
-func (h *InMemoryPostRepo) DeletePost(post *models.Post) {
-	delete(h.posts, h.posts[post.ID].ID)
+func (h *InMemoryPostRepo) PostRevisions(postID string) ([]*models.Revision, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	post, ok := h.posts[postID]
+	if !ok {
+		return nil, ErrPostNotFound
+	}
+	earlier := h.postRevisions[postID]
+	res := make([]*models.Revision, 0, len(earlier)+1)
+	res = append(res, earlier...)
+	return append(res, post.Revision(len(earlier))), nil
 }
 
 func (h *InMemoryPostRepo) GetAllPostsUser(userLogin string) ([]*models.Post, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	var res []*models.Post
-	for _, p := range h.posts {
-		if p.Author.Username == userLogin {
-			res = append(res, p)
-		}
-	}
+	res := h.byAuthor.oldest(userLogin)
 	if len(res) == 0 {
-		return nil, errors.New("posts not found")
+		return nil, ErrPostsNotFound
 	}
 	return res, nil
 }
 
-func (h *InMemoryPostRepo) addComment(body, postID string) *models.Comment {
+// TopByAuthor returns up to limit posts of the user, best score first.
+func (h *InMemoryPostRepo) TopByAuthor(userLogin string, limit int) []*models.Post {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.byAuthor.best(userLogin, limit)
+}
+
+func (h *InMemoryPostRepo) index(post *models.Post) {
+	h.byCategory.add(post.Category, post)
+	h.byAuthor.add(post.Author.Username, post)
+}
+
+func (h *InMemoryPostRepo) unindex(post *models.Post) {
+	h.byCategory.remove(post.Category, post)
+	h.byAuthor.remove(post.Author.Username, post)
+}
+
+func (h *InMemoryPostRepo) addComment(body string, author *models.Author) *models.Comment {
 	comm := &models.Comment{
 		Created: time.Now(),
-		Author:  h.posts[postID].Author,
+		Author:  author,
 		Body:    body,
 		ID:      uuid.NewString(),
+		Votes:   make([]*models.Vote, 0),
 	}
 	return comm
 }
@@ -241,14 +413,214 @@ func (h *InMemoryPostRepo) getCommentPosition(postID, commentID string) (int, er
 			return i, nil
 		}
 	}
-	return -1, fmt.Errorf("comment not found")
+	return -1, ErrCommentNotFound
 }
 
+// deleteComment removes the comment, or tombstones it when it has replies.
+// Tombstoned ancestors left without replies are removed as well.
 func (h *InMemoryPostRepo) deleteComment(postID, commentID string) error {
-	position, err := h.getCommentPosition(postID, commentID)
-	if err != nil {
-		return err
+	post := h.posts[postID]
+	comment := findComment(post, commentID)
+	if comment == nil || comment.Deleted {
+		return ErrCommentNotFound
+	}
+	if hasReplies(post, comment.ID) {
+		comment.Tombstone()
+		return nil
+	}
+	for {
+		position, err := h.getCommentPosition(postID, comment.ID)
+		if err != nil {
+			return err
+		}
+		post.Comments = append(post.Comments[:position], post.Comments[position+1:]...)
+		delete(h.commentRevisions, comment.ID)
+
+		comment = findComment(post, comment.ParentID)
+		if comment == nil || !comment.Deleted || hasReplies(post, comment.ID) {
+			return nil
+		}
+	}
+}
+
+func findComment(post *models.Post, commentID string) *models.Comment {
+	if commentID == "" {
+		return nil
+	}
+	for _, c := range post.Comments {
+		if c.ID == commentID {
+			return c
+		}
 	}
-	h.posts[postID].Comments = append(h.posts[postID].Comments[:position], h.posts[postID].Comments[position+1:]...)
 	return nil
 }
+
+func hasReplies(post *models.Post, commentID string) bool {
+	for _, c := range post.Comments {
+		if c.ParentID == commentID {
+			return true
+		}
+	}
+	return false
+}
+
+// restore puts a post back as-is, used when replaying persisted state.
+func (h *InMemoryPostRepo) restore(post *models.Post) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// Posts saved before scores followed the votes carry a stale score,
+	// and tombstones saved before they got a placeholder author none.
+	post.Score = post.Votes.Score()
+	for _, c := range post.Comments {
+		if c.Deleted {
+			c.Tombstone()
+		}
+	}
+	if old, ok := h.posts[post.ID]; ok {
+		h.unindex(old)
+	}
+	h.posts[post.ID] = post
+	h.index(post)
+}
+
+func (h *InMemoryPostRepo) forget(postID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if post, ok := h.posts[postID]; ok {
+		for _, c := range post.Comments {
+			delete(h.commentRevisions, c.ID)
+		}
+		h.unindex(post)
+	}
+	delete(h.postRevisions, postID)
+	delete(h.posts, postID)
+}
+
+// setViews sets the view counter of a post, used when replaying view
+// records. Unknown posts are ignored, they were deleted later on.
+func (h *InMemoryPostRepo) setViews(postID string, views int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if post, ok := h.posts[postID]; ok {
+		post.Views = views
+	}
+}
+
+// postState is everything the repo keeps about one post, taken before a
+// mutation so it can be undone when its journal record can't be written.
+type postState struct {
+	id               string
+	post             *models.Post
+	postRevisions    []*models.Revision
+	commentRevisions map[string][]*models.Revision
+}
+
+// state captures a post with its revisions, post is nil if it is missing.
+func (h *InMemoryPostRepo) state(postID string) *postState {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	s := &postState{id: postID}
+	post, ok := h.posts[postID]
+	if !ok {
+		return s
+	}
+	s.post = copyPost(post)
+	s.postRevisions = append([]*models.Revision(nil), h.postRevisions[postID]...)
+	s.commentRevisions = make(map[string][]*models.Revision)
+	for _, c := range post.Comments {
+		if revs, ok := h.commentRevisions[c.ID]; ok {
+			s.commentRevisions[c.ID] = append([]*models.Revision(nil), revs...)
+		}
+	}
+	return s
+}
+
+// reset puts a post back the way state captured it.
+func (h *InMemoryPostRepo) reset(s *postState) {
+	h.forget(s.id)
+	if s.post == nil {
+		return
+	}
+	h.restore(s.post)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(s.postRevisions) > 0 {
+		h.postRevisions[s.id] = s.postRevisions
+	}
+	for commentID, revs := range s.commentRevisions {
+		h.commentRevisions[commentID] = revs
+	}
+}
+
+// restoreCommentRevision puts a replaced comment version back as-is, used
+// when replaying persisted state. Versions already present are skipped, so
+// replaying a record twice is harmless.
+func (h *InMemoryPostRepo) restoreCommentRevision(commentID string, rev *models.Revision) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.commentRevisions[commentID]) >= rev.Version {
+		return
+	}
+	h.commentRevisions[commentID] = append(h.commentRevisions[commentID], rev)
+}
+
+// restorePostRevision is restoreCommentRevision for post revisions.
+func (h *InMemoryPostRepo) restorePostRevision(postID string, rev *models.Revision) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.postRevisions[postID]) >= rev.Version {
+		return
+	}
+	h.postRevisions[postID] = append(h.postRevisions[postID], rev)
+}
+
+// livePostRevisions returns the stored revisions of posts that still exist.
+func (h *InMemoryPostRepo) livePostRevisions() map[string][]*models.Revision {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	res := make(map[string][]*models.Revision)
+	for id := range h.posts {
+		if revs, ok := h.postRevisions[id]; ok {
+			res[id] = append([]*models.Revision(nil), revs...)
+		}
+	}
+	return res
+}
+
+// liveCommentRevisions returns the stored revisions of comments that still
+// exist.
+func (h *InMemoryPostRepo) liveCommentRevisions() map[string][]*models.Revision {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	res := make(map[string][]*models.Revision)
+	for _, post := range h.posts {
+		for _, c := range post.Comments {
+			if revs, ok := h.commentRevisions[c.ID]; ok {
+				res[c.ID] = append([]*models.Revision(nil), revs...)
+			}
+		}
+	}
+	return res
+}
+
+// sortByCreated orders posts oldest first like the SQL backend does, map
+// iteration order would differ on every call.
+func sortByCreated(posts []*models.Post) {
+	sort.Slice(posts, func(i, j int) bool { return createdBefore(posts[i], posts[j]) })
+}
+
+// copyPost returns a snapshot of the post that stays valid after the lock is
+// released. Comments and post votes are modified in place, so they are
+// copied. Comment votes, authors and edit times are replaced rather than
+// modified, so they are shared.
+func copyPost(p *models.Post) *models.Post {
+	c := *p
+	c.Votes = p.Votes.Clone()
+	c.Comments = make([]*models.Comment, len(p.Comments))
+	for i, comment := range p.Comments {
+		cc := *comment
+		cc.Votes = append([]*models.Vote(nil), comment.Votes...)
+		c.Comments[i] = &cc
+	}
+	return &c
+}
@@ -0,0 +1,258 @@
+package repository
+
+import (
+	"encoding/json"
+	"redditclone/pkg/models"
+	"sync"
+)
+
+const (
+	postOpCreate        = "create"
+	postOpView          = "view"
+	postOpVote          = "vote"
+	postOpComment       = "comment"
+	postOpReply         = "reply"
+	postOpCommentVote   = "comment_vote"
+	postOpEditComment   = "edit_comment"
+	postOpEditPost      = "edit"
+	postOpDeleteComment = "delete_comment"
+	postOpDelete        = "delete"
+)
+
+type (
+	// FilePostRepo keeps posts in an InMemoryPostRepo and makes every
+	// mutation durable in a journal under its data directory.
+	FilePostRepo struct {
+		*InMemoryPostRepo
+		journal *journal
+		mu      sync.Mutex
+	}
+
+	// postRecord is one journal entry. Deletes carry only the post ID and
+	// views the ID and the new view count, all other ops the full post as
+	// it looked after the mutation. Edits also carry the replaced version
+	// of the post or, with CommentID set, of the comment.
+	postRecord struct {
+		Op        string           `json:"op"`
+		ID        string           `json:"id,omitempty"`
+		Views     int              `json:"views,omitempty"`
+		Post      *models.Post     `json:"post,omitempty"`
+		CommentID string           `json:"commentId,omitempty"`
+		Revision  *models.Revision `json:"revision,omitempty"`
+	}
+
+	postSnapshot struct {
+		Posts            []*models.Post                `json:"posts"`
+		PostRevisions    map[string][]*models.Revision `json:"postRevisions,omitempty"`
+		CommentRevisions map[string][]*models.Revision `json:"commentRevisions,omitempty"`
+	}
+)
+
+var _ TopPostStore = (*FilePostRepo)(nil)
+
+// NewFilePostRepo opens (or creates) the post journal in dir and replays it.
+func NewFilePostRepo(dir string) (*FilePostRepo, error) {
+	j, err := openJournal(dir, "posts")
+	if err != nil {
+		return nil, err
+	}
+	repo := &FilePostRepo{
+		InMemoryPostRepo: NewInMemoryPostRepo(),
+		journal:          j,
+	}
+
+	var snap postSnapshot
+	if err = j.loadSnapshot(&snap); err != nil {
+		return nil, err
+	}
+	for _, p := range snap.Posts {
+		repo.restore(p)
+	}
+	for postID, revs := range snap.PostRevisions {
+		for _, rev := range revs {
+			repo.restorePostRevision(postID, rev)
+		}
+	}
+	for commentID, revs := range snap.CommentRevisions {
+		for _, rev := range revs {
+			repo.restoreCommentRevision(commentID, rev)
+		}
+	}
+	err = j.replay(func(data json.RawMessage) error {
+		var rec postRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return err
+		}
+		switch {
+		case rec.Op == postOpDelete:
+			repo.forget(rec.ID)
+			return nil
+		case rec.Op == postOpView && rec.Post == nil:
+			// Views used to be journaled with the whole post.
+			repo.setViews(rec.ID, rec.Views)
+			return nil
+		}
+		repo.restore(rec.Post)
+		switch {
+		case rec.Revision != nil && rec.CommentID != "":
+			repo.restoreCommentRevision(rec.CommentID, rec.Revision)
+		case rec.Revision != nil:
+			repo.restorePostRevision(rec.Post.ID, rec.Revision)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (f *FilePostRepo) Create(postReq PostRequest, session *models.Session) (*models.Post, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	post, err := f.InMemoryPostRepo.Create(postReq, session)
+	if err != nil {
+		return nil, err
+	}
+	return post, f.log(postRecord{Op: postOpCreate, Post: post}, true, func() { f.forget(post.ID) })
+}
+
+func (f *FilePostRepo) ListByID(id string) (*models.Post, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	post, err := f.InMemoryPostRepo.ListByID(id)
+	if err != nil {
+		return nil, err
+	}
+	// Losing a few view counters on a crash is fine, no fsync per page view.
+	rec := postRecord{Op: postOpView, ID: id, Views: post.Views}
+	return post, f.log(rec, false, func() { f.setViews(id, post.Views-1) })
+}
+
+func (f *FilePostRepo) AddCommentToPost(body string, postID string, session *models.Session) (*models.Post, error) {
+	return f.update(postID, func() (postRecord, error) {
+		post, err := f.InMemoryPostRepo.AddCommentToPost(body, postID, session)
+		return postRecord{Op: postOpComment, Post: post}, err
+	})
+}
+
+func (f *FilePostRepo) ReplyToComment(body, postID, parentID string, session *models.Session) (*models.Post, error) {
+	return f.update(postID, func() (postRecord, error) {
+		post, err := f.InMemoryPostRepo.ReplyToComment(body, postID, parentID, session)
+		return postRecord{Op: postOpReply, Post: post}, err
+	})
+}
+
+func (f *FilePostRepo) DeleteComment(commentID, postID string) (*models.Post, error) {
+	return f.update(postID, func() (postRecord, error) {
+		post, err := f.InMemoryPostRepo.DeleteComment(commentID, postID)
+		return postRecord{Op: postOpDeleteComment, Post: post}, err
+	})
+}
+
+func (f *FilePostRepo) UpVote(postID, userID string) (*models.Post, error) {
+	return f.vote(f.InMemoryPostRepo.UpVote, postID, userID)
+}
+
+func (f *FilePostRepo) DownVote(postID, userID string) (*models.Post, error) {
+	return f.vote(f.InMemoryPostRepo.DownVote, postID, userID)
+}
+
+func (f *FilePostRepo) UnVote(postID, userID string) (*models.Post, error) {
+	return f.vote(f.InMemoryPostRepo.UnVote, postID, userID)
+}
+
+func (f *FilePostRepo) vote(apply func(postID, userID string) (*models.Post, error), postID, userID string) (*models.Post, error) {
+	return f.update(postID, func() (postRecord, error) {
+		post, err := apply(postID, userID)
+		return postRecord{Op: postOpVote, Post: post}, err
+	})
+}
+
+func (f *FilePostRepo) EditComment(postID, commentID, body string) (*models.Post, error) {
+	return f.update(postID, func() (postRecord, error) {
+		post, prev, err := f.InMemoryPostRepo.editComment(postID, commentID, body)
+		return postRecord{Op: postOpEditComment, Post: post, CommentID: commentID, Revision: prev}, err
+	})
+}
+
+func (f *FilePostRepo) EditPost(postID, title, text string) (*models.Post, error) {
+	return f.update(postID, func() (postRecord, error) {
+		post, prev, err := f.InMemoryPostRepo.editPost(postID, title, text)
+		return postRecord{Op: postOpEditPost, Post: post, Revision: prev}, err
+	})
+}
+
+func (f *FilePostRepo) UpVoteComment(postID, commentID, userID string) (*models.Post, error) {
+	return f.voteComment(f.InMemoryPostRepo.UpVoteComment, postID, commentID, userID)
+}
+
+func (f *FilePostRepo) DownVoteComment(postID, commentID, userID string) (*models.Post, error) {
+	return f.voteComment(f.InMemoryPostRepo.DownVoteComment, postID, commentID, userID)
+}
+
+func (f *FilePostRepo) UnVoteComment(postID, commentID, userID string) (*models.Post, error) {
+	return f.voteComment(f.InMemoryPostRepo.UnVoteComment, postID, commentID, userID)
+}
+
+func (f *FilePostRepo) voteComment(apply func(postID, commentID, userID string) (*models.Post, error), postID, commentID, userID string) (*models.Post, error) {
+	return f.update(postID, func() (postRecord, error) {
+		post, err := apply(postID, commentID, userID)
+		return postRecord{Op: postOpCommentVote, Post: post}, err
+	})
+}
+
+func (f *FilePostRepo) DeletePost(postID string) error {
+	_, err := f.update(postID, func() (postRecord, error) {
+		return postRecord{Op: postOpDelete, ID: postID}, f.InMemoryPostRepo.DeletePost(postID)
+	})
+	return err
+}
+
+// update applies a mutation of an existing post and journals the record it
+// returns. If the record can't be written the post and its revisions are
+// put back as they were, so memory never runs ahead of the journal.
+func (f *FilePostRepo) update(postID string, apply func() (postRecord, error)) (*models.Post, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prev := f.InMemoryPostRepo.state(postID)
+	rec, err := apply()
+	if err != nil {
+		return nil, err
+	}
+	return rec.Post, f.log(rec, true, func() { f.reset(prev) })
+}
+
+// Compact folds the journal into a fresh snapshot.
+func (f *FilePostRepo) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.compact()
+}
+
+// Close compacts the journal and releases the log file.
+func (f *FilePostRepo) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.compact(); err != nil {
+		return err
+	}
+	return f.journal.close()
+}
+
+// log journals rec, see journal.commit.
+func (f *FilePostRepo) log(rec postRecord, sync bool, undo func()) error {
+	return f.journal.commit(rec, sync, undo, f.compact)
+}
+
+func (f *FilePostRepo) compact() error {
+	posts, err := f.InMemoryPostRepo.ListAll()
+	if err != nil {
+		return err
+	}
+	return f.journal.compact(postSnapshot{
+		Posts:            posts,
+		PostRevisions:    f.InMemoryPostRepo.livePostRevisions(),
+		CommentRevisions: f.InMemoryPostRepo.liveCommentRevisions(),
+	})
+}
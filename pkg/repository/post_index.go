@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"redditclone/pkg/models"
+	"sort"
+)
+
+type (
+	// postIndex holds the posts of one category or one author twice:
+	// oldest first and best score first. Both stay sorted on every change,
+	// so lookups cost the size of the group, not of the whole store.
+	postIndex struct {
+		byCreated []*models.Post
+		byScore   []*models.Post
+	}
+
+	// postIndexes groups posts by a key such as the category.
+	postIndexes map[string]*postIndex
+)
+
+// createdBefore orders posts oldest first, by ID when created together.
+func createdBefore(a, b *models.Post) bool {
+	if !a.Created.Equal(b.Created) {
+		return a.Created.Before(b.Created)
+	}
+	return a.ID < b.ID
+}
+
+// scoreBefore orders posts by score, best first, then newest first.
+func scoreBefore(a, b *models.Post) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return createdBefore(b, a)
+}
+
+func insertSorted(posts []*models.Post, post *models.Post, before func(a, b *models.Post) bool) []*models.Post {
+	i := sort.Search(len(posts), func(i int) bool { return before(post, posts[i]) })
+	posts = append(posts, nil)
+	copy(posts[i+1:], posts[i:])
+	posts[i] = post
+	return posts
+}
+
+// removeSorted drops post, found by its position in the order, so the
+// fields the order looks at must not have changed since it was inserted.
+func removeSorted(posts []*models.Post, post *models.Post, before func(a, b *models.Post) bool) []*models.Post {
+	i := sort.Search(len(posts), func(i int) bool { return !before(posts[i], post) })
+	if i == len(posts) || posts[i].ID != post.ID {
+		return posts
+	}
+	copy(posts[i:], posts[i+1:])
+	posts[len(posts)-1] = nil
+	return posts[:len(posts)-1]
+}
+
+func (ix postIndexes) add(key string, post *models.Post) {
+	group, ok := ix[key]
+	if !ok {
+		group = &postIndex{}
+		ix[key] = group
+	}
+	group.byCreated = insertSorted(group.byCreated, post, createdBefore)
+	group.byScore = insertSorted(group.byScore, post, scoreBefore)
+}
+
+func (ix postIndexes) remove(key string, post *models.Post) {
+	group, ok := ix[key]
+	if !ok {
+		return
+	}
+	group.byCreated = removeSorted(group.byCreated, post, createdBefore)
+	group.byScore = removeSorted(group.byScore, post, scoreBefore)
+	if len(group.byCreated) == 0 {
+		delete(ix, key)
+	}
+}
+
+// rescore moves the post within the score order after its score changed
+// from oldScore.
+func (ix postIndexes) rescore(key string, post *models.Post, oldScore int) {
+	group, ok := ix[key]
+	if !ok {
+		return
+	}
+	newScore := post.Score
+	post.Score = oldScore
+	group.byScore = removeSorted(group.byScore, post, scoreBefore)
+	post.Score = newScore
+	group.byScore = insertSorted(group.byScore, post, scoreBefore)
+}
+
+// oldest returns snapshots of the group's posts, oldest first.
+func (ix postIndexes) oldest(key string) []*models.Post {
+	group, ok := ix[key]
+	if !ok {
+		return nil
+	}
+	return copyPosts(group.byCreated)
+}
+
+// best returns up to limit posts of the group with the highest scores.
+func (ix postIndexes) best(key string, limit int) []*models.Post {
+	group, ok := ix[key]
+	if !ok {
+		return nil
+	}
+	return copyPosts(group.byScore[:min(limit, len(group.byScore))])
+}
+
+func copyPosts(posts []*models.Post) []*models.Post {
+	res := make([]*models.Post, len(posts))
+	for i, p := range posts {
+		res[i] = copyPost(p)
+	}
+	return res
+}
@@ -0,0 +1,660 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"redditclone/pkg/models"
+	"time"
+)
+
+// sqlChunk bounds the number of placeholders in one IN (...) list.
+const sqlChunk = 500
+
+const postColumns = `id, author_id, author_username, category, type, title, text, url, score, views, created, edited`
+
+type (
+	// SQLPostRepo stores posts in normalized posts, votes and comments
+	// tables and assembles models.Post on read.
+	SQLPostRepo struct {
+		db *SQLDB
+	}
+
+	// commentNode is the part of a comment row needed to walk a thread.
+	commentNode struct {
+		id       string
+		parentID sql.NullString
+		depth    int
+		deleted  bool
+		replies  int
+	}
+)
+
+var _ PostStore = (*SQLPostRepo)(nil)
+
+func NewSQLPostRepo(db *SQLDB) *SQLPostRepo {
+	return &SQLPostRepo{db: db}
+}
+
+func (r *SQLPostRepo) ListAll() ([]*models.Post, error) {
+	posts, err := r.queryPosts(r.db, `SELECT `+postColumns+` FROM posts ORDER BY created, id`)
+	if err != nil {
+		return nil, err
+	}
+	if posts == nil {
+		posts = make([]*models.Post, 0)
+	}
+	return posts, nil
+}
+
+func (r *SQLPostRepo) Create(postReq PostRequest, session *models.Session) (*models.Post, error) {
+	post := &models.Post{
+		Score:    1,
+		Type:     postReq.Type,
+		Title:    postReq.Title,
+		Category: postReq.Category,
+		Created:  time.Now(),
+		ID:       uuid.NewString(),
+		Author:   session.Author(),
+	}
+	switch postReq.Type {
+	case "text":
+		post.Text = postReq.Text
+	case "link":
+		post.URL = postReq.URL
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(r.db.Rebind(`INSERT INTO posts (`+postColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		post.ID, post.Author.ID, post.Author.Username, post.Category, post.Type, post.Title,
+		post.Text, post.URL, post.Score, post.Views, post.Created, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(r.db.Rebind(`INSERT INTO votes (post_id, user_id, vote) VALUES (?, ?, ?)`), post.ID, post.Author.ID, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetByID(post.ID)
+}
+
+func (r *SQLPostRepo) ListByID(id string) (*models.Post, error) {
+	res, err := r.db.Exec(r.db.Rebind(`UPDATE posts SET views = views + 1 WHERE id = ?`), id)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, ErrPostNotFound
+	}
+	return r.GetByID(id)
+}
+
+func (r *SQLPostRepo) GetByID(id string) (*models.Post, error) {
+	return r.getByID(r.db, id)
+}
+
+func (r *SQLPostRepo) GetByCategory(category string) ([]*models.Post, error) {
+	return r.queryPosts(r.db, `SELECT `+postColumns+` FROM posts WHERE category = ? ORDER BY created, id`, category)
+}
+
+func (r *SQLPostRepo) GetAllPostsUser(userLogin string) ([]*models.Post, error) {
+	posts, err := r.queryPosts(r.db, `SELECT `+postColumns+` FROM posts WHERE author_username = ? ORDER BY created, id`, userLogin)
+	if err != nil {
+		return nil, err
+	}
+	if len(posts) == 0 {
+		return nil, ErrPostsNotFound
+	}
+	return posts, nil
+}
+
+func (r *SQLPostRepo) AddCommentToPost(body string, postID string, session *models.Session) (*models.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = r.checkPost(tx, postID); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(r.db.Rebind(`INSERT INTO comments (id, post_id, author_id, author_username, body, created) VALUES (?, ?, ?, ?, ?, ?)`),
+		uuid.NewString(), postID, session.UserID, session.Username, body, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetByID(postID)
+}
+
+func (r *SQLPostRepo) ReplyToComment(body, postID, parentID string, session *models.Session) (*models.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = r.checkPost(tx, postID); err != nil {
+		return nil, err
+	}
+	parent, err := r.commentNode(tx, postID, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if parent.deleted {
+		return nil, ErrCommentNotFound
+	}
+	_, err = tx.Exec(r.db.Rebind(`INSERT INTO comments (id, post_id, author_id, author_username, body, created, parent_id, depth) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+		uuid.NewString(), postID, session.UserID, session.Username, body, time.Now(), parentID, parent.depth+1)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetByID(postID)
+}
+
+// DeleteComment removes the comment, or tombstones it when it has replies.
+// Tombstoned ancestors left without replies are removed as well.
+func (r *SQLPostRepo) DeleteComment(commentID, postID string) (*models.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = r.checkPost(tx, postID); err != nil {
+		return nil, err
+	}
+	node, err := r.commentNode(tx, postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if node.deleted {
+		return nil, ErrCommentNotFound
+	}
+	if node.replies > 0 {
+		_, err = tx.Exec(r.db.Rebind(`UPDATE comments SET deleted = ?, body = ?, author_id = '', author_username = '' WHERE id = ?`),
+			true, models.DeletedCommentBody, commentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for node.replies == 0 {
+		for _, query := range []string{
+			`DELETE FROM comment_votes WHERE comment_id = ?`,
+			`DELETE FROM comment_revisions WHERE comment_id = ?`,
+			`DELETE FROM comments WHERE id = ?`,
+		} {
+			if _, err = tx.Exec(r.db.Rebind(query), node.id); err != nil {
+				return nil, err
+			}
+		}
+		if !node.parentID.Valid {
+			break
+		}
+		node, err = r.commentNode(tx, postID, node.parentID.String)
+		if errors.Is(err, ErrCommentNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !node.deleted {
+			break
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetByID(postID)
+}
+
+func (r *SQLPostRepo) EditComment(postID, commentID, body string) (*models.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = r.checkPost(tx, postID); err != nil {
+		return nil, err
+	}
+	current, deleted, err := r.currentCommentRevision(tx, postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if deleted {
+		return nil, ErrCommentNotFound
+	}
+	_, err = tx.Exec(r.db.Rebind(`INSERT INTO comment_revisions (comment_id, version, body, created) VALUES (?, ?, ?, ?)`),
+		commentID, current.Version, current.Body, current.Created)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(r.db.Rebind(`UPDATE comments SET body = ?, edited = ? WHERE id = ?`), body, time.Now(), commentID)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetByID(postID)
+}
+
+func (r *SQLPostRepo) CommentHistory(postID, commentID string) ([]*models.Revision, error) {
+	if err := r.checkPost(r.db, postID); err != nil {
+		return nil, err
+	}
+	current, _, err := r.currentCommentRevision(r.db, postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query(r.db.Rebind(`SELECT version, body, created FROM comment_revisions WHERE comment_id = ? ORDER BY version`), commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]*models.Revision, 0, current.Version)
+	for rows.Next() {
+		rev := &models.Revision{}
+		if err = rows.Scan(&rev.Version, &rev.Body, &rev.Created); err != nil {
+			return nil, err
+		}
+		res = append(res, rev)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return append(res, current), nil
+}
+
+// currentCommentRevision describes the comment as it is now, numbered after
+// its stored revisions, and reports whether it is a tombstone.
+func (r *SQLPostRepo) currentCommentRevision(q sqlQueryer, postID, commentID string) (*models.Revision, bool, error) {
+	var comment models.Comment
+	var edited sql.NullTime
+	var earlier int
+	err := q.QueryRow(r.db.Rebind(`SELECT body, created, edited, deleted, (SELECT COUNT(*) FROM comment_revisions rev WHERE rev.comment_id = comments.id)
+FROM comments WHERE id = ? AND post_id = ?`), commentID, postID).
+		Scan(&comment.Body, &comment.Created, &edited, &comment.Deleted, &earlier)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if edited.Valid {
+		comment.Edited = &edited.Time
+	}
+	return comment.Revision(earlier), comment.Deleted, nil
+}
+
+func (r *SQLPostRepo) commentNode(q sqlQueryer, postID, commentID string) (commentNode, error) {
+	node := commentNode{id: commentID}
+	err := q.QueryRow(r.db.Rebind(`SELECT parent_id, depth, deleted, (SELECT COUNT(*) FROM comments reply WHERE reply.parent_id = comments.id)
+FROM comments WHERE id = ? AND post_id = ?`), commentID, postID).
+		Scan(&node.parentID, &node.depth, &node.deleted, &node.replies)
+	if errors.Is(err, sql.ErrNoRows) {
+		return node, ErrCommentNotFound
+	}
+	return node, err
+}
+
+func (r *SQLPostRepo) UpVote(postID, userID string) (*models.Post, error) {
+	return r.vote(postID, userID, 1)
+}
+
+func (r *SQLPostRepo) DownVote(postID, userID string) (*models.Post, error) {
+	return r.vote(postID, userID, -1)
+}
+
+func (r *SQLPostRepo) UnVote(postID, userID string) (*models.Post, error) {
+	return r.vote(postID, userID, 0)
+}
+
+func (r *SQLPostRepo) vote(postID, userID string, value int) (*models.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = r.checkPost(tx, postID); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(r.db.Rebind(`DELETE FROM votes WHERE post_id = ? AND user_id = ?`), postID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if value != 0 {
+		_, err = tx.Exec(r.db.Rebind(`INSERT INTO votes (post_id, user_id, vote) VALUES (?, ?, ?)`), postID, userID, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = tx.Exec(r.db.Rebind(`UPDATE posts SET score = (SELECT COALESCE(SUM(vote), 0) FROM votes WHERE post_id = ?) WHERE id = ?`), postID, postID)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetByID(postID)
+}
+
+func (r *SQLPostRepo) UpVoteComment(postID, commentID, userID string) (*models.Post, error) {
+	return r.voteComment(postID, commentID, userID, 1)
+}
+
+func (r *SQLPostRepo) DownVoteComment(postID, commentID, userID string) (*models.Post, error) {
+	return r.voteComment(postID, commentID, userID, -1)
+}
+
+func (r *SQLPostRepo) UnVoteComment(postID, commentID, userID string) (*models.Post, error) {
+	return r.voteComment(postID, commentID, userID, 0)
+}
+
+func (r *SQLPostRepo) voteComment(postID, commentID, userID string, value int) (*models.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = r.checkPost(tx, postID); err != nil {
+		return nil, err
+	}
+	node, err := r.commentNode(tx, postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if node.deleted {
+		return nil, ErrCommentNotFound
+	}
+	_, err = tx.Exec(r.db.Rebind(`DELETE FROM comment_votes WHERE comment_id = ? AND user_id = ?`), commentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if value != 0 {
+		_, err = tx.Exec(r.db.Rebind(`INSERT INTO comment_votes (comment_id, user_id, vote) VALUES (?, ?, ?)`), commentID, userID, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetByID(postID)
+}
+
+func (r *SQLPostRepo) DeletePost(postID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = r.checkPost(tx, postID); err != nil {
+		return err
+	}
+	// Children are removed explicitly, not every driver enforces ON DELETE CASCADE.
+	for _, query := range []string{
+		`DELETE FROM post_revisions WHERE post_id = ?`,
+		`DELETE FROM comment_votes WHERE comment_id IN (SELECT id FROM comments WHERE post_id = ?)`,
+		`DELETE FROM comment_revisions WHERE comment_id IN (SELECT id FROM comments WHERE post_id = ?)`,
+		`DELETE FROM comments WHERE post_id = ?`,
+		`DELETE FROM votes WHERE post_id = ?`,
+		`DELETE FROM posts WHERE id = ?`,
+	} {
+		if _, err = tx.Exec(r.db.Rebind(query), postID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SQLPostRepo) EditPost(postID, title, text string) (*models.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := r.currentPostRevision(tx, postID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(r.db.Rebind(`INSERT INTO post_revisions (post_id, version, title, text, created) VALUES (?, ?, ?, ?, ?)`),
+		postID, current.Version, current.Title, current.Body, current.Created)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(r.db.Rebind(`UPDATE posts SET title = ?, text = ?, edited = ? WHERE id = ?`), title, text, time.Now(), postID)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetByID(postID)
+}
+
+func (r *SQLPostRepo) PostRevisions(postID string) ([]*models.Revision, error) {
+	current, err := r.currentPostRevision(r.db, postID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query(r.db.Rebind(`SELECT version, title, text, created FROM post_revisions WHERE post_id = ? ORDER BY version`), postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]*models.Revision, 0, current.Version)
+	for rows.Next() {
+		rev := &models.Revision{}
+		if err = rows.Scan(&rev.Version, &rev.Title, &rev.Body, &rev.Created); err != nil {
+			return nil, err
+		}
+		res = append(res, rev)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return append(res, current), nil
+}
+
+// currentPostRevision describes the post as it is now, numbered after its
+// stored revisions.
+func (r *SQLPostRepo) currentPostRevision(q sqlQueryer, postID string) (*models.Revision, error) {
+	var post models.Post
+	var edited sql.NullTime
+	var earlier int
+	err := q.QueryRow(r.db.Rebind(`SELECT title, text, created, edited, (SELECT COUNT(*) FROM post_revisions rev WHERE rev.post_id = posts.id)
+FROM posts WHERE id = ?`), postID).
+		Scan(&post.Title, &post.Text, &post.Created, &edited, &earlier)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPostNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if edited.Valid {
+		post.Edited = &edited.Time
+	}
+	return post.Revision(earlier), nil
+}
+
+func (r *SQLPostRepo) checkPost(q sqlQueryer, postID string) error {
+	var exists int
+	err := q.QueryRow(r.db.Rebind(`SELECT COUNT(*) FROM posts WHERE id = ?`), postID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+func (r *SQLPostRepo) getByID(q sqlQueryer, id string) (*models.Post, error) {
+	posts, err := r.queryPosts(q, `SELECT `+postColumns+` FROM posts WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(posts) == 0 {
+		return nil, ErrPostNotFound
+	}
+	return posts[0], nil
+}
+
+// queryPosts runs a query selecting postColumns and fills in votes and
+// comments of every returned post.
+func (r *SQLPostRepo) queryPosts(q sqlQueryer, query string, args ...interface{}) ([]*models.Post, error) {
+	rows, err := q.Query(r.db.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []*models.Post
+	for rows.Next() {
+		post := &models.Post{
+			Author:   &models.Author{},
+			Comments: make([]*models.Comment, 0),
+		}
+		var edited sql.NullTime
+		err = rows.Scan(&post.ID, &post.Author.ID, &post.Author.Username, &post.Category, &post.Type,
+			&post.Title, &post.Text, &post.URL, &post.Score, &post.Views, &post.Created, &edited)
+		if err != nil {
+			return nil, err
+		}
+		if edited.Valid {
+			post.Edited = &edited.Time
+		}
+		posts = append(posts, post)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if err = r.loadChildren(q, posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (r *SQLPostRepo) loadChildren(q sqlQueryer, posts []*models.Post) error {
+	byID := make(map[string]*models.Post, len(posts))
+	ids := make([]string, 0, len(posts))
+	for _, p := range posts {
+		byID[p.ID] = p
+		ids = append(ids, p.ID)
+	}
+
+	for start := 0; start < len(ids); start += sqlChunk {
+		end := start + sqlChunk
+		if end > len(ids) {
+			end = len(ids)
+		}
+		chunk := ids[start:end]
+		if err := r.loadVotes(q, byID, chunk); err != nil {
+			return err
+		}
+		if err := r.loadComments(q, byID, chunk); err != nil {
+			return err
+		}
+	}
+	for _, p := range posts {
+		p.UpVotePerc = p.Votes.UpVotePercent()
+	}
+	return nil
+}
+
+func (r *SQLPostRepo) loadVotes(q sqlQueryer, byID map[string]*models.Post, ids []string) error {
+	rows, err := q.Query(r.db.Rebind(`SELECT post_id, user_id, vote FROM votes WHERE post_id IN (`+placeholders(len(ids))+`) ORDER BY post_id, user_id`),
+		stringArgs(ids)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var postID, userID string
+		var vote int
+		if err = rows.Scan(&postID, &userID, &vote); err != nil {
+			return err
+		}
+		byID[postID].Votes.Set(userID, vote)
+	}
+	return rows.Err()
+}
+
+func (r *SQLPostRepo) loadComments(q sqlQueryer, byID map[string]*models.Post, ids []string) error {
+	rows, err := q.Query(r.db.Rebind(`SELECT id, post_id, author_id, author_username, body, created, parent_id, depth, deleted, edited FROM comments WHERE post_id IN (`+placeholders(len(ids))+`) ORDER BY created, id`),
+		stringArgs(ids)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	comments := make(map[string]*models.Comment)
+	for rows.Next() {
+		var postID string
+		var parentID sql.NullString
+		var edited sql.NullTime
+		comment := &models.Comment{Author: &models.Author{}, Votes: make([]*models.Vote, 0)}
+		if err = rows.Scan(&comment.ID, &postID, &comment.Author.ID, &comment.Author.Username, &comment.Body, &comment.Created,
+			&parentID, &comment.Depth, &comment.Deleted, &edited); err != nil {
+			return err
+		}
+		comment.ParentID = parentID.String
+		if edited.Valid {
+			comment.Edited = &edited.Time
+		}
+		if comment.Deleted {
+			comment.Tombstone()
+		}
+		byID[postID].Comments = append(byID[postID].Comments, comment)
+		comments[comment.ID] = comment
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	return r.loadCommentVotes(q, comments, ids)
+}
+
+func (r *SQLPostRepo) loadCommentVotes(q sqlQueryer, comments map[string]*models.Comment, postIDs []string) error {
+	rows, err := q.Query(r.db.Rebind(`SELECT v.comment_id, v.user_id, v.vote FROM comment_votes v
+JOIN comments c ON c.id = v.comment_id WHERE c.post_id IN (`+placeholders(len(postIDs))+`) ORDER BY v.comment_id, v.user_id`),
+		stringArgs(postIDs)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var commentID string
+		vote := &models.Vote{}
+		if err = rows.Scan(&commentID, &vote.User, &vote.Vote); err != nil {
+			return err
+		}
+		if c, ok := comments[commentID]; ok {
+			c.Votes = append(c.Votes, vote)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, c := range comments {
+		c.Score = voteScore(c.Votes)
+		c.UpVotePerc = upVotePercent(c.Votes)
+	}
+	return nil
+}
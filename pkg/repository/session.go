@@ -1,14 +1,21 @@
 package repository
 
 import (
-	"errors"
 	"github.com/google/uuid"
 	"redditclone/pkg/models"
+	"sort"
+	"sync"
+	"time"
 )
 
+// sessionTouchInterval limits how often LastSeen is bumped, so that an
+// active client doesn't turn every request into a write.
+const sessionTouchInterval = time.Minute
+
 type (
 	InMemorySessionRepo struct {
 		sessions map[string]*models.Session
+		mu       sync.RWMutex
 	}
 )
 
@@ -18,15 +25,100 @@ func NewInMemorySessionRepo() *InMemorySessionRepo {
 	}
 }
 
-func (r *InMemorySessionRepo) Create(userName string) (*models.Session, error) {
+func (r *InMemorySessionRepo) Create(user *models.User, info models.SessionInfo) (*models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	session := &models.Session{
+		ID:          uuid.NewString(),
+		UserID:      user.ID,
+		Username:    user.Username,
+		SessionInfo: info,
+		Created:     now,
+		LastSeen:    now,
+	}
+	r.sessions[session.ID] = session
+	return copySession(session), nil
+}
 
-	if _, exist := r.sessions[userName]; exist {
-		return nil, errors.New("username already exists")
+func (r *InMemorySessionRepo) GetByID(sessionID string) (*models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	session, ok := r.sessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
 	}
-	session := &models.Session{
-		ID:       uuid.NewString(),
-		Username: userName,
+	return copySession(session), nil
+}
+
+func (r *InMemorySessionRepo) Touch(sessionID string) (*models.Session, error) {
+	session, _, err := r.touch(sessionID)
+	return session, err
+}
+
+// touch bumps LastSeen and reports whether it actually changed.
+func (r *InMemorySessionRepo) touch(sessionID string) (*models.Session, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[sessionID]
+	if !ok {
+		return nil, false, ErrSessionNotFound
+	}
+	now := time.Now()
+	touched := now.Sub(session.LastSeen) >= sessionTouchInterval
+	if touched {
+		session.LastSeen = now
+	}
+	return copySession(session), touched, nil
+}
+
+func (r *InMemorySessionRepo) ListByUser(userID string) ([]*models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]*models.Session, 0)
+	for _, s := range r.sessions {
+		if s.UserID == userID {
+			res = append(res, copySession(s))
+		}
 	}
-	r.sessions[userName] = session
-	return session, nil
+	sort.Slice(res, func(i, j int) bool { return res[i].Created.Before(res[j].Created) })
+	return res, nil
+}
+
+func (r *InMemorySessionRepo) Delete(sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[sessionID]; !ok {
+		return ErrSessionNotFound
+	}
+	delete(r.sessions, sessionID)
+	return nil
+}
+
+func (r *InMemorySessionRepo) list() []*models.Session {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]*models.Session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		res = append(res, copySession(s))
+	}
+	return res
+}
+
+// restore puts a session back as-is, used when replaying persisted state.
+func (r *InMemorySessionRepo) restore(session *models.Session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[session.ID] = session
+}
+
+func (r *InMemorySessionRepo) forget(sessionID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, sessionID)
+}
+
+func copySession(s *models.Session) *models.Session {
+	c := *s
+	return &c
 }
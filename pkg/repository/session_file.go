@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"encoding/json"
+	"redditclone/pkg/models"
+	"sync"
+)
+
+const (
+	sessionOpCreate = "create"
+	sessionOpTouch  = "touch"
+	sessionOpDelete = "delete"
+)
+
+type (
+	// FileSessionRepo keeps sessions in an InMemorySessionRepo and makes
+	// them durable in a journal, so restarts don't log everybody out.
+	FileSessionRepo struct {
+		*InMemorySessionRepo
+		journal *journal
+		mu      sync.Mutex
+	}
+
+	sessionRecord struct {
+		Op      string          `json:"op"`
+		ID      string          `json:"id,omitempty"`
+		Session *models.Session `json:"session,omitempty"`
+	}
+
+	sessionSnapshot struct {
+		Sessions []*models.Session `json:"sessions"`
+	}
+)
+
+var _ SessionStore = (*FileSessionRepo)(nil)
+
+// NewFileSessionRepo opens (or creates) the session journal in dir and
+// replays it.
+func NewFileSessionRepo(dir string) (*FileSessionRepo, error) {
+	j, err := openJournal(dir, "sessions")
+	if err != nil {
+		return nil, err
+	}
+	repo := &FileSessionRepo{
+		InMemorySessionRepo: NewInMemorySessionRepo(),
+		journal:             j,
+	}
+
+	var snap sessionSnapshot
+	if err = j.loadSnapshot(&snap); err != nil {
+		return nil, err
+	}
+	for _, s := range snap.Sessions {
+		repo.restore(s)
+	}
+	err = j.replay(func(data json.RawMessage) error {
+		var rec sessionRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return err
+		}
+		if rec.Op == sessionOpDelete {
+			repo.forget(rec.ID)
+			return nil
+		}
+		repo.restore(rec.Session)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (f *FileSessionRepo) Create(user *models.User, info models.SessionInfo) (*models.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	session, err := f.InMemorySessionRepo.Create(user, info)
+	if err != nil {
+		return nil, err
+	}
+	return session, f.log(sessionRecord{Op: sessionOpCreate, Session: session}, true, func() { f.forget(session.ID) })
+}
+
+func (f *FileSessionRepo) Touch(sessionID string) (*models.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prev, err := f.InMemorySessionRepo.GetByID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	session, touched, err := f.InMemorySessionRepo.touch(sessionID)
+	if err != nil || !touched {
+		return session, err
+	}
+	// LastSeen is informational, no fsync for it.
+	return session, f.log(sessionRecord{Op: sessionOpTouch, Session: session}, false, func() { f.restore(prev) })
+}
+
+func (f *FileSessionRepo) Delete(sessionID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prev, err := f.InMemorySessionRepo.GetByID(sessionID)
+	if err != nil {
+		return err
+	}
+	if err = f.InMemorySessionRepo.Delete(sessionID); err != nil {
+		return err
+	}
+	return f.log(sessionRecord{Op: sessionOpDelete, ID: sessionID}, true, func() { f.restore(prev) })
+}
+
+// Compact folds the journal into a fresh snapshot.
+func (f *FileSessionRepo) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.compact()
+}
+
+// Close compacts the journal and releases the log file.
+func (f *FileSessionRepo) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.compact(); err != nil {
+		return err
+	}
+	return f.journal.close()
+}
+
+// log journals rec, see journal.commit.
+func (f *FileSessionRepo) log(rec sessionRecord, sync bool, undo func()) error {
+	return f.journal.commit(rec, sync, undo, f.compact)
+}
+
+func (f *FileSessionRepo) compact() error {
+	return f.journal.compact(sessionSnapshot{Sessions: f.InMemorySessionRepo.list()})
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"redditclone/pkg/models"
+	"time"
+)
+
+const sessionColumns = `id, user_id, username, device, ip, user_agent, created, last_seen`
+
+type (
+	SQLSessionRepo struct {
+		db *SQLDB
+	}
+)
+
+var _ SessionStore = (*SQLSessionRepo)(nil)
+
+func NewSQLSessionRepo(db *SQLDB) *SQLSessionRepo {
+	return &SQLSessionRepo{db: db}
+}
+
+func (r *SQLSessionRepo) Create(user *models.User, info models.SessionInfo) (*models.Session, error) {
+	now := time.Now()
+	session := &models.Session{
+		ID:          uuid.NewString(),
+		UserID:      user.ID,
+		Username:    user.Username,
+		SessionInfo: info,
+		Created:     now,
+		LastSeen:    now,
+	}
+	_, err := r.db.Exec(r.db.Rebind(`INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+		session.ID, session.UserID, session.Username, session.Device, session.IP, session.UserAgent,
+		session.Created, session.LastSeen)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *SQLSessionRepo) GetByID(sessionID string) (*models.Session, error) {
+	return scanSession(r.db.QueryRow(r.db.Rebind(`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`), sessionID))
+}
+
+func (r *SQLSessionRepo) Touch(sessionID string) (*models.Session, error) {
+	now := time.Now()
+	_, err := r.db.Exec(r.db.Rebind(`UPDATE sessions SET last_seen = ? WHERE id = ? AND last_seen < ?`),
+		now, sessionID, now.Add(-sessionTouchInterval))
+	if err != nil {
+		return nil, err
+	}
+	return r.GetByID(sessionID)
+}
+
+func (r *SQLSessionRepo) ListByUser(userID string) ([]*models.Session, error) {
+	rows, err := r.db.Query(r.db.Rebind(`SELECT `+sessionColumns+` FROM sessions WHERE user_id = ? ORDER BY created`), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]*models.Session, 0)
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, session)
+	}
+	return res, rows.Err()
+}
+
+func (r *SQLSessionRepo) Delete(sessionID string) error {
+	res, err := r.db.Exec(r.db.Rebind(`DELETE FROM sessions WHERE id = ?`), sessionID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row rowScanner) (*models.Session, error) {
+	session := &models.Session{}
+	err := row.Scan(&session.ID, &session.UserID, &session.Username, &session.Device, &session.IP,
+		&session.UserAgent, &session.Created, &session.LastSeen)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// SQLDB is a database/sql handle together with the placeholder style of
+// its driver. Queries in this package are written with "?" placeholders
+// and rebound for drivers that expect "$1, $2, ...".
+type SQLDB struct {
+	*sql.DB
+	dollar bool
+}
+
+func NewSQLDB(db *sql.DB, driver string) *SQLDB {
+	switch driver {
+	case "postgres", "pgx", "cloudsqlpostgres":
+		return &SQLDB{DB: db, dollar: true}
+	default:
+		return &SQLDB{DB: db}
+	}
+}
+
+// Rebind converts "?" placeholders of query into the driver's style.
+func (db *SQLDB) Rebind(query string) string {
+	if !db.dollar {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+type sqlQueryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
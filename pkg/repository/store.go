@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"errors"
+	"redditclone/pkg/models"
+	"time"
+)
+
+var (
+	ErrPostNotFound    = errors.New("post not found")
+	ErrPostsNotFound   = errors.New("posts not found")
+	ErrCommentNotFound = errors.New("comment not found")
+	ErrUserExists      = errors.New("username already exists")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrSessionNotFound = errors.New("session not found")
+	ErrTokenNotFound   = errors.New("refresh token not found")
+	ErrTokenUsed       = errors.New("refresh token already used")
+
+	ErrCommunityNotFound = errors.New("community not found")
+	ErrCommunityExists   = errors.New("community already exists")
+	ErrModeratorNotFound = errors.New("moderator not found")
+	ErrInviteNotFound    = errors.New("moderator invite not found")
+	ErrMemberNotFound    = errors.New("member not found")
+	ErrBanNotFound       = errors.New("ban not found")
+)
+
+type (
+	// PostStore is the storage backend used by handlers.PostHandler.
+	PostStore interface {
+		ListAll() ([]*models.Post, error)
+		Create(postReq PostRequest, session *models.Session) (*models.Post, error)
+		ListByID(id string) (*models.Post, error)
+		GetByID(id string) (*models.Post, error)
+		GetByCategory(category string) ([]*models.Post, error)
+		GetAllPostsUser(userLogin string) ([]*models.Post, error)
+		AddCommentToPost(body string, postID string, session *models.Session) (*models.Post, error)
+		ReplyToComment(body, postID, parentID string, session *models.Session) (*models.Post, error)
+		DeleteComment(commentID, postID string) (*models.Post, error)
+		EditComment(postID, commentID, body string) (*models.Post, error)
+		// CommentHistory lists every version of the comment, oldest first.
+		CommentHistory(postID, commentID string) ([]*models.Revision, error)
+		UpVote(postID, userID string) (*models.Post, error)
+		DownVote(postID, userID string) (*models.Post, error)
+		UnVote(postID, userID string) (*models.Post, error)
+		UpVoteComment(postID, commentID, userID string) (*models.Post, error)
+		DownVoteComment(postID, commentID, userID string) (*models.Post, error)
+		UnVoteComment(postID, commentID, userID string) (*models.Post, error)
+		DeletePost(postID string) error
+		EditPost(postID, title, text string) (*models.Post, error)
+		// PostRevisions lists every version of the post, oldest first.
+		PostRevisions(postID string) ([]*models.Revision, error)
+	}
+
+	// TopPostStore is a PostStore keeping every category and author
+	// ordered by score. The handlers read the all-time top listings from
+	// it instead of sorting the whole group.
+	TopPostStore interface {
+		PostStore
+		// TopByCategory returns up to limit posts of the category, best
+		// score first, newest first among equal scores.
+		TopByCategory(category string, limit int) []*models.Post
+		// TopByAuthor is TopByCategory for the posts of the user.
+		TopByAuthor(userLogin string, limit int) []*models.Post
+	}
+
+	// UserStore is the storage backend used by handlers.UserHandler.
+	UserStore interface {
+		Create(userName, hashPassword string) (*models.User, error)
+		GetByUsername(username string) (*models.User, error)
+		GetByID(userID string) (*models.User, error)
+		SetRole(username, role string) error
+	}
+
+	// SessionStore keeps the active sessions of users. A user may have any
+	// number of sessions, deleting one revokes the tokens issued for it.
+	SessionStore interface {
+		Create(user *models.User, info models.SessionInfo) (*models.Session, error)
+		GetByID(sessionID string) (*models.Session, error)
+		// Touch returns the session and records that it was just used. It
+		// fails with ErrSessionNotFound for revoked sessions.
+		Touch(sessionID string) (*models.Session, error)
+		ListByUser(userID string) ([]*models.Session, error)
+		Delete(sessionID string) error
+	}
+
+	// RefreshTokenStore keeps refresh tokens by hash. A token family is
+	// every refresh token issued for one session.
+	RefreshTokenStore interface {
+		Create(token *models.RefreshToken) error
+		GetByHash(hash string) (*models.RefreshToken, error)
+		// MarkUsed atomically marks an unused token as used. It fails with
+		// ErrTokenUsed when the token was used before.
+		MarkUsed(hash string) (*models.RefreshToken, error)
+		RevokeFamily(sessionID string) error
+	}
+
+	// CommunityStore keeps communities by name.
+	CommunityStore interface {
+		// Create fails with ErrCommunityExists when the name is taken.
+		Create(community *models.Community) error
+		GetByName(name string) (*models.Community, error)
+		// List returns every community ordered by name.
+		List() ([]*models.Community, error)
+		// Update replaces the title, description, rules and visibility of
+		// the community with those of the one passed in.
+		Update(community *models.Community) (*models.Community, error)
+		Delete(name string) error
+		// InviteModerator adds a pending moderator, or changes the
+		// permissions of one already invited or accepted.
+		InviteModerator(name string, mod *models.Moderator) (*models.Community, error)
+		// AcceptModerator accepts the user's pending invite. It fails with
+		// ErrInviteNotFound when there is none.
+		AcceptModerator(name, userID string) (*models.Community, error)
+		// RemoveModerator drops a moderator or a pending invite.
+		RemoveModerator(name, userID string) (*models.Community, error)
+		// ApproveMember adds an approved member, approving a member again is
+		// a no-op.
+		ApproveMember(name string, member *models.Member) (*models.Community, error)
+		// RemoveMember fails with ErrMemberNotFound when the user isn't a
+		// member.
+		RemoveMember(name, userID string) (*models.Community, error)
+		// Ban bans the user from the community, banning again replaces the
+		// earlier ban.
+		Ban(ban *models.Ban) error
+		// Unban and GetBan fail with ErrBanNotFound when the user isn't
+		// banned. GetBan returns expired bans the sweeper hasn't removed yet.
+		Unban(name, userID string) error
+		GetBan(name, userID string) (*models.Ban, error)
+		// Bans returns the bans of the community, oldest first.
+		Bans(name string) ([]*models.Ban, error)
+		// ExpireBans removes every ban that expired by now and returns how
+		// many there were.
+		ExpireBans(now time.Time) (int, error)
+		// Subscribe adds the community to the user's subscriptions,
+		// subscribing twice is a no-op. So is unsubscribing from a community
+		// the user isn't subscribed to.
+		Subscribe(name, userID string) error
+		Unsubscribe(name, userID string) error
+		// Subscriptions returns the communities the user is subscribed to
+		// ordered by name.
+		Subscriptions(userID string) ([]*models.Community, error)
+	}
+)
+
+var (
+	_ TopPostStore = (*InMemoryPostRepo)(nil)
+	_ UserStore    = (*InMemoryUserRepo)(nil)
+	_ SessionStore = (*InMemorySessionRepo)(nil)
+
+	_ RefreshTokenStore = (*InMemoryRefreshTokenRepo)(nil)
+	_ CommunityStore    = (*InMemoryCommunityRepo)(nil)
+)
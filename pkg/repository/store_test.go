@@ -0,0 +1,153 @@
+package repository_test
+
+import (
+	"database/sql"
+	"io"
+	"redditclone/pkg/migrations"
+	"redditclone/pkg/repository"
+	"redditclone/pkg/repository/storetest"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newSQLDB opens a migrated SQLite database in a temporary directory.
+func newSQLDB(t testing.TB) *repository.SQLDB {
+	t.Helper()
+	// The directory ends up in a DSN, where # would start a fragment.
+	dir := strings.ReplaceAll(t.TempDir(), "#", "%23")
+	db, err := sql.Open("sqlite3", "file:"+dir+"/redditclone.db?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	sqlDB := repository.NewSQLDB(db, "sqlite3")
+	if _, err = migrations.NewRunner(db, sqlDB.Rebind).Up(); err != nil {
+		t.Fatal(err)
+	}
+	return sqlDB
+}
+
+// openFile opens a file backed repo in a temporary directory and closes it
+// when the test ends.
+func openFile[R io.Closer](t testing.TB, open func(dir string) (R, error)) R {
+	t.Helper()
+	repo, err := open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := repo.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return repo
+}
+
+func TestPostStore(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		storetest.PostStore(t, func(t *testing.T) repository.PostStore { return repository.NewInMemoryPostRepo() })
+	})
+	t.Run("file", func(t *testing.T) {
+		storetest.PostStore(t, func(t *testing.T) repository.PostStore { return openFile(t, repository.NewFilePostRepo) })
+	})
+	t.Run("sql", func(t *testing.T) {
+		storetest.PostStore(t, func(t *testing.T) repository.PostStore { return repository.NewSQLPostRepo(newSQLDB(t)) })
+	})
+}
+
+func TestUserStore(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		storetest.UserStore(t, func(t *testing.T) repository.UserStore { return repository.NewInMemoryUserRepo() })
+	})
+	t.Run("file", func(t *testing.T) {
+		storetest.UserStore(t, func(t *testing.T) repository.UserStore { return openFile(t, repository.NewFileUserRepo) })
+	})
+	t.Run("sql", func(t *testing.T) {
+		storetest.UserStore(t, func(t *testing.T) repository.UserStore { return repository.NewSQLUserRepo(newSQLDB(t)) })
+	})
+}
+
+func TestSessionStore(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		storetest.SessionStore(t, func(t *testing.T) repository.SessionStore { return repository.NewInMemorySessionRepo() })
+	})
+	t.Run("file", func(t *testing.T) {
+		storetest.SessionStore(t, func(t *testing.T) repository.SessionStore { return openFile(t, repository.NewFileSessionRepo) })
+	})
+	t.Run("sql", func(t *testing.T) {
+		storetest.SessionStore(t, func(t *testing.T) repository.SessionStore {
+			// Sessions reference their user, the suite logs in as alice.
+			db := newSQLDB(t)
+			if _, err := repository.NewSQLUserRepo(db).Create("alice", "hash"); err != nil {
+				t.Fatal(err)
+			}
+			return repository.NewSQLSessionRepo(db)
+		})
+	})
+}
+
+func TestRefreshTokenStore(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		storetest.RefreshTokenStore(t, func(t *testing.T) repository.RefreshTokenStore {
+			return repository.NewInMemoryRefreshTokenRepo()
+		})
+	})
+	t.Run("file", func(t *testing.T) {
+		storetest.RefreshTokenStore(t, func(t *testing.T) repository.RefreshTokenStore {
+			return openFile(t, repository.NewFileRefreshTokenRepo)
+		})
+	})
+	t.Run("sql", func(t *testing.T) {
+		storetest.RefreshTokenStore(t, func(t *testing.T) repository.RefreshTokenStore {
+			return repository.NewSQLRefreshTokenRepo(newSQLDB(t))
+		})
+	})
+}
+
+func TestCommunityStore(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		storetest.CommunityStore(t, func(t *testing.T) repository.CommunityStore { return repository.NewInMemoryCommunityRepo() })
+	})
+	t.Run("file", func(t *testing.T) {
+		storetest.CommunityStore(t, func(t *testing.T) repository.CommunityStore { return openFile(t, repository.NewFileCommunityRepo) })
+	})
+	t.Run("sql", func(t *testing.T) {
+		storetest.CommunityStore(t, func(t *testing.T) repository.CommunityStore { return repository.NewSQLCommunityRepo(newSQLDB(t)) })
+	})
+}
+
+func TestTopPostStore(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		storetest.TopPostStore(t, func(t *testing.T) repository.TopPostStore { return repository.NewInMemoryPostRepo() })
+	})
+	t.Run("file", func(t *testing.T) {
+		storetest.TopPostStore(t, func(t *testing.T) repository.TopPostStore { return openFile(t, repository.NewFilePostRepo) })
+	})
+}
+
+func BenchmarkPostLookups(b *testing.B) {
+	b.Run("memory", func(b *testing.B) {
+		storetest.PostLookups(b, func(b *testing.B) repository.PostStore { return repository.NewInMemoryPostRepo() })
+	})
+	b.Run("file", func(b *testing.B) {
+		storetest.PostLookups(b, func(b *testing.B) repository.PostStore { return openFile(b, repository.NewFilePostRepo) })
+	})
+	b.Run("sql", func(b *testing.B) {
+		storetest.PostLookups(b, func(b *testing.B) repository.PostStore { return repository.NewSQLPostRepo(newSQLDB(b)) })
+	})
+}
+
+func TestPostStoreStress(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		storetest.PostStoreStress(t, func(t *testing.T) repository.PostStore { return repository.NewInMemoryPostRepo() })
+	})
+	t.Run("file", func(t *testing.T) {
+		storetest.PostStoreStress(t, func(t *testing.T) repository.PostStore { return openFile(t, repository.NewFilePostRepo) })
+	})
+	t.Run("sql", func(t *testing.T) {
+		storetest.PostStoreStress(t, func(t *testing.T) repository.PostStore { return repository.NewSQLPostRepo(newSQLDB(t)) })
+	})
+}
@@ -0,0 +1,77 @@
+package storetest
+
+import (
+	"fmt"
+	"redditclone/pkg/models"
+	"redditclone/pkg/repository"
+	"testing"
+)
+
+type PostBenchStoreFactory func(b *testing.B) repository.PostStore
+
+// benchGroupSize is how many posts the looked up category and author own,
+// whatever the total number of posts in the store.
+const benchGroupSize = 100
+
+// PostLookups benchmarks category and author listings and voting against
+// stores of growing size. The looked up category and author always hold
+// benchGroupSize posts, so an indexed store shows flat timings across the
+// sizes while a scanning one grows with the total.
+func PostLookups(b *testing.B, newStore PostBenchStoreFactory) {
+	for _, total := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("posts=%d", total), func(b *testing.B) {
+			store := newStore(b)
+			var target *models.Post
+			for i := 0; i < total; i++ {
+				session, category := alice, "music"
+				if i >= benchGroupSize {
+					session = &models.Session{
+						ID:       fmt.Sprintf("bench-session-%d", i%500),
+						UserID:   fmt.Sprintf("bench-id-%d", i%500),
+						Username: fmt.Sprintf("bench-%d", i%500),
+					}
+					category = fmt.Sprintf("bench-%d", i%50)
+				}
+				post, err := store.Create(textPost(category), session)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if i == 0 {
+					target = post
+				}
+			}
+
+			b.Run("GetByCategory", func(b *testing.B) {
+				for b.Loop() {
+					posts, err := store.GetByCategory("music")
+					if err != nil || len(posts) != benchGroupSize {
+						b.Fatalf("got %d posts, %v", len(posts), err)
+					}
+				}
+			})
+			b.Run("GetAllPostsUser", func(b *testing.B) {
+				for b.Loop() {
+					posts, err := store.GetAllPostsUser(alice.Username)
+					if err != nil || len(posts) != benchGroupSize {
+						b.Fatalf("got %d posts, %v", len(posts), err)
+					}
+				}
+			})
+			b.Run("Vote", func(b *testing.B) {
+				up := true
+				for b.Loop() {
+					var err error
+					if up {
+						_, err = store.UpVote(target.ID, bob.UserID)
+					} else {
+						_, err = store.DownVote(target.ID, bob.UserID)
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+					up = !up
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,401 @@
+package storetest
+
+import (
+	"errors"
+	"redditclone/pkg/models"
+	"redditclone/pkg/repository"
+	"testing"
+	"time"
+)
+
+type CommunityStoreFactory func(t *testing.T) repository.CommunityStore
+
+func community(name string) *models.Community {
+	return &models.Community{
+		Name:        name,
+		Title:       "All about " + name,
+		Description: "description",
+		Creator:     alice.Author(),
+		Created:     time.Now().UTC().Truncate(time.Second),
+		Rules:       []string{"be nice", "stay on topic"},
+		Visibility:  models.VisibilityPublic,
+	}
+}
+
+// CommunityStore runs the community storage conformance suite.
+func CommunityStore(t *testing.T, newStore CommunityStoreFactory) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		s := newStore(t)
+		want := community("music")
+		if err := s.Create(want); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		got, err := s.GetByName("music")
+		if err != nil {
+			t.Fatalf("GetByName: %v", err)
+		}
+		if got.Title != want.Title || got.Description != want.Description || !got.Created.Equal(want.Created) ||
+			got.Visibility != want.Visibility {
+			t.Fatalf("GetByName: got %+v, want %+v", got, want)
+		}
+		if got.Creator == nil || got.Creator.ID != alice.UserID || got.Creator.Username != alice.Username {
+			t.Fatalf("GetByName: creator = %+v, want alice", got.Creator)
+		}
+		if len(got.Rules) != 2 || got.Rules[0] != "be nice" || got.Rules[1] != "stay on topic" {
+			t.Fatalf("GetByName: rules = %q", got.Rules)
+		}
+		if _, err = s.GetByName("missing"); !errors.Is(err, repository.ErrCommunityNotFound) {
+			t.Fatalf("GetByName: err = %v, want ErrCommunityNotFound", err)
+		}
+		if err = s.Create(community("music")); !errors.Is(err, repository.ErrCommunityExists) {
+			t.Fatalf("second Create: err = %v, want ErrCommunityExists", err)
+		}
+	})
+
+	t.Run("NoCreator", func(t *testing.T) {
+		s := newStore(t)
+		c := community("news")
+		c.Creator, c.Rules = nil, nil
+		if err := s.Create(c); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		got, err := s.GetByName("news")
+		if err != nil {
+			t.Fatalf("GetByName: %v", err)
+		}
+		if got.Creator != nil || got.Rules == nil || len(got.Rules) != 0 {
+			t.Fatalf("GetByName: creator = %+v, rules = %#v, want nil and empty", got.Creator, got.Rules)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		s := newStore(t)
+		for _, name := range []string{"news", "funny", "music"} {
+			if err := s.Create(community(name)); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+		got, err := s.List()
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(got) != 3 || got[0].Name != "funny" || got[1].Name != "music" || got[2].Name != "news" {
+			t.Fatalf("List: got %d communities, want funny, music, news", len(got))
+		}
+		if len(got[1].Rules) != 2 {
+			t.Fatalf("List: rules = %q, want two", got[1].Rules)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		s := newStore(t)
+		if err := s.Create(community("music")); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		change := &models.Community{
+			Name:        "music",
+			Title:       "Music",
+			Description: "new",
+			Rules:       []string{"no spam"},
+			Visibility:  models.VisibilityPrivate,
+		}
+		updated, err := s.Update(change)
+		if err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		got, err := s.GetByName("music")
+		if err != nil {
+			t.Fatalf("GetByName: %v", err)
+		}
+		for _, c := range []*models.Community{updated, got} {
+			if c.Title != "Music" || c.Description != "new" || len(c.Rules) != 1 || c.Rules[0] != "no spam" ||
+				c.Visibility != models.VisibilityPrivate {
+				t.Fatalf("Update: got %+v", c)
+			}
+			if c.Creator == nil || c.Creator.ID != alice.UserID {
+				t.Fatalf("Update: creator = %+v, want it kept", c.Creator)
+			}
+		}
+		if _, err = s.Update(&models.Community{Name: "missing"}); !errors.Is(err, repository.ErrCommunityNotFound) {
+			t.Fatalf("Update: err = %v, want ErrCommunityNotFound", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		s := newStore(t)
+		if err := s.Create(community("music")); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := s.Delete("music"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := s.GetByName("music"); !errors.Is(err, repository.ErrCommunityNotFound) {
+			t.Fatalf("GetByName after Delete: err = %v, want ErrCommunityNotFound", err)
+		}
+		if err := s.Delete("music"); !errors.Is(err, repository.ErrCommunityNotFound) {
+			t.Fatalf("second Delete: err = %v, want ErrCommunityNotFound", err)
+		}
+		// The name is free again.
+		if err := s.Create(community("music")); err != nil {
+			t.Fatalf("Create after Delete: %v", err)
+		}
+		got, err := s.GetByName("music")
+		if err != nil || len(got.Rules) != 2 {
+			t.Fatalf("GetByName after re-creating: %+v, %v", got, err)
+		}
+	})
+
+	t.Run("Moderators", func(t *testing.T) {
+		s := newStore(t)
+		c := community("music")
+		now := time.Now().UTC().Truncate(time.Second)
+		c.Moderators = []*models.Moderator{{
+			UserID:      alice.UserID,
+			Username:    alice.Username,
+			Permissions: models.ModeratorPermissions,
+			Invited:     now,
+			Accepted:    &now,
+		}}
+		if err := s.Create(c); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		got, err := s.GetByName("music")
+		if err != nil {
+			t.Fatalf("GetByName: %v", err)
+		}
+		if !got.IsFullModerator(alice.UserID) {
+			t.Fatalf("GetByName: moderators = %+v, want alice as full moderator", got.Moderators)
+		}
+
+		invite := &models.Moderator{
+			UserID:      bob.UserID,
+			Username:    bob.Username,
+			Permissions: []string{models.PermRemovePosts},
+			Invited:     now.Add(time.Second),
+		}
+		got, err = s.InviteModerator("music", invite)
+		if err != nil {
+			t.Fatalf("InviteModerator: %v", err)
+		}
+		if m := got.Moderator(bob.UserID); m == nil || m.Accepted != nil || got.Can(bob.UserID, models.PermRemovePosts) {
+			t.Fatalf("InviteModerator: bob = %+v, want a pending invite without rights", m)
+		}
+		if _, err = s.AcceptModerator("music", alice.UserID); !errors.Is(err, repository.ErrInviteNotFound) {
+			t.Fatalf("AcceptModerator of an accepted moderator: err = %v, want ErrInviteNotFound", err)
+		}
+		got, err = s.AcceptModerator("music", bob.UserID)
+		if err != nil {
+			t.Fatalf("AcceptModerator: %v", err)
+		}
+		if !got.Can(bob.UserID, models.PermRemovePosts) || got.Can(bob.UserID, models.PermBanUsers) {
+			t.Fatalf("AcceptModerator: bob = %+v, want only the posts permission", got.Moderator(bob.UserID))
+		}
+
+		// Inviting again changes the permissions and keeps the acceptance.
+		invite.Permissions = []string{models.PermBanUsers, models.PermEditRules}
+		if _, err = s.InviteModerator("music", invite); err != nil {
+			t.Fatalf("InviteModerator again: %v", err)
+		}
+		got, err = s.GetByName("music")
+		if err != nil {
+			t.Fatalf("GetByName: %v", err)
+		}
+		if len(got.Moderators) != 2 || got.Can(bob.UserID, models.PermRemovePosts) ||
+			!got.Can(bob.UserID, models.PermBanUsers) || !got.Can(bob.UserID, models.PermEditRules) {
+			t.Fatalf("InviteModerator again: moderators = %+v", got.Moderators)
+		}
+
+		got, err = s.RemoveModerator("music", bob.UserID)
+		if err != nil {
+			t.Fatalf("RemoveModerator: %v", err)
+		}
+		if len(got.Moderators) != 1 || got.Moderator(bob.UserID) != nil {
+			t.Fatalf("RemoveModerator: moderators = %+v", got.Moderators)
+		}
+		if _, err = s.RemoveModerator("music", bob.UserID); !errors.Is(err, repository.ErrModeratorNotFound) {
+			t.Fatalf("second RemoveModerator: err = %v, want ErrModeratorNotFound", err)
+		}
+		if _, err = s.InviteModerator("missing", invite); !errors.Is(err, repository.ErrCommunityNotFound) {
+			t.Fatalf("InviteModerator: err = %v, want ErrCommunityNotFound", err)
+		}
+	})
+
+	t.Run("Members", func(t *testing.T) {
+		s := newStore(t)
+		if err := s.Create(community("music")); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		now := time.Now().UTC().Truncate(time.Second)
+		member := &models.Member{UserID: bob.UserID, Username: bob.Username, Approved: now}
+		for i := 0; i < 2; i++ {
+			got, err := s.ApproveMember("music", member)
+			if err != nil {
+				t.Fatalf("ApproveMember: %v", err)
+			}
+			if len(got.Members) != 1 || !got.IsMember(bob.UserID) || !got.Members[0].Approved.Equal(now) {
+				t.Fatalf("ApproveMember: members = %+v, want bob once", got.Members)
+			}
+		}
+		got, err := s.GetByName("music")
+		if err != nil {
+			t.Fatalf("GetByName: %v", err)
+		}
+		if !got.IsMember(bob.UserID) || got.IsMember(alice.UserID) {
+			t.Fatalf("GetByName: members = %+v, want only bob", got.Members)
+		}
+
+		if got, err = s.RemoveMember("music", bob.UserID); err != nil || len(got.Members) != 0 {
+			t.Fatalf("RemoveMember: members = %+v, %v", got, err)
+		}
+		if _, err = s.RemoveMember("music", bob.UserID); !errors.Is(err, repository.ErrMemberNotFound) {
+			t.Fatalf("second RemoveMember: err = %v, want ErrMemberNotFound", err)
+		}
+		if _, err = s.ApproveMember("missing", member); !errors.Is(err, repository.ErrCommunityNotFound) {
+			t.Fatalf("ApproveMember: err = %v, want ErrCommunityNotFound", err)
+		}
+	})
+
+	t.Run("Bans", func(t *testing.T) {
+		s := newStore(t)
+		for _, name := range []string{"music", "news"} {
+			if err := s.Create(community(name)); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+		now := time.Now().UTC().Truncate(time.Second)
+		expires := now.Add(time.Hour)
+		temporary := &models.Ban{
+			Community: "music",
+			UserID:    bob.UserID,
+			Username:  bob.Username,
+			Reason:    "spam",
+			Note:      "third warning",
+			Moderator: alice.Author(),
+			Created:   now,
+			Expires:   &expires,
+		}
+		if err := s.Ban(temporary); err != nil {
+			t.Fatalf("Ban: %v", err)
+		}
+		got, err := s.GetBan("music", bob.UserID)
+		if err != nil {
+			t.Fatalf("GetBan: %v", err)
+		}
+		if got.Reason != "spam" || got.Note != "third warning" || got.Moderator == nil || got.Moderator.ID != alice.UserID ||
+			!got.Created.Equal(now) || got.Expires == nil || !got.Expires.Equal(expires) {
+			t.Fatalf("GetBan: got %+v", got)
+		}
+		if !got.Active(now) || got.Active(expires) {
+			t.Fatalf("GetBan: ban should be active until %v", expires)
+		}
+		if _, err = s.GetBan("news", bob.UserID); !errors.Is(err, repository.ErrBanNotFound) {
+			t.Fatalf("GetBan in another community: err = %v, want ErrBanNotFound", err)
+		}
+
+		// Banning again replaces the ban, here with a permanent one.
+		permanent := *temporary
+		permanent.Reason, permanent.Expires = "ban evasion", nil
+		if err = s.Ban(&permanent); err != nil {
+			t.Fatalf("Ban again: %v", err)
+		}
+		expired := &models.Ban{Community: "news", UserID: alice.UserID, Username: alice.Username, Reason: "r", Created: now, Expires: &now}
+		if err = s.Ban(expired); err != nil {
+			t.Fatalf("Ban: %v", err)
+		}
+		bans, err := s.Bans("music")
+		if err != nil {
+			t.Fatalf("Bans: %v", err)
+		}
+		if len(bans) != 1 || bans[0].Reason != "ban evasion" || bans[0].Expires != nil {
+			t.Fatalf("Bans: got %+v, want the permanent ban", bans)
+		}
+
+		n, err := s.ExpireBans(now)
+		if err != nil || n != 1 {
+			t.Fatalf("ExpireBans: %d, %v, want 1", n, err)
+		}
+		if _, err = s.GetBan("news", alice.UserID); !errors.Is(err, repository.ErrBanNotFound) {
+			t.Fatalf("GetBan after ExpireBans: err = %v, want ErrBanNotFound", err)
+		}
+		if _, err = s.GetBan("music", bob.UserID); err != nil {
+			t.Fatalf("ExpireBans removed a permanent ban: %v", err)
+		}
+
+		if err = s.Unban("music", bob.UserID); err != nil {
+			t.Fatalf("Unban: %v", err)
+		}
+		if err = s.Unban("music", bob.UserID); !errors.Is(err, repository.ErrBanNotFound) {
+			t.Fatalf("second Unban: err = %v, want ErrBanNotFound", err)
+		}
+		if err = s.Ban(&models.Ban{Community: "missing", UserID: bob.UserID}); !errors.Is(err, repository.ErrCommunityNotFound) {
+			t.Fatalf("Ban: err = %v, want ErrCommunityNotFound", err)
+		}
+		if _, err = s.Bans("missing"); !errors.Is(err, repository.ErrCommunityNotFound) {
+			t.Fatalf("Bans: err = %v, want ErrCommunityNotFound", err)
+		}
+	})
+
+	t.Run("Subscriptions", func(t *testing.T) {
+		s := newStore(t)
+		for _, name := range []string{"news", "funny", "music"} {
+			if err := s.Create(community(name)); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+		for _, name := range []string{"news", "funny", "news"} {
+			if err := s.Subscribe(name, alice.UserID); err != nil {
+				t.Fatalf("Subscribe(%s): %v", name, err)
+			}
+		}
+		if err := s.Subscribe("music", bob.UserID); err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+		got, err := s.Subscriptions(alice.UserID)
+		if err != nil {
+			t.Fatalf("Subscriptions: %v", err)
+		}
+		if len(got) != 2 || got[0].Name != "funny" || got[1].Name != "news" || len(got[1].Rules) != 2 {
+			t.Fatalf("Subscriptions: got %+v, want funny and news", got)
+		}
+
+		if err = s.Unsubscribe("funny", alice.UserID); err != nil {
+			t.Fatalf("Unsubscribe: %v", err)
+		}
+		if err = s.Unsubscribe("music", alice.UserID); err != nil {
+			t.Fatalf("Unsubscribe without a subscription: %v", err)
+		}
+		if err = s.Delete("news"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if got, err = s.Subscriptions(alice.UserID); err != nil || len(got) != 0 {
+			t.Fatalf("Subscriptions after Unsubscribe and Delete: got %+v, %v, want none", got, err)
+		}
+		if got, err = s.Subscriptions(bob.UserID); err != nil || len(got) != 1 || got[0].Name != "music" {
+			t.Fatalf("Subscriptions of bob: got %+v, %v, want music", got, err)
+		}
+		if err = s.Subscribe("missing", alice.UserID); !errors.Is(err, repository.ErrCommunityNotFound) {
+			t.Fatalf("Subscribe: err = %v, want ErrCommunityNotFound", err)
+		}
+	})
+
+	t.Run("ReturnsCopies", func(t *testing.T) {
+		s := newStore(t)
+		c := community("music")
+		if err := s.Create(c); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		c.Rules[0] = "changed"
+		got, err := s.GetByName("music")
+		if err != nil {
+			t.Fatalf("GetByName: %v", err)
+		}
+		got.Rules[1] = "changed"
+		again, err := s.GetByName("music")
+		if err != nil {
+			t.Fatalf("GetByName: %v", err)
+		}
+		if again.Rules[0] != "be nice" || again.Rules[1] != "stay on topic" {
+			t.Fatalf("changing a community outside the store changed it: rules = %q", again.Rules)
+		}
+	})
+}
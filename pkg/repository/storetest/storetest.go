@@ -0,0 +1,798 @@
+// Package storetest holds the conformance suites every repository backend
+// must pass. A backend plugs in by calling the suite from its own tests:
+//
+//	func TestPostStore(t *testing.T) {
+//		storetest.PostStore(t, func(t *testing.T) repository.PostStore {
+//			return NewMyPostRepo()
+//		})
+//	}
+package storetest
+
+import (
+	"errors"
+	"redditclone/pkg/models"
+	"redditclone/pkg/repository"
+	"testing"
+	"time"
+)
+
+type (
+	PostStoreFactory    func(t *testing.T) repository.PostStore
+	UserStoreFactory    func(t *testing.T) repository.UserStore
+	SessionStoreFactory func(t *testing.T) repository.SessionStore
+	TokenStoreFactory   func(t *testing.T) repository.RefreshTokenStore
+)
+
+var (
+	alice = &models.Session{ID: "alice-session", UserID: "alice-id", Username: "alice"}
+	bob   = &models.Session{ID: "bob-session", UserID: "bob-id", Username: "bob"}
+	// aliceAgain is a second login of alice.
+	aliceAgain = &models.Session{ID: "alice-session-2", UserID: "alice-id", Username: "alice"}
+)
+
+func textPost(category string) repository.PostRequest {
+	return repository.PostRequest{
+		Category: category,
+		Title:    "title",
+		Text:     "text",
+		Type:     "text",
+	}
+}
+
+// deletedAuthor reports whether a tombstone carries the placeholder author
+// the frontend needs instead of null.
+func deletedAuthor(c *models.Comment) bool {
+	return c.Author != nil && c.Author.ID == "" && c.Author.Username == models.DeletedCommentAuthor
+}
+
+// PostStore runs the post storage conformance suite against a fresh store
+// for every subtest.
+func PostStore(t *testing.T, newStore PostStoreFactory) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		s := newStore(t)
+		post, err := s.Create(textPost("music"), alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if post.ID == "" {
+			t.Fatal("Create: empty post ID")
+		}
+		if post.Author == nil || post.Author.ID != alice.UserID || post.Author.Username != alice.Username {
+			t.Fatalf("Create: author = %+v, want %s/%s", post.Author, alice.UserID, alice.Username)
+		}
+		if post.Text != "text" || post.URL != "" {
+			t.Fatalf("Create: text post got text=%q url=%q", post.Text, post.URL)
+		}
+		if post.Votes.Len() != 1 || post.Votes.Of(alice.UserID) != 1 {
+			t.Fatalf("Create: votes = %+v, want author upvote", post.Votes.List())
+		}
+
+		got, err := s.GetByID(post.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if got.ID != post.ID || got.Title != post.Title {
+			t.Fatalf("GetByID: got %+v, want %+v", got, post)
+		}
+	})
+
+	t.Run("LinkPost", func(t *testing.T) {
+		s := newStore(t)
+		req := repository.PostRequest{Category: "news", Title: "t", URL: "http://example.com", Type: "link"}
+		post, err := s.Create(req, alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if post.URL != req.URL || post.Text != "" {
+			t.Fatalf("Create: link post got text=%q url=%q", post.Text, post.URL)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		s := newStore(t)
+		if _, err := s.GetByID("missing"); !errors.Is(err, repository.ErrPostNotFound) {
+			t.Errorf("GetByID: err = %v, want ErrPostNotFound", err)
+		}
+		if _, err := s.ListByID("missing"); !errors.Is(err, repository.ErrPostNotFound) {
+			t.Errorf("ListByID: err = %v, want ErrPostNotFound", err)
+		}
+		if _, err := s.UpVote("missing", alice.UserID); !errors.Is(err, repository.ErrPostNotFound) {
+			t.Errorf("UpVote: err = %v, want ErrPostNotFound", err)
+		}
+		if _, err := s.AddCommentToPost("body", "missing", alice); !errors.Is(err, repository.ErrPostNotFound) {
+			t.Errorf("AddCommentToPost: err = %v, want ErrPostNotFound", err)
+		}
+		if err := s.DeletePost("missing"); !errors.Is(err, repository.ErrPostNotFound) {
+			t.Errorf("DeletePost: err = %v, want ErrPostNotFound", err)
+		}
+	})
+
+	t.Run("ListByIDCountsViews", func(t *testing.T) {
+		s := newStore(t)
+		post, err := s.Create(textPost("music"), alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		for i := 1; i <= 2; i++ {
+			got, err := s.ListByID(post.ID)
+			if err != nil {
+				t.Fatalf("ListByID: %v", err)
+			}
+			if got.Views != i {
+				t.Fatalf("ListByID: views = %d, want %d", got.Views, i)
+			}
+		}
+	})
+
+	t.Run("Listings", func(t *testing.T) {
+		s := newStore(t)
+		for _, req := range []struct {
+			category string
+			author   *models.Session
+		}{
+			{"music", alice},
+			{"music", bob},
+			{"news", alice},
+		} {
+			if _, err := s.Create(textPost(req.category), req.author); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		all, err := s.ListAll()
+		if err != nil {
+			t.Fatalf("ListAll: %v", err)
+		}
+		if len(all) != 3 {
+			t.Errorf("ListAll: got %d posts, want 3", len(all))
+		}
+
+		music, err := s.GetByCategory("music")
+		if err != nil {
+			t.Fatalf("GetByCategory: %v", err)
+		}
+		if len(music) != 2 {
+			t.Errorf("GetByCategory: got %d posts, want 2", len(music))
+		}
+		for _, p := range music {
+			if p.Category != "music" {
+				t.Errorf("GetByCategory: got category %q", p.Category)
+			}
+		}
+
+		byAlice, err := s.GetAllPostsUser(alice.Username)
+		if err != nil {
+			t.Fatalf("GetAllPostsUser: %v", err)
+		}
+		if len(byAlice) != 2 {
+			t.Errorf("GetAllPostsUser: got %d posts, want 2", len(byAlice))
+		}
+		if _, err = s.GetAllPostsUser("nobody"); !errors.Is(err, repository.ErrPostsNotFound) {
+			t.Errorf("GetAllPostsUser: err = %v, want ErrPostsNotFound", err)
+		}
+	})
+
+	t.Run("Voting", func(t *testing.T) {
+		s := newStore(t)
+		post, err := s.Create(textPost("music"), alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		post, err = s.DownVote(post.ID, bob.UserID)
+		if err != nil {
+			t.Fatalf("DownVote: %v", err)
+		}
+		if post.Votes.Len() != 2 || post.UpVotePerc != 50 {
+			t.Fatalf("DownVote: votes = %d, upvote%% = %d, want 2 and 50", post.Votes.Len(), post.UpVotePerc)
+		}
+
+		post, err = s.UpVote(post.ID, bob.UserID)
+		if err != nil {
+			t.Fatalf("UpVote: %v", err)
+		}
+		if post.Votes.Len() != 2 || post.UpVotePerc != 100 {
+			t.Fatalf("UpVote: votes = %d, upvote%% = %d, want 2 and 100", post.Votes.Len(), post.UpVotePerc)
+		}
+
+		post, err = s.UnVote(post.ID, bob.UserID)
+		if err != nil {
+			t.Fatalf("UnVote: %v", err)
+		}
+		if post.Votes.Len() != 1 {
+			t.Fatalf("UnVote: votes = %d, want 1", post.Votes.Len())
+		}
+	})
+
+	t.Run("VotesSurviveRelogin", func(t *testing.T) {
+		s := newStore(t)
+		post, err := s.Create(textPost("music"), alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		post, err = s.UpVote(post.ID, aliceAgain.UserID)
+		if err != nil {
+			t.Fatalf("UpVote: %v", err)
+		}
+		if post.Votes.Len() != 1 {
+			t.Fatalf("UpVote after relogin: votes = %+v, want a single vote", post.Votes.List())
+		}
+		if post.Author.ID != aliceAgain.UserID {
+			t.Fatalf("author ID = %q, want %q", post.Author.ID, aliceAgain.UserID)
+		}
+	})
+
+	t.Run("Comments", func(t *testing.T) {
+		s := newStore(t)
+		post, err := s.Create(textPost("music"), alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		post, err = s.AddCommentToPost("first", post.ID, bob)
+		if err != nil {
+			t.Fatalf("AddCommentToPost: %v", err)
+		}
+		post, err = s.AddCommentToPost("second", post.ID, alice)
+		if err != nil {
+			t.Fatalf("AddCommentToPost: %v", err)
+		}
+		if len(post.Comments) != 2 {
+			t.Fatalf("AddCommentToPost: got %d comments, want 2", len(post.Comments))
+		}
+		first := post.Comments[0]
+		if first.Body != "first" || first.ID == "" {
+			t.Fatalf("AddCommentToPost: first comment = %+v", first)
+		}
+		if first.Author == nil || first.Author.ID != bob.UserID || first.Author.Username != bob.Username {
+			t.Fatalf("AddCommentToPost: author = %+v, want the commenter %s", first.Author, bob.Username)
+		}
+
+		post, err = s.DeleteComment(first.ID, post.ID)
+		if err != nil {
+			t.Fatalf("DeleteComment: %v", err)
+		}
+		if len(post.Comments) != 1 || post.Comments[0].Body != "second" {
+			t.Fatalf("DeleteComment: comments = %+v", post.Comments)
+		}
+		if _, err = s.DeleteComment(first.ID, post.ID); !errors.Is(err, repository.ErrCommentNotFound) {
+			t.Fatalf("DeleteComment: err = %v, want ErrCommentNotFound", err)
+		}
+	})
+
+	t.Run("Replies", func(t *testing.T) {
+		s := newStore(t)
+		post, err := s.Create(textPost("music"), alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		post, err = s.AddCommentToPost("root", post.ID, bob)
+		if err != nil {
+			t.Fatalf("AddCommentToPost: %v", err)
+		}
+		root := post.Comments[0]
+		if root.ParentID != "" || root.Depth != 0 {
+			t.Fatalf("AddCommentToPost: root = %+v", root)
+		}
+		if _, err = s.ReplyToComment("x", post.ID, "missing", alice); !errors.Is(err, repository.ErrCommentNotFound) {
+			t.Fatalf("ReplyToComment: err = %v, want ErrCommentNotFound", err)
+		}
+		post, err = s.ReplyToComment("reply", post.ID, root.ID, alice)
+		if err != nil {
+			t.Fatalf("ReplyToComment: %v", err)
+		}
+		reply := post.Comments[1]
+		if reply.ParentID != root.ID || reply.Depth != 1 || reply.Author == nil || reply.Author.ID != alice.UserID {
+			t.Fatalf("ReplyToComment: reply = %+v", reply)
+		}
+		post, err = s.ReplyToComment("nested", post.ID, reply.ID, bob)
+		if err != nil {
+			t.Fatalf("ReplyToComment: %v", err)
+		}
+		nested := post.Comments[2]
+		if nested.ParentID != reply.ID || nested.Depth != 2 {
+			t.Fatalf("ReplyToComment: nested = %+v", nested)
+		}
+
+		// A comment with replies stays as a placeholder.
+		post, err = s.DeleteComment(root.ID, post.ID)
+		if err != nil {
+			t.Fatalf("DeleteComment: %v", err)
+		}
+		if len(post.Comments) != 3 {
+			t.Fatalf("DeleteComment: got %d comments, want 3", len(post.Comments))
+		}
+		if tomb := post.Comments[0]; !tomb.Deleted || tomb.Body != models.DeletedCommentBody || !deletedAuthor(tomb) {
+			t.Fatalf("DeleteComment: tombstone = %+v", tomb)
+		}
+		if got, _ := s.GetByID(post.ID); !deletedAuthor(got.Comments[0]) {
+			t.Fatalf("GetByID: tombstone author = %+v", got.Comments[0].Author)
+		}
+		if _, err = s.DeleteComment(root.ID, post.ID); !errors.Is(err, repository.ErrCommentNotFound) {
+			t.Fatalf("DeleteComment tombstone: err = %v, want ErrCommentNotFound", err)
+		}
+		if _, err = s.ReplyToComment("x", post.ID, root.ID, alice); !errors.Is(err, repository.ErrCommentNotFound) {
+			t.Fatalf("ReplyToComment tombstone: err = %v, want ErrCommentNotFound", err)
+		}
+
+		// Removing the last reply cleans up the placeholder above it.
+		if post, err = s.DeleteComment(nested.ID, post.ID); err != nil {
+			t.Fatalf("DeleteComment: %v", err)
+		}
+		if len(post.Comments) != 2 {
+			t.Fatalf("DeleteComment leaf: got %d comments, want 2", len(post.Comments))
+		}
+		if post, err = s.DeleteComment(reply.ID, post.ID); err != nil {
+			t.Fatalf("DeleteComment: %v", err)
+		}
+		if len(post.Comments) != 0 {
+			t.Fatalf("DeleteComment: comments = %+v, want the placeholder gone", post.Comments)
+		}
+	})
+
+	t.Run("CommentVotes", func(t *testing.T) {
+		s := newStore(t)
+		post, err := s.Create(textPost("music"), alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		post, err = s.AddCommentToPost("c", post.ID, bob)
+		if err != nil {
+			t.Fatalf("AddCommentToPost: %v", err)
+		}
+		commentID := post.Comments[0].ID
+		if c := post.Comments[0]; c.Score != 0 || len(c.Votes) != 0 {
+			t.Fatalf("AddCommentToPost: score = %d, votes = %+v", c.Score, c.Votes)
+		}
+
+		if _, err = s.UpVoteComment(post.ID, commentID, alice.UserID); err != nil {
+			t.Fatalf("UpVoteComment: %v", err)
+		}
+		if _, err = s.UpVoteComment(post.ID, commentID, bob.UserID); err != nil {
+			t.Fatalf("UpVoteComment: %v", err)
+		}
+		post, err = s.DownVoteComment(post.ID, commentID, alice.UserID)
+		if err != nil {
+			t.Fatalf("DownVoteComment: %v", err)
+		}
+		c := post.Comments[0]
+		if c.Score != 0 || c.UpVotePerc != 50 || c.VoteOf(alice.UserID) != -1 || c.VoteOf(bob.UserID) != 1 {
+			t.Fatalf("DownVoteComment: score = %d, percent = %d, votes = %+v", c.Score, c.UpVotePerc, c.Votes)
+		}
+
+		post, err = s.UnVoteComment(post.ID, commentID, alice.UserID)
+		if err != nil {
+			t.Fatalf("UnVoteComment: %v", err)
+		}
+		c = post.Comments[0]
+		if c.Score != 1 || c.UpVotePerc != 100 || c.VoteOf(alice.UserID) != 0 {
+			t.Fatalf("UnVoteComment: score = %d, percent = %d, votes = %+v", c.Score, c.UpVotePerc, c.Votes)
+		}
+		if post.Votes.Len() != 1 {
+			t.Fatalf("comment votes leaked into post votes: %+v", post.Votes.List())
+		}
+
+		if _, err = s.UpVoteComment(post.ID, "missing", alice.UserID); !errors.Is(err, repository.ErrCommentNotFound) {
+			t.Fatalf("UpVoteComment: err = %v, want ErrCommentNotFound", err)
+		}
+		if _, err = s.UpVoteComment("missing", commentID, alice.UserID); !errors.Is(err, repository.ErrPostNotFound) {
+			t.Fatalf("UpVoteComment: err = %v, want ErrPostNotFound", err)
+		}
+		if _, err = s.DeleteComment(commentID, post.ID); err != nil {
+			t.Fatalf("DeleteComment: %v", err)
+		}
+		if err = s.DeletePost(post.ID); err != nil {
+			t.Fatalf("DeletePost: %v", err)
+		}
+	})
+
+	t.Run("EditComment", func(t *testing.T) {
+		s := newStore(t)
+		post, err := s.Create(textPost("music"), alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		post, err = s.AddCommentToPost("v1", post.ID, bob)
+		if err != nil {
+			t.Fatalf("AddCommentToPost: %v", err)
+		}
+		commentID := post.Comments[0].ID
+		if post.Comments[0].Edited != nil {
+			t.Fatalf("AddCommentToPost: edited = %v, want nil", post.Comments[0].Edited)
+		}
+		history, err := s.CommentHistory(post.ID, commentID)
+		if err != nil {
+			t.Fatalf("CommentHistory: %v", err)
+		}
+		if len(history) != 1 || history[0].Version != 1 || history[0].Body != "v1" {
+			t.Fatalf("CommentHistory: got %+v, want the original only", history)
+		}
+
+		for _, body := range []string{"v2", "v3"} {
+			if post, err = s.EditComment(post.ID, commentID, body); err != nil {
+				t.Fatalf("EditComment: %v", err)
+			}
+		}
+		c := post.Comments[0]
+		if c.Body != "v3" || c.Edited == nil || c.Edited.Before(c.Created) {
+			t.Fatalf("EditComment: body = %q, edited = %v", c.Body, c.Edited)
+		}
+		if c.Author == nil || c.Author.ID != bob.UserID {
+			t.Fatalf("EditComment: author = %+v, want unchanged", c.Author)
+		}
+		history, err = s.CommentHistory(post.ID, commentID)
+		if err != nil {
+			t.Fatalf("CommentHistory: %v", err)
+		}
+		if len(history) != 3 {
+			t.Fatalf("CommentHistory: got %d revisions, want 3", len(history))
+		}
+		for i, body := range []string{"v1", "v2", "v3"} {
+			if history[i].Version != i+1 || history[i].Body != body {
+				t.Fatalf("CommentHistory: revision %d = %+v, want %s", i, history[i], body)
+			}
+		}
+		if !history[0].Created.Equal(c.Created) {
+			t.Fatalf("CommentHistory: original created %v, want %v", history[0].Created, c.Created)
+		}
+
+		if _, err = s.EditComment(post.ID, "missing", "x"); !errors.Is(err, repository.ErrCommentNotFound) {
+			t.Fatalf("EditComment: err = %v, want ErrCommentNotFound", err)
+		}
+		if _, err = s.CommentHistory("missing", commentID); !errors.Is(err, repository.ErrPostNotFound) {
+			t.Fatalf("CommentHistory: err = %v, want ErrPostNotFound", err)
+		}
+		if _, err = s.DeleteComment(commentID, post.ID); err != nil {
+			t.Fatalf("DeleteComment: %v", err)
+		}
+		if _, err = s.CommentHistory(post.ID, commentID); !errors.Is(err, repository.ErrCommentNotFound) {
+			t.Fatalf("CommentHistory after delete: err = %v, want ErrCommentNotFound", err)
+		}
+	})
+
+	t.Run("EditPost", func(t *testing.T) {
+		s := newStore(t)
+		post, err := s.Create(textPost("music"), alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if post.Edited != nil {
+			t.Fatalf("Create: edited = %v, want nil", post.Edited)
+		}
+		if post, err = s.EditPost(post.ID, "title 2", "text 2"); err != nil {
+			t.Fatalf("EditPost: %v", err)
+		}
+		if post, err = s.EditPost(post.ID, "title 2", "text 3"); err != nil {
+			t.Fatalf("EditPost: %v", err)
+		}
+		if post.Title != "title 2" || post.Text != "text 3" || post.Edited == nil {
+			t.Fatalf("EditPost: title = %q, text = %q, edited = %v", post.Title, post.Text, post.Edited)
+		}
+		if post.Votes.Len() != 1 || post.Author.ID != alice.UserID {
+			t.Fatalf("EditPost: votes = %+v, author = %+v, want unchanged", post.Votes, post.Author)
+		}
+
+		revisions, err := s.PostRevisions(post.ID)
+		if err != nil {
+			t.Fatalf("PostRevisions: %v", err)
+		}
+		want := []struct{ title, text string }{{"title", "text"}, {"title 2", "text 2"}, {"title 2", "text 3"}}
+		if len(revisions) != len(want) {
+			t.Fatalf("PostRevisions: got %d revisions, want %d", len(revisions), len(want))
+		}
+		for i, w := range want {
+			if rev := revisions[i]; rev.Version != i+1 || rev.Title != w.title || rev.Body != w.text {
+				t.Fatalf("PostRevisions: revision %d = %+v, want %v", i, rev, w)
+			}
+		}
+		if !revisions[0].Created.Equal(post.Created) || revisions[2].Created.Before(revisions[1].Created) {
+			t.Fatalf("PostRevisions: timestamps %v, %v, %v", revisions[0].Created, revisions[1].Created, revisions[2].Created)
+		}
+
+		if _, err = s.EditPost("missing", "t", "t"); !errors.Is(err, repository.ErrPostNotFound) {
+			t.Fatalf("EditPost: err = %v, want ErrPostNotFound", err)
+		}
+		if err = s.DeletePost(post.ID); err != nil {
+			t.Fatalf("DeletePost: %v", err)
+		}
+		if _, err = s.PostRevisions(post.ID); !errors.Is(err, repository.ErrPostNotFound) {
+			t.Fatalf("PostRevisions: err = %v, want ErrPostNotFound", err)
+		}
+	})
+
+	t.Run("ScoreFollowsVotes", func(t *testing.T) {
+		s := newStore(t)
+		post, err := s.Create(textPost("music"), alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if post.Score != 1 {
+			t.Fatalf("Create: score = %d, want the author's upvote", post.Score)
+		}
+		for _, step := range []struct {
+			name  string
+			vote  func(postID, userID string) (*models.Post, error)
+			user  string
+			score int
+		}{
+			{"DownVote", s.DownVote, bob.UserID, 0},
+			{"DownVote", s.DownVote, alice.UserID, -2},
+			{"UnVote", s.UnVote, alice.UserID, -1},
+			{"UpVote", s.UpVote, bob.UserID, 1},
+		} {
+			post, err = step.vote(post.ID, step.user)
+			if err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+			if post.Score != step.score {
+				t.Fatalf("%s by %s: score = %d, want %d", step.name, step.user, post.Score, step.score)
+			}
+		}
+		got, err := s.GetByID(post.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if got.Score != 1 {
+			t.Fatalf("GetByID: score = %d, want 1", got.Score)
+		}
+	})
+
+	t.Run("DeletePost", func(t *testing.T) {
+		s := newStore(t)
+		post, err := s.Create(textPost("music"), alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err = s.DeletePost(post.ID); err != nil {
+			t.Fatalf("DeletePost: %v", err)
+		}
+		if _, err = s.GetByID(post.ID); !errors.Is(err, repository.ErrPostNotFound) {
+			t.Fatalf("GetByID after delete: err = %v, want ErrPostNotFound", err)
+		}
+	})
+}
+
+// UserStore runs the user storage conformance suite.
+func UserStore(t *testing.T, newStore UserStoreFactory) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		s := newStore(t)
+		user, err := s.Create("alice", "hash")
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if user.ID == "" || user.Username != "alice" || user.Password != "hash" {
+			t.Fatalf("Create: got %+v", user)
+		}
+		got, err := s.GetByUsername("alice")
+		if err != nil {
+			t.Fatalf("GetByUsername: %v", err)
+		}
+		if got.ID != user.ID || got.Username != "alice" || got.Password != "hash" {
+			t.Fatalf("GetByUsername: got %+v, want %+v", got, user)
+		}
+		got, err = s.GetByID(user.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if got.Username != "alice" {
+			t.Fatalf("GetByID: got %+v, want %+v", got, user)
+		}
+	})
+
+	t.Run("SetRole", func(t *testing.T) {
+		s := newStore(t)
+		user, err := s.Create("alice", "hash")
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if user.Role != "" || user.IsModerator() {
+			t.Fatalf("Create: role = %q, want none", user.Role)
+		}
+		if err = s.SetRole("alice", models.RoleModerator); err != nil {
+			t.Fatalf("SetRole: %v", err)
+		}
+		got, err := s.GetByID(user.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if !got.IsModerator() {
+			t.Fatalf("GetByID: role = %q, want %q", got.Role, models.RoleModerator)
+		}
+		if err = s.SetRole("nobody", models.RoleAdmin); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("SetRole: err = %v, want ErrUserNotFound", err)
+		}
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		s := newStore(t)
+		if _, err := s.Create("alice", "hash"); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if _, err := s.Create("alice", "other"); !errors.Is(err, repository.ErrUserExists) {
+			t.Fatalf("Create duplicate: err = %v, want ErrUserExists", err)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		s := newStore(t)
+		if _, err := s.GetByUsername("nobody"); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("GetByUsername: err = %v, want ErrUserNotFound", err)
+		}
+		if _, err := s.GetByID("nobody-id"); !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("GetByID: err = %v, want ErrUserNotFound", err)
+		}
+	})
+}
+
+// SessionStore runs the session storage conformance suite. The factory
+// must return a store in which the user "alice" with ID "alice-id" exists.
+func SessionStore(t *testing.T, newStore SessionStoreFactory) {
+	user := &models.User{ID: alice.UserID, Username: alice.Username}
+	info := models.SessionInfo{Device: "laptop", IP: "127.0.0.1", UserAgent: "test"}
+
+	t.Run("Create", func(t *testing.T) {
+		s := newStore(t)
+		session, err := s.Create(user, info)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if session.ID == "" || session.ID == user.ID {
+			t.Fatalf("Create: session ID = %q, want a fresh ID", session.ID)
+		}
+		if session.UserID != user.ID || session.Username != user.Username {
+			t.Fatalf("Create: got %+v, want user %+v", session, user)
+		}
+		if session.SessionInfo != info || session.Created.IsZero() || session.LastSeen.IsZero() {
+			t.Fatalf("Create: got %+v, want info %+v and timestamps", session, info)
+		}
+
+		got, err := s.GetByID(session.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if got.ID != session.ID || got.UserID != user.ID || got.SessionInfo != info {
+			t.Fatalf("GetByID: got %+v, want %+v", got, session)
+		}
+	})
+
+	t.Run("MultipleSessions", func(t *testing.T) {
+		s := newStore(t)
+		first, err := s.Create(user, info)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		second, err := s.Create(user, models.SessionInfo{Device: "phone"})
+		if err != nil {
+			t.Fatalf("second Create: %v", err)
+		}
+		if first.ID == second.ID {
+			t.Fatal("Create: two logins share a session ID")
+		}
+		sessions, err := s.ListByUser(user.ID)
+		if err != nil {
+			t.Fatalf("ListByUser: %v", err)
+		}
+		if len(sessions) != 2 {
+			t.Fatalf("ListByUser: got %d sessions, want 2", len(sessions))
+		}
+		others, err := s.ListByUser("nobody")
+		if err != nil {
+			t.Fatalf("ListByUser: %v", err)
+		}
+		if len(others) != 0 {
+			t.Fatalf("ListByUser: got %d sessions of an unknown user", len(others))
+		}
+	})
+
+	t.Run("TouchAndDelete", func(t *testing.T) {
+		s := newStore(t)
+		session, err := s.Create(user, info)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		touched, err := s.Touch(session.ID)
+		if err != nil {
+			t.Fatalf("Touch: %v", err)
+		}
+		if touched.ID != session.ID || touched.UserID != user.ID {
+			t.Fatalf("Touch: got %+v, want %+v", touched, session)
+		}
+
+		if err = s.Delete(session.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err = s.Touch(session.ID); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("Touch after Delete: err = %v, want ErrSessionNotFound", err)
+		}
+		if _, err = s.GetByID(session.ID); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("GetByID after Delete: err = %v, want ErrSessionNotFound", err)
+		}
+		if err = s.Delete(session.ID); !errors.Is(err, repository.ErrSessionNotFound) {
+			t.Fatalf("second Delete: err = %v, want ErrSessionNotFound", err)
+		}
+	})
+}
+
+func refreshToken(hash, sessionID string) *models.RefreshToken {
+	now := time.Now()
+	return &models.RefreshToken{
+		Hash:      hash,
+		SessionID: sessionID,
+		UserID:    alice.UserID,
+		Created:   now,
+		Expires:   now.Add(time.Hour),
+	}
+}
+
+// RefreshTokenStore runs the refresh token storage conformance suite.
+func RefreshTokenStore(t *testing.T, newStore TokenStoreFactory) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		s := newStore(t)
+		token := refreshToken("hash-1", alice.ID)
+		if err := s.Create(token); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		got, err := s.GetByHash(token.Hash)
+		if err != nil {
+			t.Fatalf("GetByHash: %v", err)
+		}
+		if got.SessionID != token.SessionID || got.UserID != token.UserID || got.Used() {
+			t.Fatalf("GetByHash: got %+v, want %+v", got, token)
+		}
+		if _, err = s.GetByHash("missing"); !errors.Is(err, repository.ErrTokenNotFound) {
+			t.Fatalf("GetByHash: err = %v, want ErrTokenNotFound", err)
+		}
+	})
+
+	t.Run("MarkUsedOnce", func(t *testing.T) {
+		s := newStore(t)
+		token := refreshToken("hash-1", alice.ID)
+		if err := s.Create(token); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		used, err := s.MarkUsed(token.Hash)
+		if err != nil {
+			t.Fatalf("MarkUsed: %v", err)
+		}
+		if !used.Used() {
+			t.Fatal("MarkUsed: token not marked as used")
+		}
+		if _, err = s.MarkUsed(token.Hash); !errors.Is(err, repository.ErrTokenUsed) {
+			t.Fatalf("second MarkUsed: err = %v, want ErrTokenUsed", err)
+		}
+		got, err := s.GetByHash(token.Hash)
+		if err != nil {
+			t.Fatalf("GetByHash: %v", err)
+		}
+		if !got.Used() {
+			t.Fatal("GetByHash: used token reported as unused")
+		}
+		if _, err = s.MarkUsed("missing"); !errors.Is(err, repository.ErrTokenNotFound) {
+			t.Fatalf("MarkUsed: err = %v, want ErrTokenNotFound", err)
+		}
+	})
+
+	t.Run("RevokeFamily", func(t *testing.T) {
+		s := newStore(t)
+		for _, token := range []*models.RefreshToken{
+			refreshToken("hash-1", alice.ID),
+			refreshToken("hash-2", alice.ID),
+			refreshToken("hash-3", aliceAgain.ID),
+		} {
+			if err := s.Create(token); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+		if err := s.RevokeFamily(alice.ID); err != nil {
+			t.Fatalf("RevokeFamily: %v", err)
+		}
+		for _, hash := range []string{"hash-1", "hash-2"} {
+			if _, err := s.GetByHash(hash); !errors.Is(err, repository.ErrTokenNotFound) {
+				t.Fatalf("GetByHash(%s) after RevokeFamily: err = %v, want ErrTokenNotFound", hash, err)
+			}
+		}
+		if _, err := s.GetByHash("hash-3"); err != nil {
+			t.Fatalf("GetByHash of another family: %v", err)
+		}
+	})
+}
@@ -0,0 +1,270 @@
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"redditclone/pkg/models"
+	"redditclone/pkg/repository"
+	"sync"
+	"testing"
+)
+
+const (
+	stressWorkers = 16
+	stressRounds  = 25
+)
+
+func stressSession(i int) *models.Session {
+	return &models.Session{
+		ID:       fmt.Sprintf("stress-session-%d", i),
+		UserID:   fmt.Sprintf("stress-id-%d", i),
+		Username: fmt.Sprintf("stress-%d", i),
+	}
+}
+
+// parallel runs fn in stressWorkers goroutines and waits for all of them.
+// fn reports failures with t.Errorf, t.Fatal must not be called off the
+// test goroutine.
+func parallel(fn func(worker int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < stressWorkers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// readAll walks everything a handler would encode, so that the race
+// detector sees any write into the returned posts.
+func readAll(posts ...*models.Post) int {
+	n := 0
+	for _, p := range posts {
+		n += p.Score + p.Views + p.UpVotePerc + len(p.Title) + len(p.Author.Username)
+		for _, v := range p.Votes.List() {
+			n += v.Vote
+		}
+		for _, c := range p.Comments {
+			n += c.Score + len(c.Body) + len(c.Author.Username)
+			for _, v := range c.Votes {
+				n += v.Vote
+			}
+		}
+	}
+	return n
+}
+
+// PostStoreStress hammers voting, commenting, viewing and deletion from
+// parallel goroutines. Run it with -race: besides checking that no update
+// is lost, it makes the race detector watch readers encoding posts while
+// writers change them.
+func PostStoreStress(t *testing.T, newStore PostStoreFactory) {
+	t.Run("Snapshots", func(t *testing.T) {
+		s := newStore(t)
+		post, err := s.Create(textPost("music"), alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if _, err = s.AddCommentToPost("first", post.ID, bob); err != nil {
+			t.Fatalf("AddCommentToPost: %v", err)
+		}
+		got, err := s.GetByID(post.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		got.Title = "changed"
+		got.Votes.Remove(alice.UserID)
+		got.Votes.Set(bob.UserID, -1)
+		got.Comments[0].Body = "changed"
+
+		again, err := s.GetByID(post.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if again.Title != "title" || again.Votes.Len() != 1 || again.Votes.Of(alice.UserID) != 1 ||
+			again.Comments[0].Body != "first" {
+			t.Fatalf("GetByID: changing a returned post changed the store: %+v", again)
+		}
+	})
+
+	t.Run("Votes", func(t *testing.T) {
+		s := newStore(t)
+		post, err := s.Create(textPost("music"), alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		parallel(func(i int) {
+			userID := stressSession(i).UserID
+			for r := 0; r < stressRounds; r++ {
+				var err error
+				switch r % 3 {
+				case 0:
+					_, err = s.DownVote(post.ID, userID)
+				case 1:
+					_, err = s.UnVote(post.ID, userID)
+				case 2:
+					_, err = s.UpVote(post.ID, userID)
+				}
+				if err != nil {
+					t.Errorf("vote: %v", err)
+					return
+				}
+				if p, err := s.GetByID(post.ID); err == nil {
+					readAll(p)
+				}
+			}
+			if _, err := s.UpVote(post.ID, userID); err != nil {
+				t.Errorf("UpVote: %v", err)
+			}
+		})
+
+		got, err := s.GetByID(post.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		want := stressWorkers + 1
+		if got.Votes.Len() != want || got.Score != want || got.UpVotePerc != 100 {
+			t.Fatalf("after parallel voting: %d votes, score %d, %d%% up, want %d, %d, 100%%",
+				got.Votes.Len(), got.Score, got.UpVotePerc, want, want)
+		}
+	})
+
+	t.Run("Views", func(t *testing.T) {
+		s := newStore(t)
+		post, err := s.Create(textPost("music"), alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		parallel(func(int) {
+			for r := 0; r < stressRounds; r++ {
+				p, err := s.ListByID(post.ID)
+				if err != nil {
+					t.Errorf("ListByID: %v", err)
+					return
+				}
+				readAll(p)
+			}
+		})
+
+		got, err := s.GetByID(post.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if want := stressWorkers * stressRounds; got.Views != want {
+			t.Fatalf("Views = %d after parallel views, want %d", got.Views, want)
+		}
+	})
+
+	t.Run("Comments", func(t *testing.T) {
+		s := newStore(t)
+		post, err := s.Create(textPost("music"), alice)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		parallel(func(i int) {
+			session := stressSession(i)
+			for r := 0; r < stressRounds; r++ {
+				p, err := s.AddCommentToPost(fmt.Sprintf("%d-%d", i, r), post.ID, session)
+				if err != nil {
+					t.Errorf("AddCommentToPost: %v", err)
+					return
+				}
+				readAll(p)
+				parent := ownComment(p, session, fmt.Sprintf("%d-%d", i, r))
+				if parent == nil {
+					t.Errorf("AddCommentToPost: comment %d-%d missing", i, r)
+					return
+				}
+				p, err = s.ReplyToComment("reply", post.ID, parent.ID, session)
+				if err != nil {
+					t.Errorf("ReplyToComment: %v", err)
+					return
+				}
+				if _, err = s.UpVoteComment(post.ID, parent.ID, session.UserID); err != nil {
+					t.Errorf("UpVoteComment: %v", err)
+					return
+				}
+				for _, c := range p.Comments {
+					if c.ParentID == parent.ID {
+						if _, err = s.DeleteComment(c.ID, post.ID); err != nil {
+							t.Errorf("DeleteComment: %v", err)
+							return
+						}
+					}
+				}
+			}
+		})
+
+		got, err := s.GetByID(post.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if want := stressWorkers * stressRounds; len(got.Comments) != want {
+			t.Fatalf("%d comments after parallel commenting, want %d", len(got.Comments), want)
+		}
+		for _, c := range got.Comments {
+			if c.ParentID != "" || c.Score != 1 {
+				t.Fatalf("comment %+v: want a top level comment with score 1", c)
+			}
+		}
+	})
+
+	t.Run("Deletion", func(t *testing.T) {
+		s := newStore(t)
+		var ids []string
+		for i := 0; i < stressWorkers; i++ {
+			post, err := s.Create(textPost("music"), alice)
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			ids = append(ids, post.ID)
+		}
+		// Every worker deletes its own post halfway through while the others
+		// keep voting, commenting and listing on all posts.
+		parallel(func(i int) {
+			session := stressSession(i)
+			for r := 0; r < stressRounds; r++ {
+				if r == stressRounds/2 {
+					if err := s.DeletePost(ids[i]); err != nil {
+						t.Errorf("DeletePost: %v", err)
+						return
+					}
+				}
+				id := ids[(i+r)%len(ids)]
+				if _, err := s.UpVote(id, session.UserID); err != nil && !errors.Is(err, repository.ErrPostNotFound) {
+					t.Errorf("UpVote: %v", err)
+					return
+				}
+				if _, err := s.AddCommentToPost("c", id, session); err != nil && !errors.Is(err, repository.ErrPostNotFound) {
+					t.Errorf("AddCommentToPost: %v", err)
+					return
+				}
+				posts, err := s.GetByCategory("music")
+				if err != nil {
+					t.Errorf("GetByCategory: %v", err)
+					return
+				}
+				readAll(posts...)
+			}
+		})
+
+		posts, err := s.ListAll()
+		if err != nil {
+			t.Fatalf("ListAll: %v", err)
+		}
+		if len(posts) != 0 {
+			t.Fatalf("ListAll: %d posts left after deleting all", len(posts))
+		}
+	})
+}
+
+func ownComment(post *models.Post, session *models.Session, body string) *models.Comment {
+	for _, c := range post.Comments {
+		if c.Body == body && c.Author.ID == session.UserID {
+			return c
+		}
+	}
+	return nil
+}
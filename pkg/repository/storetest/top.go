@@ -0,0 +1,114 @@
+package storetest
+
+import (
+	"redditclone/pkg/models"
+	"redditclone/pkg/ranking"
+	"redditclone/pkg/repository"
+	"testing"
+	"time"
+)
+
+type TopPostStoreFactory func(t *testing.T) repository.TopPostStore
+
+var carol = &models.Session{ID: "carol-session", UserID: "carol-id", Username: "carol"}
+
+func postIDs(posts []*models.Post) []string {
+	ids := make([]string, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+func sameIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TopPostStore checks that stores keeping posts ordered by score keep the
+// order of the top ranking through votes and deletes.
+func TopPostStore(t *testing.T, newStore TopPostStoreFactory) {
+	s := newStore(t)
+	create := func(category string, session *models.Session) string {
+		t.Helper()
+		post, err := s.Create(textPost(category), session)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		return post.ID
+	}
+	do := func(op func(postID, userID string) (*models.Post, error), postID string, sessions ...*models.Session) {
+		t.Helper()
+		for _, session := range sessions {
+			if _, err := op(postID, session.UserID); err != nil {
+				t.Fatalf("voting: %v", err)
+			}
+		}
+	}
+	// check compares both the top posts and the top ranking of the whole
+	// group with want.
+	check := func(step string, top func(string, int) []*models.Post, all func(string) ([]*models.Post, error),
+		key string, want ...string) {
+		t.Helper()
+		if got := postIDs(top(key, 100)); !sameIDs(got, want) {
+			t.Fatalf("%s: top of %s = %v, want %v", step, key, got, want)
+		}
+		if got := postIDs(top(key, 2)); !sameIDs(got, want[:min(2, len(want))]) {
+			t.Fatalf("%s: top 2 of %s = %v, want %v", step, key, got, want[:min(2, len(want))])
+		}
+		posts, err := all(key)
+		if err != nil {
+			t.Fatalf("%s: listing %s: %v", step, key, err)
+		}
+		rank, _ := ranking.Lookup(ranking.Top)
+		ranking.Sort(posts, rank, time.Now())
+		if got := postIDs(posts); !sameIDs(got, want) {
+			t.Fatalf("%s: top ranking of %s = %v, want %v", step, key, got, want)
+		}
+	}
+	byCategory := func(step string, category string, want ...string) {
+		t.Helper()
+		check(step, s.TopByCategory, s.GetByCategory, category, want...)
+	}
+	byAuthor := func(step string, author string, want ...string) {
+		t.Helper()
+		check(step, s.TopByAuthor, s.GetAllPostsUser, author, want...)
+	}
+
+	first := create("music", alice)
+	second := create("music", bob)
+	third := create("music", alice)
+	other := create("news", alice)
+	// Authors upvote their own posts, so all start at 1. Ties are left out,
+	// posts created together may tie on the time too.
+	do(s.UpVote, first, bob, carol)
+	do(s.DownVote, third, bob)
+	byCategory("voted", "music", first, second, third)
+	byAuthor("voted", "alice", first, other, third)
+
+	do(s.DownVote, first, bob, carol)
+	do(s.UnVote, third, bob)
+	do(s.UpVote, second, carol)
+	do(s.UpVote, other, bob)
+	byCategory("revoted", "music", second, third, first)
+	byAuthor("revoted", "alice", other, third, first)
+
+	if err := s.DeletePost(second); err != nil {
+		t.Fatalf("DeletePost: %v", err)
+	}
+	if err := s.DeletePost(other); err != nil {
+		t.Fatalf("DeletePost: %v", err)
+	}
+	byCategory("deleted", "music", third, first)
+	byAuthor("deleted", "alice", third, first)
+	if got := s.TopByCategory("news", 10); len(got) != 0 {
+		t.Fatalf("TopByCategory of emptied category = %v", postIDs(got))
+	}
+}
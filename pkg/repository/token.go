@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"redditclone/pkg/models"
+	"sync"
+	"time"
+)
+
+type (
+	InMemoryRefreshTokenRepo struct {
+		tokens map[string]*models.RefreshToken
+		mu     sync.RWMutex
+	}
+)
+
+func NewInMemoryRefreshTokenRepo() *InMemoryRefreshTokenRepo {
+	return &InMemoryRefreshTokenRepo{
+		tokens: make(map[string]*models.RefreshToken),
+	}
+}
+
+func (r *InMemoryRefreshTokenRepo) Create(token *models.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[token.Hash] = copyRefreshToken(token)
+	return nil
+}
+
+func (r *InMemoryRefreshTokenRepo) GetByHash(hash string) (*models.RefreshToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	token, ok := r.tokens[hash]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	return copyRefreshToken(token), nil
+}
+
+func (r *InMemoryRefreshTokenRepo) MarkUsed(hash string) (*models.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[hash]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	if token.Used() {
+		return nil, ErrTokenUsed
+	}
+	token.UsedAt = time.Now()
+	return copyRefreshToken(token), nil
+}
+
+func (r *InMemoryRefreshTokenRepo) RevokeFamily(sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for hash, token := range r.tokens {
+		if token.SessionID == sessionID {
+			delete(r.tokens, hash)
+		}
+	}
+	return nil
+}
+
+// live returns every token that has not expired yet.
+func (r *InMemoryRefreshTokenRepo) live() []*models.RefreshToken {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := time.Now()
+	res := make([]*models.RefreshToken, 0, len(r.tokens))
+	for _, t := range r.tokens {
+		if t.Expires.After(now) {
+			res = append(res, copyRefreshToken(t))
+		}
+	}
+	return res
+}
+
+// restore puts a token back as-is, used when replaying persisted state.
+func (r *InMemoryRefreshTokenRepo) restore(token *models.RefreshToken) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[token.Hash] = token
+}
+
+func (r *InMemoryRefreshTokenRepo) forget(hash string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tokens, hash)
+}
+
+// family returns copies of the tokens issued to a session.
+func (r *InMemoryRefreshTokenRepo) family(sessionID string) []*models.RefreshToken {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var res []*models.RefreshToken
+	for _, t := range r.tokens {
+		if t.SessionID == sessionID {
+			res = append(res, copyRefreshToken(t))
+		}
+	}
+	return res
+}
+
+func copyRefreshToken(t *models.RefreshToken) *models.RefreshToken {
+	c := *t
+	return &c
+}
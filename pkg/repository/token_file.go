@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"encoding/json"
+	"redditclone/pkg/models"
+	"sync"
+)
+
+const (
+	tokenOpPut    = "put"
+	tokenOpRevoke = "revoke"
+)
+
+type (
+	// FileRefreshTokenRepo keeps refresh tokens in an
+	// InMemoryRefreshTokenRepo and makes them durable in a journal.
+	FileRefreshTokenRepo struct {
+		*InMemoryRefreshTokenRepo
+		journal *journal
+		mu      sync.Mutex
+	}
+
+	tokenRecord struct {
+		Op        string               `json:"op"`
+		SessionID string               `json:"sessionId,omitempty"`
+		Token     *models.RefreshToken `json:"token,omitempty"`
+	}
+
+	tokenSnapshot struct {
+		Tokens []*models.RefreshToken `json:"tokens"`
+	}
+)
+
+var _ RefreshTokenStore = (*FileRefreshTokenRepo)(nil)
+
+// NewFileRefreshTokenRepo opens (or creates) the refresh token journal in
+// dir and replays it.
+func NewFileRefreshTokenRepo(dir string) (*FileRefreshTokenRepo, error) {
+	j, err := openJournal(dir, "tokens")
+	if err != nil {
+		return nil, err
+	}
+	repo := &FileRefreshTokenRepo{
+		InMemoryRefreshTokenRepo: NewInMemoryRefreshTokenRepo(),
+		journal:                  j,
+	}
+
+	var snap tokenSnapshot
+	if err = j.loadSnapshot(&snap); err != nil {
+		return nil, err
+	}
+	for _, t := range snap.Tokens {
+		repo.restore(t)
+	}
+	err = j.replay(func(data json.RawMessage) error {
+		var rec tokenRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return err
+		}
+		if rec.Op == tokenOpRevoke {
+			return repo.InMemoryRefreshTokenRepo.RevokeFamily(rec.SessionID)
+		}
+		repo.restore(rec.Token)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (f *FileRefreshTokenRepo) Create(token *models.RefreshToken) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.InMemoryRefreshTokenRepo.Create(token); err != nil {
+		return err
+	}
+	return f.log(tokenRecord{Op: tokenOpPut, Token: token}, func() { f.forget(token.Hash) })
+}
+
+func (f *FileRefreshTokenRepo) MarkUsed(hash string) (*models.RefreshToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prev, err := f.InMemoryRefreshTokenRepo.GetByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	token, err := f.InMemoryRefreshTokenRepo.MarkUsed(hash)
+	if err != nil {
+		return nil, err
+	}
+	return token, f.log(tokenRecord{Op: tokenOpPut, Token: token}, func() { f.restore(prev) })
+}
+
+func (f *FileRefreshTokenRepo) RevokeFamily(sessionID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	family := f.InMemoryRefreshTokenRepo.family(sessionID)
+	if err := f.InMemoryRefreshTokenRepo.RevokeFamily(sessionID); err != nil {
+		return err
+	}
+	return f.log(tokenRecord{Op: tokenOpRevoke, SessionID: sessionID}, func() {
+		for _, token := range family {
+			f.restore(token)
+		}
+	})
+}
+
+// Compact folds the journal into a fresh snapshot, dropping expired tokens.
+func (f *FileRefreshTokenRepo) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.compact()
+}
+
+// Close compacts the journal and releases the log file.
+func (f *FileRefreshTokenRepo) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.compact(); err != nil {
+		return err
+	}
+	return f.journal.close()
+}
+
+// log journals rec, see journal.commit.
+func (f *FileRefreshTokenRepo) log(rec tokenRecord, undo func()) error {
+	return f.journal.commit(rec, true, undo, f.compact)
+}
+
+func (f *FileRefreshTokenRepo) compact() error {
+	return f.journal.compact(tokenSnapshot{Tokens: f.InMemoryRefreshTokenRepo.live()})
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"redditclone/pkg/models"
+	"time"
+)
+
+const refreshTokenColumns = `token_hash, session_id, user_id, created, expires, used_at`
+
+type (
+	SQLRefreshTokenRepo struct {
+		db *SQLDB
+	}
+)
+
+var _ RefreshTokenStore = (*SQLRefreshTokenRepo)(nil)
+
+func NewSQLRefreshTokenRepo(db *SQLDB) *SQLRefreshTokenRepo {
+	return &SQLRefreshTokenRepo{db: db}
+}
+
+func (r *SQLRefreshTokenRepo) Create(token *models.RefreshToken) error {
+	_, err := r.db.Exec(r.db.Rebind(`INSERT INTO refresh_tokens (`+refreshTokenColumns+`) VALUES (?, ?, ?, ?, ?, ?)`),
+		token.Hash, token.SessionID, token.UserID, token.Created, token.Expires, nullTime(token.UsedAt))
+	return err
+}
+
+func (r *SQLRefreshTokenRepo) GetByHash(hash string) (*models.RefreshToken, error) {
+	token := &models.RefreshToken{}
+	var usedAt sql.NullTime
+	err := r.db.QueryRow(r.db.Rebind(`SELECT `+refreshTokenColumns+` FROM refresh_tokens WHERE token_hash = ?`), hash).
+		Scan(&token.Hash, &token.SessionID, &token.UserID, &token.Created, &token.Expires, &usedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.UsedAt = usedAt.Time
+	return token, nil
+}
+
+func (r *SQLRefreshTokenRepo) MarkUsed(hash string) (*models.RefreshToken, error) {
+	res, err := r.db.Exec(r.db.Rebind(`UPDATE refresh_tokens SET used_at = ? WHERE token_hash = ? AND used_at IS NULL`),
+		time.Now(), hash)
+	if err != nil {
+		return nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	token, err := r.GetByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrTokenUsed
+	}
+	return token, nil
+}
+
+func (r *SQLRefreshTokenRepo) RevokeFamily(sessionID string) error {
+	_, err := r.db.Exec(r.db.Rebind(`DELETE FROM refresh_tokens WHERE session_id = ?`), sessionID)
+	return err
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -1,7 +1,7 @@
 package repository
 
 import (
-	"errors"
+	"github.com/google/uuid"
 	"redditclone/pkg/models"
 	"sync"
 )
@@ -9,6 +9,7 @@ import (
 type (
 	InMemoryUserRepo struct {
 		users map[string]*models.User
+		byID  map[string]*models.User
 		mu    sync.RWMutex
 	}
 )
@@ -16,6 +17,7 @@ type (
 func NewInMemoryUserRepo() *InMemoryUserRepo {
 	return &InMemoryUserRepo{
 		users: make(map[string]*models.User),
+		byID:  make(map[string]*models.User),
 	}
 }
 
@@ -23,13 +25,15 @@ func (r *InMemoryUserRepo) Create(userName, hashPassword string) (*models.User,
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if _, exist := r.users[userName]; exist {
-		return nil, errors.New("username already exists")
+		return nil, ErrUserExists
 	}
 	user := &models.User{
+		ID:       uuid.NewString(),
 		Username: userName,
 		Password: hashPassword,
 	}
 	r.users[userName] = user
+	r.byID[user.ID] = user
 	return user, nil
 }
 
@@ -39,7 +43,63 @@ func (r *InMemoryUserRepo) GetByUsername(username string) (*models.User, error)
 
 	user, exist := r.users[username]
 	if !exist {
-		return nil, errors.New("user not found")
+		return nil, ErrUserNotFound
 	}
 	return user, nil
 }
+
+func (r *InMemoryUserRepo) GetByID(userID string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, exist := r.byID[userID]
+	if !exist {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (r *InMemoryUserRepo) SetRole(username, role string) error {
+	_, err := r.setRole(username, role)
+	return err
+}
+
+func (r *InMemoryUserRepo) setRole(username, role string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, exist := r.users[username]
+	if !exist {
+		return nil, ErrUserNotFound
+	}
+	// Users handed out earlier are not modified in place.
+	updated := *user
+	updated.Role = role
+	r.users[username] = &updated
+	r.byID[updated.ID] = &updated
+	return &updated, nil
+}
+
+func (r *InMemoryUserRepo) list() []*models.User {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]*models.User, 0, len(r.users))
+	for _, u := range r.users {
+		res = append(res, u)
+	}
+	return res
+}
+
+// restore puts a user back as-is, used when replaying persisted state.
+func (r *InMemoryUserRepo) restore(user *models.User) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[user.Username] = user
+	r.byID[user.ID] = user
+}
+
+func (r *InMemoryUserRepo) forget(user *models.User) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.users, user.Username)
+	delete(r.byID, user.ID)
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"encoding/json"
+	"redditclone/pkg/models"
+	"sync"
+)
+
+const (
+	userOpCreate = "create"
+	userOpRole   = "role"
+)
+
+type (
+	// FileUserRepo keeps users in an InMemoryUserRepo and makes every
+	// mutation durable in a journal under its data directory.
+	FileUserRepo struct {
+		*InMemoryUserRepo
+		journal *journal
+		mu      sync.Mutex
+	}
+
+	userRecord struct {
+		Op   string       `json:"op"`
+		User *models.User `json:"user"`
+	}
+
+	userSnapshot struct {
+		Users []*models.User `json:"users"`
+	}
+)
+
+var _ UserStore = (*FileUserRepo)(nil)
+
+// NewFileUserRepo opens (or creates) the user journal in dir and replays it.
+func NewFileUserRepo(dir string) (*FileUserRepo, error) {
+	j, err := openJournal(dir, "users")
+	if err != nil {
+		return nil, err
+	}
+	repo := &FileUserRepo{
+		InMemoryUserRepo: NewInMemoryUserRepo(),
+		journal:          j,
+	}
+
+	var snap userSnapshot
+	if err = j.loadSnapshot(&snap); err != nil {
+		return nil, err
+	}
+	for _, u := range snap.Users {
+		repo.restore(legacyUserID(u))
+	}
+	err = j.replay(func(data json.RawMessage) error {
+		var rec userRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return err
+		}
+		repo.restore(legacyUserID(rec.User))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (f *FileUserRepo) Create(userName, hashPassword string) (*models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	user, err := f.InMemoryUserRepo.Create(userName, hashPassword)
+	if err != nil {
+		return nil, err
+	}
+	return user, f.log(userRecord{Op: userOpCreate, User: user}, func() { f.forget(user) })
+}
+
+func (f *FileUserRepo) SetRole(username, role string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// setRole replaces the user, the old one is still intact for an undo.
+	prev, err := f.InMemoryUserRepo.GetByUsername(username)
+	if err != nil {
+		return err
+	}
+	user, err := f.InMemoryUserRepo.setRole(username, role)
+	if err != nil {
+		return err
+	}
+	return f.log(userRecord{Op: userOpRole, User: user}, func() { f.restore(prev) })
+}
+
+// Compact folds the journal into a fresh snapshot.
+func (f *FileUserRepo) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.compact()
+}
+
+// Close compacts the journal and releases the log file.
+func (f *FileUserRepo) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.compact(); err != nil {
+		return err
+	}
+	return f.journal.close()
+}
+
+// log journals rec, see journal.commit.
+func (f *FileUserRepo) log(rec userRecord, undo func()) error {
+	return f.journal.commit(rec, true, undo, f.compact)
+}
+
+func (f *FileUserRepo) compact() error {
+	return f.journal.compact(userSnapshot{Users: f.InMemoryUserRepo.list()})
+}
+
+// legacyUserID gives users persisted before permanent IDs existed the same
+// ID the SQL migration assigns them: their username.
+func legacyUserID(user *models.User) *models.User {
+	if user.ID == "" {
+		user.ID = user.Username
+	}
+	return user
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"redditclone/pkg/models"
+)
+
+type (
+	SQLUserRepo struct {
+		db *SQLDB
+	}
+)
+
+var _ UserStore = (*SQLUserRepo)(nil)
+
+func NewSQLUserRepo(db *SQLDB) *SQLUserRepo {
+	return &SQLUserRepo{db: db}
+}
+
+func (r *SQLUserRepo) Create(userName, hashPassword string) (*models.User, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow(r.db.Rebind(`SELECT COUNT(*) FROM users WHERE username = ?`), userName).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists > 0 {
+		return nil, ErrUserExists
+	}
+	user := &models.User{
+		ID:       uuid.NewString(),
+		Username: userName,
+		Password: hashPassword,
+	}
+	_, err = tx.Exec(r.db.Rebind(`INSERT INTO users (id, username, password) VALUES (?, ?, ?)`), user.ID, user.Username, user.Password)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *SQLUserRepo) GetByUsername(username string) (*models.User, error) {
+	return r.getBy("username", username)
+}
+
+func (r *SQLUserRepo) GetByID(userID string) (*models.User, error) {
+	return r.getBy("id", userID)
+}
+
+func (r *SQLUserRepo) SetRole(username, role string) error {
+	res, err := r.db.Exec(r.db.Rebind(`UPDATE users SET role = ? WHERE username = ?`), role, username)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// getBy loads a user by one of its unique columns.
+func (r *SQLUserRepo) getBy(column, value string) (*models.User, error) {
+	user := &models.User{}
+	err := r.db.QueryRow(r.db.Rebind(`SELECT id, username, password, role FROM users WHERE `+column+` = ?`), value).
+		Scan(&user.ID, &user.Username, &user.Password, &user.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}